@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxBacktraceFrames is how many stack frames of a crash a debug build reports.
+const maxBacktraceFrames = 8
+
+var (
+	// sanitizerPrefix is the "==pid==" that AddressSanitizer starts its lines with.
+	sanitizerPrefix = regexp.MustCompile(`^==\d+==`)
+	// frameAddress is the program counter of a backtrace frame, "#0 0x55d0c4a4d1a9 in".
+	frameAddress = regexp.MustCompile(`^(#\d+) 0x[0-9a-f]+ `)
+)
+
+// shortBacktrace reduces the crash report of a debug build to what a contestant needs:
+// the error, the innermost stack frames with their source lines, and the summary.
+// Output without a sanitizer report is returned unchanged.
+func shortBacktrace(stderr string) string {
+	var report []string
+	frames := 0
+	inReport := false
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(sanitizerPrefix.ReplaceAllString(strings.TrimRight(line, "\r"), ""))
+		switch {
+		case strings.HasPrefix(line, "ERROR: AddressSanitizer:"):
+			inReport = true
+			report = append(report, line)
+		case inReport && strings.HasPrefix(line, "#"):
+			if frames < maxBacktraceFrames {
+				report = append(report, "    "+frameAddress.ReplaceAllString(line, "$1 "))
+			}
+			frames++
+		case inReport && strings.HasPrefix(line, "SUMMARY:"):
+			report = append(report, line)
+		}
+	}
+	if !inReport {
+		return stderr
+	}
+	return strings.Join(report, "\n")
+}
@@ -0,0 +1,31 @@
+package docker
+
+import "testing"
+
+const nullDereferenceReport = `AddressSanitizer:DEADLYSIGNAL
+=================================================================
+==1==ERROR: AddressSanitizer: SEGV on unknown address 0x000000000000 (pc 0x55d0c4a4d1a9 bp 0x7ffc1f2e0f80 sp 0x7ffc1f2e0f70 T0)
+==1==The signal is caused by a WRITE memory access.
+==1==Hint: address points to the zero page.
+    #0 0x55d0c4a4d1a9 in main /app/main.cpp:3
+    #1 0x7f3b1c9e7d09 in __libc_start_main ../csu/libc-start.c:308
+    #2 0x55d0c4a4d0c9 in _start (/app/main+0x10c9)
+
+AddressSanitizer can not provide additional info.
+SUMMARY: AddressSanitizer: SEGV /app/main.cpp:3 in main
+==1==ABORTING`
+
+func TestShortBacktrace(t *testing.T) {
+	want := `ERROR: AddressSanitizer: SEGV on unknown address 0x000000000000 (pc 0x55d0c4a4d1a9 bp 0x7ffc1f2e0f80 sp 0x7ffc1f2e0f70 T0)
+    #0 in main /app/main.cpp:3
+    #1 in __libc_start_main ../csu/libc-start.c:308
+    #2 in _start (/app/main+0x10c9)
+SUMMARY: AddressSanitizer: SEGV /app/main.cpp:3 in main`
+	if got := shortBacktrace(nullDereferenceReport); got != want {
+		t.Errorf("shortBacktrace() = %q, want %q", got, want)
+	}
+
+	if got := shortBacktrace("terminate called after throwing an instance of 'std::bad_alloc'"); got != "terminate called after throwing an instance of 'std::bad_alloc'" {
+		t.Errorf("shortBacktrace() changed output without a sanitizer report: %q", got)
+	}
+}
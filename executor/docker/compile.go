@@ -0,0 +1,270 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+)
+
+// compilation is the outcome of a successful compile: the compiler's warnings, when
+// they are enabled, and how long the compiler ran.
+type compilation struct {
+	warnings string
+	millis   int64
+}
+
+// compileSource compiles the source already copied into /app of the container. It
+// returns a COMPILATION_ERROR result, which also carries the compile time, when the
+// compile failed.
+func compileSource(ctx context.Context, cli *client.Client, containerID, language string, config LanguageConfig, req RunRequest) (compilation, *ExecutionResult, error) {
+	submissionID := req.SubmissionID
+	execConfig := types.ExecConfig{
+		Cmd:          buildCompileCmd(config, req),
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	execID, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return compilation{}, nil, fmt.Errorf("failed to create compile exec: %w", err)
+	}
+
+	execResp, err := cli.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
+	if err != nil {
+		return compilation{}, nil, fmt.Errorf("failed to attach to compile exec: %w", err)
+	}
+	defer execResp.Close()
+
+	started := time.Now()
+	if err := cli.ContainerExecStart(ctx, execID.ID, types.ExecStartCheck{}); err != nil {
+		return compilation{}, nil, fmt.Errorf("failed to start compile exec: %w", err)
+	}
+
+	// Always read compilation output (even on success). Reading to EOF also waits
+	// for the compiler to exit, so the inspected exit code below is final.
+	var compileOutput bytes.Buffer
+	stdcopy.StdCopy(&compileOutput, &compileOutput, execResp.Reader)
+	compileOutputStr := compileOutput.String()
+	compiled := compilation{millis: time.Since(started).Milliseconds()}
+
+	// Check compilation result
+	inspect, err := cli.ContainerExecInspect(ctx, execID.ID)
+	if err != nil {
+		return compilation{}, nil, fmt.Errorf("failed to inspect compile exec: %w", err)
+	}
+
+	// A compiler killed for running out of memory gets a clean verdict of its own
+	if compilerOutOfMemory(inspect.ExitCode, compileOutputStr) {
+		log.Printf("[Submission %d] Compiler ran out of memory", submissionID)
+		result := &ExecutionResult{
+			Status:        "COMPILATION_ERROR",
+			Output:        compilerOOMMessage,
+			CompileMillis: compiled.millis,
+		}
+		recordCommands(result, config, req)
+		return compiled, result, nil
+	}
+
+	// Check for compilation failure - either non-zero exit code OR error messages in output
+	compilationFailed := inspect.ExitCode != 0 || strings.Contains(compileOutputStr, "fatal error") ||
+		strings.Contains(compileOutputStr, "No such file") || strings.Contains(compileOutputStr, "error:")
+
+	if compilationFailed {
+		result := &ExecutionResult{
+			Status:        "COMPILATION_ERROR",
+			Output:        compileOutputStr,
+			TimeMillis:    0,
+			MemoryKB:      0,
+			CompileMillis: compiled.millis,
+		}
+		recordCommands(result, config, req)
+		return compiled, result, nil
+	}
+
+	// A compiler can exit zero without writing the binary the execute step runs
+	if config.Binary != "" {
+		exists, err := fileExists(ctx, cli, containerID, config.Binary)
+		if err != nil {
+			return compilation{}, nil, fmt.Errorf("failed to check compiled binary: %w", err)
+		}
+		if !exists {
+			log.Printf("[Submission %d] Compile succeeded but %s was not produced", submissionID, config.Binary)
+			result := &ExecutionResult{
+				Status:        "COMPILATION_ERROR",
+				Output:        strings.TrimSpace(compileOutputStr + "\nbinary not produced: expected /app/" + config.Binary),
+				CompileMillis: compiled.millis,
+			}
+			recordCommands(result, config, req)
+			return compiled, result, nil
+		}
+	}
+
+	// For C and C++, make the executable file executable
+	if language == "C" || language == "CPP" {
+		chmodConfig := types.ExecConfig{
+			Cmd:          []string{"chmod", "+x", "main"},
+			AttachStdout: false,
+			AttachStderr: false,
+		}
+		chmodExecID, err := cli.ContainerExecCreate(ctx, containerID, chmodConfig)
+		if err != nil {
+			return compilation{}, nil, fmt.Errorf("failed to create chmod exec: %w", err)
+		}
+
+		if err := cli.ContainerExecStart(ctx, chmodExecID.ID, types.ExecStartCheck{}); err != nil {
+			return compilation{}, nil, fmt.Errorf("failed to start chmod exec: %w", err)
+		}
+	}
+
+	if cfg.CompileWarnings {
+		compiled.warnings = strings.TrimSpace(compileOutputStr)
+	}
+	return compiled, nil, nil
+}
+
+// compilerOOMMessage is the output of a compile that the compiler ran out of memory for.
+const compilerOOMMessage = "compiler out of memory"
+
+// compilerOutOfMemory reports whether the compiler was OOM-killed: either it was
+// SIGKILLed itself (exit code 137, e.g. javac), or a driver such as g++ reports that
+// the program it ran was.
+func compilerOutOfMemory(exitCode int, output string) bool {
+	return exitCode == 137 || strings.Contains(output, "Killed signal terminated program")
+}
+
+// compileMemoryBytes returns the memory limit to compile under: the configured
+// CompileMemoryBytes, or the run's own limit when none is configured.
+func compileMemoryBytes(memoryLimitBytes int64) int64 {
+	if cfg.CompileMemoryBytes > 0 {
+		return cfg.CompileMemoryBytes
+	}
+	return memoryLimitBytes
+}
+
+// memoryUpdater is the part of the Docker client used to change a running
+// container's memory limit.
+type memoryUpdater interface {
+	ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error)
+}
+
+// withMemoryLimit runs fn with the container's memory limit set to limitBytes, then
+// puts back memoryLimitBytes. Swap is set to the memory limit, as Docker does for
+// containers created with a memory limit alone.
+func withMemoryLimit(ctx context.Context, cli memoryUpdater, containerID string, limitBytes, memoryLimitBytes int64, fn func() error) error {
+	if limitBytes == memoryLimitBytes {
+		return fn()
+	}
+	if err := setMemoryLimit(ctx, cli, containerID, limitBytes); err != nil {
+		return err
+	}
+	fnErr := fn()
+	if err := setMemoryLimit(ctx, cli, containerID, memoryLimitBytes); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// setMemoryLimit sets a running container's memory limit, with as much swap again.
+func setMemoryLimit(ctx context.Context, cli memoryUpdater, containerID string, limitBytes int64) error {
+	_, err := cli.ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		Resources: container.Resources{Memory: limitBytes, MemorySwap: 2 * limitBytes},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set memory limit to %d bytes: %w", limitBytes, err)
+	}
+	return nil
+}
+
+// runImage returns the image that runs the language's programs.
+func runImage(config LanguageConfig) string {
+	if cfg.SeparateCompile && config.CompileCmd != nil && config.RuntimeImage != "" {
+		return config.RuntimeImage
+	}
+	return config.Image
+}
+
+// compileSeparately compiles the source in a throwaway container and returns the
+// contents of /app without the source, as a tar archive ready for CopyToContainer.
+// The run container then never sees the source or the compiler's leftovers.
+func compileSeparately(ctx context.Context, cli *client.Client, language string, config LanguageConfig, req RunRequest, sourceFilePath string, hostConfig *container.HostConfig) ([]byte, compilation, *ExecutionResult, error) {
+	lifetime := containerLifetime(req.TimeLimitSeconds)
+	creations.wait()
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:      config.Image,
+		Cmd:        []string{"sleep", strconv.Itoa(int(lifetime.Seconds()))},
+		WorkingDir: "/app",
+		Labels:     containerLabels(req.SubmissionID, lifetime),
+	}, hostConfig, nil, nil, "oj-compile-"+uuid.New().String())
+	if err != nil {
+		return nil, compilation{}, nil, fmt.Errorf("failed to create compile container: %w", err)
+	}
+	containerID := resp.ID
+	defer cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true})
+
+	if err := cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+		return nil, compilation{}, nil, fmt.Errorf("failed to start compile container: %w", err)
+	}
+	if err := copyFileToContainer(cli, ctx, containerID, sourceFilePath, config.SourceFile, req.SubmissionID); err != nil {
+		return nil, compilation{}, nil, fmt.Errorf("failed to copy source file to compile container: %w", err)
+	}
+
+	compiled, failure, err := compileSource(ctx, cli, containerID, language, config, req)
+	if err != nil || failure != nil {
+		return nil, compiled, failure, err
+	}
+
+	reader, _, err := cli.CopyFromContainer(ctx, containerID, "/app")
+	if err != nil {
+		return nil, compilation{}, nil, fmt.Errorf("failed to copy artifact from compile container: %w", err)
+	}
+	defer reader.Close()
+	artifact, err := extractArtifact(reader, config.SourceFile)
+	if err != nil {
+		return nil, compilation{}, nil, fmt.Errorf("failed to extract artifact: %w", err)
+	}
+	log.Printf("[Submission %d] Compiled %s in a separate container (%d byte artifact)", req.SubmissionID, language, len(artifact))
+	return artifact, compiled, nil, nil
+}
+
+// extractArtifact rewrites a CopyFromContainer archive of /app so its entries are
+// relative to /app, leaving out the directory itself and the source file.
+func extractArtifact(r io.Reader, sourceFile string) ([]byte, error) {
+	var buf bytes.Buffer
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry: %w", err)
+		}
+		name := strings.TrimPrefix(header.Name, "app/")
+		if name == "" || name == header.Name || strings.TrimSuffix(name, "/") == sourceFile {
+			continue
+		}
+		header.Name = name
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, fmt.Errorf("failed to copy tar entry: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
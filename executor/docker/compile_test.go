@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestExtractArtifact(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	entries := []struct {
+		name, body string
+		dir        bool
+	}{
+		{name: "app/", dir: true},
+		{name: "app/Main.java", body: "class Main {}"},
+		{name: "app/Main.class", body: "bytecode"},
+		{name: "app/Main$Inner.class", body: "inner"},
+		{name: "app/lib/", dir: true},
+		{name: "app/lib/helper.o", body: "object"},
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.dir {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+
+	artifact, err := extractArtifact(&archive, "Main.java")
+	if err != nil {
+		t.Fatalf("extractArtifact failed: %v", err)
+	}
+
+	got := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(artifact))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(tr)
+		got[header.Name] = string(body)
+	}
+	want := map[string]string{
+		"Main.class":       "bytecode",
+		"Main$Inner.class": "inner",
+		"lib/":             "",
+		"lib/helper.o":     "object",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("artifact entries = %v, want %v", got, want)
+	}
+}
+
+func TestRunImage(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	if got := runImage(langConfigs["JAVA"]); got != "openjdk:11-jdk-slim" {
+		t.Errorf("runImage(JAVA) = %s, want the JDK image when compiling in place", got)
+	}
+
+	config := DefaultConfig()
+	config.SeparateCompile = true
+	Configure(config)
+	tests := map[string]string{
+		"JAVA":   "openjdk:11-jre-slim",
+		"CPP":    "gcc:latest",
+		"PYTHON": "python:3.9-slim",
+	}
+	for language, want := range tests {
+		if got := runImage(langConfigs[language]); got != want {
+			t.Errorf("runImage(%s) = %s, want %s", language, got, want)
+		}
+	}
+}
+
+func TestCompilerOutOfMemory(t *testing.T) {
+	tests := []struct {
+		exitCode int
+		output   string
+		want     bool
+	}{
+		{137, "", true},
+		{1, "g++: fatal error: Killed signal terminated program cc1plus\ncompilation terminated.", true},
+		{1, "main.cpp:1:1: error: expected unqualified-id", false},
+		{0, "", false},
+	}
+	for _, tt := range tests {
+		if got := compilerOutOfMemory(tt.exitCode, tt.output); got != tt.want {
+			t.Errorf("compilerOutOfMemory(%d, %q) = %v, want %v", tt.exitCode, tt.output, got, tt.want)
+		}
+	}
+}
+
+// recordingUpdater is a memoryUpdater that records the memory limits it is given.
+type recordingUpdater struct {
+	limits []int64
+	err    error
+}
+
+func (u *recordingUpdater) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error) {
+	u.limits = append(u.limits, updateConfig.Memory)
+	if updateConfig.MemorySwap != 2*updateConfig.Memory {
+		return container.ContainerUpdateOKBody{}, errors.New("swap not set alongside memory")
+	}
+	return container.ContainerUpdateOKBody{}, u.err
+}
+
+func TestWithMemoryLimit(t *testing.T) {
+	updater := &recordingUpdater{}
+	var during []int64
+	compileErr := errors.New("compile failed")
+	err := withMemoryLimit(context.Background(), updater, "c", 1<<30, 256<<20, func() error {
+		during = append(during, updater.limits...)
+		return compileErr
+	})
+	if err != compileErr {
+		t.Errorf("err = %v, want the function's error", err)
+	}
+	if !reflect.DeepEqual(during, []int64{1 << 30}) {
+		t.Errorf("limits before running = %v, want the compile limit", during)
+	}
+	if !reflect.DeepEqual(updater.limits, []int64{1 << 30, 256 << 20}) {
+		t.Errorf("limits = %v, want the compile limit then the run limit", updater.limits)
+	}
+
+	// Nothing to change when the limits are the same
+	updater = &recordingUpdater{}
+	withMemoryLimit(context.Background(), updater, "c", 256<<20, 256<<20, func() error { return nil })
+	if len(updater.limits) != 0 {
+		t.Errorf("limits = %v, want no updates", updater.limits)
+	}
+
+	// A failed update does not run the function
+	updater = &recordingUpdater{err: errors.New("daemon error")}
+	ran := false
+	if err := withMemoryLimit(context.Background(), updater, "c", 1<<30, 256<<20, func() error { ran = true; return nil }); err == nil || ran {
+		t.Errorf("err = %v, ran = %v, want an error without running", err, ran)
+	}
+}
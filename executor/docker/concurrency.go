@@ -0,0 +1,27 @@
+package docker
+
+// languageSlots caps how many containers of each language run at once, so that heavy
+// runtimes such as the JVM cannot overwhelm the host while lighter languages still run
+// at full worker concurrency. Languages without a cap are not limited.
+type languageSlots map[string]chan struct{}
+
+func newLanguageSlots(limits map[string]int) languageSlots {
+	slots := make(languageSlots, len(limits))
+	for language, limit := range limits {
+		if limit > 0 {
+			slots[language] = make(chan struct{}, limit)
+		}
+	}
+	return slots
+}
+
+// acquire blocks until a container of the language may run, and returns the function
+// that gives the slot back.
+func (s languageSlots) acquire(language string) func() {
+	slot, ok := s[language]
+	if !ok {
+		return func() {}
+	}
+	slot <- struct{}{}
+	return func() { <-slot }
+}
@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLanguageSlotsCapConcurrency(t *testing.T) {
+	slots := newLanguageSlots(map[string]int{"JAVA": 2})
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	peak := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		for _, language := range []string{"JAVA", "PYTHON"} {
+			wg.Add(1)
+			go func(language string) {
+				defer wg.Done()
+				release := slots.acquire(language)
+				defer release()
+
+				mu.Lock()
+				running[language]++
+				if running[language] > peak[language] {
+					peak[language] = running[language]
+				}
+				mu.Unlock()
+
+				time.Sleep(20 * time.Millisecond)
+
+				mu.Lock()
+				running[language]--
+				mu.Unlock()
+			}(language)
+		}
+	}
+	wg.Wait()
+
+	if peak["JAVA"] > 2 {
+		t.Errorf("peak concurrent JAVA runs = %d, want at most 2", peak["JAVA"])
+	}
+	if peak["PYTHON"] <= 2 {
+		t.Errorf("peak concurrent PYTHON runs = %d, want PYTHON to run uncapped", peak["PYTHON"])
+	}
+}
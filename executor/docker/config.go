@@ -0,0 +1,191 @@
+package docker
+
+import "time"
+
+// Ways of feeding a test input to the program's stdin.
+const (
+	// StdinFile copies the input into the container as /app/input.txt and redirects
+	// the program's stdin from it.
+	StdinFile = "FILE"
+	// StdinPipe writes the input through the exec connection and closes its write side.
+	StdinPipe = "PIPE"
+)
+
+// Config holds executor-wide settings that apply to every container run.
+type Config struct {
+	// UnbufferedOutput disables stdio buffering of the submitted program so that
+	// output written before an abnormal exit (abort, _exit, a crash) still reaches
+	// /app/stdout.txt. It slows down programs that print a lot, so it is off by default.
+	UnbufferedOutput bool
+
+	// ScratchDir is the host directory under which per-run scratch directories are
+	// created. Empty means the system temp directory.
+	ScratchDir string
+
+	// ScratchMaxAge is how old a leftover scratch directory must be before the
+	// startup sweep considers it leaked and removes it.
+	ScratchMaxAge time.Duration
+
+	// CompileWarnings compiles with each language's WarningFlags and reports the
+	// warnings of successful compiles in ExecutionResult.CompileOutput.
+	CompileWarnings bool
+
+	// WarningFlags replaces the built-in warning flags of the languages listed, keyed
+	// by canonical name (e.g. CPP: -Wall -Wshadow). An empty list compiles the language
+	// without warning flags.
+	WarningFlags map[string][]string
+
+	// ContainerCPUs caps the cores each container may use. 0 means no per-container
+	// limit, unless CPUBudget is set, in which case each container gets one core.
+	ContainerCPUs float64
+
+	// CPUBudget is the total number of cores shared by all concurrently running
+	// containers. Runs wait until their allocation fits in the budget. 0 disables it.
+	CPUBudget float64
+
+	// MemoryBudgetBytes is the host memory shared by all concurrently running
+	// containers: runs wait until their memory limit fits in it, so that the
+	// containers together can never push the host out of memory. 0 disables it.
+	MemoryBudgetBytes int64
+
+	// TLEGracePeriod lets a program keep running past its time limit before it is
+	// killed. It is still judged TIME_LIMIT_EXCEEDED, but the result records how far
+	// it overran, which tells a near miss apart from a runaway program.
+	TLEGracePeriod time.Duration
+
+	// IsolateMounts hides everything the host provides to a container (the
+	// hosts/hostname/resolv.conf files Docker mounts in) along with the image's
+	// shadow files, and disables networking, leaving the submission /app and the
+	// language runtime only.
+	IsolateMounts bool
+
+	// LanguageAliases maps additional lower-case language names to supported
+	// languages, on top of (and overriding) the built-in aliases.
+	LanguageAliases map[string]string
+
+	// LanguageConcurrency caps how many containers of a language (keyed by its
+	// canonical name) may run at once. Languages not listed are only limited by the
+	// number of workers.
+	LanguageConcurrency map[string]int
+
+	// StdinMode is how inputs reach non-interactive programs, StdinFile or StdinPipe.
+	// Interactive runs always use the pipe. Redirecting from a file avoids the
+	// exec connection's write/CloseWrite path, which can stall on large inputs.
+	StdinMode string
+
+	// KillTimeout is how long a timed-out container may take to stop after SIGKILL.
+	// A program in uninterruptible sleep can ignore the signal; its container is then
+	// force-removed so that the worker is not blocked on it.
+	KillTimeout time.Duration
+
+	// Debug records the resolved compile and execute command lines of every run in
+	// ExecutionResult, so that operators can reproduce a judging run exactly.
+	Debug bool
+
+	// ReuseContainers keeps the containers of interpreted languages (which have no
+	// compile step) warm between submissions. After a run every leftover process is
+	// killed and /app and the temp directories are emptied before the container is
+	// lent to the next submission; containers that timed out or fail the reset are
+	// removed instead.
+	ReuseContainers bool
+
+	// WarmContainerLifetime is how long a reusable container lives. It serves the runs
+	// that end before then, and then stops by itself, so that the reaper can remove it
+	// even if the executor that pooled it crashed.
+	WarmContainerLifetime time.Duration
+
+	// Runtime is the OCI runtime submission containers run under, e.g. "runsc" for
+	// gVisor's stronger isolation. It must be registered with the Docker daemon.
+	// Empty means the daemon's default runtime.
+	Runtime string
+
+	// OutputGracePeriod is how long to wait, once a program's output stream has
+	// closed, for Docker to report its exec as exited before the output files are
+	// read. A program that exits very quickly can otherwise have its output read
+	// before the shell's redirection has completed, and show up empty.
+	OutputGracePeriod time.Duration
+
+	// ContainerCreateRate caps how many containers are created per second, so that a
+	// burst of submissions does not overwhelm the Docker daemon. Up to
+	// ContainerCreateBurst containers may still be created back to back. 0 disables it.
+	ContainerCreateRate  float64
+	ContainerCreateBurst int
+
+	// ReaperInterval is how often containers orphaned by crashed runs are looked for,
+	// by label, and removed once older than their expected lifetime. Zero disables it.
+	ReaperInterval time.Duration
+
+	// KeepaliveHeadroom is how much longer than its run's time limit (and grace
+	// period) a container is kept alive, to cover the compile step and collecting the
+	// results. The container stops by itself after that, even if orphaned.
+	KeepaliveHeadroom time.Duration
+
+	// WarmUpImages pulls every language image at startup, after a random delay below
+	// WarmUpJitter so that replicas deployed together do not all pull at once.
+	WarmUpImages bool
+	WarmUpJitter time.Duration
+
+	// SeparateCompile compiles in a throwaway container and copies only the compiled
+	// artifact into a fresh run container, which never sees the source or compiler
+	// and runs the language's RuntimeImage when it has one.
+	SeparateCompile bool
+
+	// CompileMemoryBytes is the memory limit the compiler runs under, so that
+	// adversarial code cannot take the host down at compile time. A compiler that runs
+	// out of memory yields COMPILATION_ERROR. Zero compiles under the run's own limit.
+	CompileMemoryBytes int64
+
+	// SyntaxCheck checks the source of interpreted languages (LanguageConfig.SyntaxCheckCmd)
+	// before running it, so that a syntax error is a COMPILATION_ERROR with the
+	// diagnostics rather than a RUNTIME_ERROR.
+	SyntaxCheck bool
+}
+
+// DefaultConfig returns the settings used when Configure is never called.
+func DefaultConfig() Config {
+	return Config{
+		UnbufferedOutput:      false,
+		ScratchDir:            "",
+		ScratchMaxAge:         time.Hour,
+		CompileWarnings:       false,
+		ContainerCPUs:         0,
+		CPUBudget:             0,
+		MemoryBudgetBytes:     0,
+		TLEGracePeriod:        0,
+		IsolateMounts:         false,
+		StdinMode:             StdinFile,
+		KillTimeout:           5 * time.Second,
+		Debug:                 false,
+		ReuseContainers:       false,
+		WarmContainerLifetime: time.Hour,
+		Runtime:               "",
+		OutputGracePeriod:     2 * time.Second,
+		ContainerCreateRate:   0,
+		ContainerCreateBurst:  1,
+		ReaperInterval:        0,
+		KeepaliveHeadroom:     2 * time.Minute,
+		WarmUpImages:          false,
+		WarmUpJitter:          0,
+		SeparateCompile:       false,
+		CompileMemoryBytes:    0,
+		SyntaxCheck:           false,
+	}
+}
+
+var (
+	cfg       = DefaultConfig()
+	budget    = newCPUBudget(0)
+	memory    = newCPUBudget(0)
+	slots     = newLanguageSlots(nil)
+	creations = newCreationLimiter(0, 0)
+)
+
+// Configure replaces the executor-wide container settings. It must be called
+// before any submission is executed.
+func Configure(c Config) {
+	cfg = c
+	budget = newCPUBudget(toNanoCPUs(c.CPUBudget))
+	memory = newCPUBudget(c.MemoryBudgetBytes)
+	slots = newLanguageSlots(c.LanguageConcurrency)
+	creations = newCreationLimiter(c.ContainerCreateRate, c.ContainerCreateBurst)
+}
@@ -0,0 +1,97 @@
+package docker
+
+import "sync"
+
+// cpuBudget is a counting semaphore over CPU capacity, measured in nano CPUs (the unit
+// of container.Resources.NanoCPUs). It keeps the summed CPU allocation of all running
+// containers within the executor-wide budget; runs that do not fit wait for capacity,
+// which in turn holds back the worker that dispatched them. The memory budget is the
+// same semaphore, counting bytes.
+type cpuBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	total int64 // 0 means unlimited
+	inUse int64
+}
+
+func newCPUBudget(totalNanoCPUs int64) *cpuBudget {
+	b := &cpuBudget{total: totalNanoCPUs}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n nano CPUs are free and reserves them.
+func (b *cpuBudget) acquire(n int64) {
+	if b.total == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.inUse+n > b.total {
+		b.cond.Wait()
+	}
+	b.inUse += n
+}
+
+// release returns n nano CPUs reserved by acquire.
+func (b *cpuBudget) release(n int64) {
+	if b.total == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.inUse -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// containerNanoCPUs returns the CPU allocation given to a container that asked for cpus
+// cores, or ContainerCPUs when it asked for none. With a budget but no explicit limit
+// every container gets one core, and no container is ever allocated more than the
+// whole budget, so a run can always eventually start.
+func containerNanoCPUs(cpus float64) int64 {
+	if cpus <= 0 {
+		cpus = cfg.ContainerCPUs
+	}
+	n := toNanoCPUs(cpus)
+	budget := toNanoCPUs(cfg.CPUBudget)
+	if budget > 0 {
+		if n == 0 {
+			n = toNanoCPUs(1)
+		}
+		if n > budget {
+			n = budget
+		}
+	}
+	return n
+}
+
+func toNanoCPUs(cpus float64) int64 {
+	return int64(cpus * 1e9)
+}
+
+// memoryReservation returns how much of the memory budget a run with the given memory
+// limit holds: its larger limit of the run and the compile, but never more than the
+// whole budget, so a run can always eventually start.
+func memoryReservation(memoryLimitBytes int64) int64 {
+	n := memoryLimitBytes
+	if compile := compileMemoryBytes(memoryLimitBytes); compile > n {
+		n = compile
+	}
+	if cfg.MemoryBudgetBytes > 0 && n > cfg.MemoryBudgetBytes {
+		n = cfg.MemoryBudgetBytes
+	}
+	return n
+}
+
+// MemorySlots returns how many runs with the given memory limit fit in the memory
+// budget at once (at least one), or 0 when there is no budget.
+func MemorySlots(memoryLimitBytes int64) int {
+	if cfg.MemoryBudgetBytes <= 0 {
+		return 0
+	}
+	reservation := memoryReservation(memoryLimitBytes)
+	if reservation <= 0 {
+		return 0
+	}
+	return int(cfg.MemoryBudgetBytes / reservation)
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCPUBudgetLimitsConcurrentAllocation(t *testing.T) {
+	const core = int64(1e9)
+	b := newCPUBudget(2 * core)
+
+	var mu sync.Mutex
+	var inUse, peak int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.acquire(core)
+			mu.Lock()
+			inUse += core
+			if inUse > peak {
+				peak = inUse
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inUse -= core
+			mu.Unlock()
+			b.release(core)
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2*core {
+		t.Errorf("peak allocation = %d nano CPUs, want at most the budget of %d", peak, 2*core)
+	}
+	if peak < 2*core {
+		t.Errorf("peak allocation = %d nano CPUs, want the budget of %d to be used in full", peak, 2*core)
+	}
+}
+
+func TestCPUBudgetUnlimited(t *testing.T) {
+	b := newCPUBudget(0)
+	for i := 0; i < 100; i++ {
+		b.acquire(int64(1e9))
+	}
+}
+
+func TestContainerNanoCPUs(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name          string
+		containerCPUs float64
+		cpuBudget     float64
+		requested     float64
+		want          int64
+	}{
+		{"no limits", 0, 0, 0, 0},
+		{"per-container limit only", 1.5, 0, 0, 1500000000},
+		{"budget defaults to one core", 0, 4, 0, 1000000000},
+		{"clamped to budget", 8, 2, 0, 2000000000},
+		{"requested overrides the per-container limit", 1.5, 0, 0.5, 500000000},
+		{"requested clamped to budget", 1, 2, 3, 2000000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(Config{ContainerCPUs: tt.containerCPUs, CPUBudget: tt.cpuBudget})
+			if got := containerNanoCPUs(tt.requested); got != tt.want {
+				t.Errorf("containerNanoCPUs(%v) = %d, want %d", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemorySlots(t *testing.T) {
+	defer Configure(DefaultConfig())
+	const mb = int64(1024 * 1024)
+
+	tests := []struct {
+		name          string
+		budget        int64
+		compileMemory int64
+		memoryLimit   int64
+		want          int
+	}{
+		{"no budget", 0, 0, 512 * mb, 0},
+		{"fits twice", 1024 * mb, 0, 512 * mb, 2},
+		{"rounds down", 1024 * mb, 0, 300 * mb, 3},
+		{"larger than the budget still runs", 1024 * mb, 0, 2048 * mb, 1},
+		{"compile limit counts when larger", 1024 * mb, 512 * mb, 256 * mb, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(Config{MemoryBudgetBytes: tt.budget, CompileMemoryBytes: tt.compileMemory})
+			if got := MemorySlots(tt.memoryLimit); got != tt.want {
+				t.Errorf("MemorySlots(%d) = %d, want %d", tt.memoryLimit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// execInspector is the part of the Docker client used to wait for an exec to exit.
+type execInspector interface {
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+}
+
+// execPollInterval is how often a finished exec is checked for having been reaped.
+const execPollInterval = 5 * time.Millisecond
+
+// waitForExecExit waits up to grace for an exec whose attach stream has ended to be
+// reported as exited. The stream can close while the shell running the program is
+// still being torn down, and only once the exec has exited are its redirections
+// closed and the output files complete. It returns the last inspection and whether
+// the exec had exited by then.
+func waitForExecExit(ctx context.Context, cli execInspector, execID string, grace time.Duration) (types.ContainerExecInspect, bool, error) {
+	deadline := time.Now().Add(grace)
+	for {
+		inspect, err := cli.ContainerExecInspect(ctx, execID)
+		if err != nil {
+			return inspect, false, err
+		}
+		if !inspect.Running {
+			return inspect, true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return inspect, false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return inspect, false, ctx.Err()
+		case <-time.After(execPollInterval):
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// reapingExec is an execInspector whose exec is reported running for the first
+// runningFor inspections, like a shell still being torn down after its stream closed.
+type reapingExec struct {
+	runningFor  int
+	inspections int
+}
+
+func (e *reapingExec) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	e.inspections++
+	return types.ContainerExecInspect{Running: e.inspections <= e.runningFor, ExitCode: 3}, nil
+}
+
+func TestWaitForExecExit(t *testing.T) {
+	exec := &reapingExec{runningFor: 3}
+	inspect, exited, err := waitForExecExit(context.Background(), exec, "exec", time.Second)
+	if err != nil || !exited {
+		t.Fatalf("waitForExecExit() = exited %v, %v, want exited", exited, err)
+	}
+	if inspect.ExitCode != 3 || exec.inspections != 4 {
+		t.Errorf("exit code %d after %d inspections, want 3 after 4", inspect.ExitCode, exec.inspections)
+	}
+}
+
+func TestWaitForExecExitGivesUpAfterGrace(t *testing.T) {
+	exec := &reapingExec{runningFor: 1 << 30}
+	start := time.Now()
+	_, exited, err := waitForExecExit(context.Background(), exec, "exec", 50*time.Millisecond)
+	if err != nil || exited {
+		t.Fatalf("waitForExecExit() = exited %v, %v, want not exited", exited, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("gave up after %v, want about the 50ms grace", elapsed)
+	}
+}
@@ -0,0 +1,28 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pythonFunctionHarness is the FunctionHarness of PYTHON.
+const pythonFunctionHarness = `{{code}}
+
+if __name__ == "__main__":
+    import json as _json, sys as _sys
+    _result = {{function}}(*_json.loads(_sys.stdin.read()))
+    print(_result if isinstance(_result, str) else _json.dumps(_result))
+`
+
+// wrapFunction turns the code of a function-mode submission into a full program using
+// the language's FunctionHarness. The Python harness reads the input as a JSON array
+// of arguments, calls the function with them, and prints the return value: a string
+// as is, anything else as JSON (so True prints as true). The code comes first so that
+// line numbers in error messages match the submission's.
+func wrapFunction(language string, config LanguageConfig, code, function string) (string, error) {
+	if config.FunctionHarness == "" {
+		return "", fmt.Errorf("function mode is not supported for %s", language)
+	}
+	replacer := strings.NewReplacer("{{code}}", code, "{{function}}", function)
+	return replacer.Replace(config.FunctionHarness), nil
+}
@@ -0,0 +1,24 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapFunction(t *testing.T) {
+	code := "def solve(a, b):\n    return a + b  # not {{function}}\n"
+	program, err := wrapFunction("PYTHON", langConfigs["PYTHON"], code, "solve")
+	if err != nil {
+		t.Fatalf("wrapFunction failed: %v", err)
+	}
+	if !strings.HasPrefix(program, code) {
+		t.Errorf("program = %q, want it to start with the unchanged code", program)
+	}
+	if !strings.Contains(program, "_result = solve(*_json.loads(_sys.stdin.read()))") {
+		t.Errorf("program = %q, want it to call solve with the input arguments", program)
+	}
+
+	if _, err := wrapFunction("CPP", langConfigs["CPP"], "int solve() { return 1; }", "solve"); err == nil || !strings.Contains(err.Error(), "not supported for CPP") {
+		t.Errorf("wrapFunction(CPP) error = %v, want function mode unsupported", err)
+	}
+}
@@ -0,0 +1,845 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// requireDocker skips integration tests in short mode or when no Docker daemon is reachable.
+func requireDocker(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping Docker integration test in short mode")
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Skipf("Docker client unavailable: %v", err)
+	}
+	defer cli.Close()
+	if _, err := cli.Ping(context.Background()); err != nil {
+		t.Skipf("Docker daemon unavailable: %v", err)
+	}
+}
+
+func TestIntegrationUnflushedOutputIsCapturedOnNormalExit(t *testing.T) {
+	requireDocker(t)
+
+	// exit() flushes stdio buffers, so output without a trailing newline or fflush is kept.
+	code := `#include <cstdio>
+int main() {
+    printf("no newline, no flush");
+    return 0;
+}`
+	result, err := RunInContainer("CPP", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" {
+		t.Fatalf("Status = %s, want ACCEPTED (output: %q)", result.Status, result.Output)
+	}
+	if result.Output != "no newline, no flush" {
+		t.Errorf("Output = %q, want %q", result.Output, "no newline, no flush")
+	}
+}
+
+func TestIntegrationUnflushedOutputOnAbnormalExit(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	// abort() skips the stdio flush, so the data only survives when buffering is disabled.
+	code := `#include <cstdio>
+#include <cstdlib>
+int main() {
+    printf("written before abort");
+    abort();
+}`
+
+	Configure(Config{UnbufferedOutput: true})
+	result, err := RunInContainer("CPP", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "RUNTIME_ERROR" {
+		t.Fatalf("Status = %s, want RUNTIME_ERROR", result.Status)
+	}
+	if result.Output != "written before abort" {
+		t.Errorf("Output = %q, want %q", result.Output, "written before abort")
+	}
+
+	Configure(Config{UnbufferedOutput: false})
+	result, err = RunInContainer("CPP", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "RUNTIME_ERROR" {
+		t.Fatalf("Status = %s, want RUNTIME_ERROR", result.Status)
+	}
+	if result.Output != "" {
+		t.Errorf("Output = %q, want empty output when buffered data is discarded by abort", result.Output)
+	}
+}
+
+func TestIntegrationInvalidUTF8OutputIsPreserved(t *testing.T) {
+	requireDocker(t)
+
+	code := `#include <cstdio>
+int main() {
+    const unsigned char raw[] = {'o', 'k', ' ', 0xff, 0xfe, 0xc3};
+    fwrite(raw, 1, sizeof(raw), stdout);
+    return 0;
+}`
+	result, err := RunInContainer("CPP", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" {
+		t.Fatalf("Status = %s, want ACCEPTED (output: %q)", result.Status, result.Output)
+	}
+	if result.Output != "ok \xff\xfe\xc3" {
+		t.Errorf("Output = %q, want the raw bytes %q", result.Output, "ok \xff\xfe\xc3")
+	}
+}
+
+func TestIntegrationThreadLimit(t *testing.T) {
+	requireDocker(t)
+
+	// Four worker threads stay alive long enough for the monitor to sample them.
+	code := `#include <chrono>
+#include <iostream>
+#include <thread>
+#include <vector>
+int main() {
+    std::vector<std::thread> threads;
+    for (int i = 0; i < 4; i++) {
+        threads.emplace_back([] { std::this_thread::sleep_for(std::chrono::milliseconds(1500)); });
+    }
+    for (auto& t : threads) t.join();
+    std::cout << "done" << std::endl;
+    return 0;
+}`
+	request := RunRequest{
+		Language:         "CPP",
+		Code:             code,
+		TimeLimitSeconds: 5.0,
+		MemoryLimitBytes: 256 * 1024 * 1024,
+	}
+
+	request.MaxThreads = 1
+	result, err := Run(request)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Status != "RESOURCE_LIMIT" {
+		t.Errorf("Status with MaxThreads=1 = %s, want RESOURCE_LIMIT (threads: %d)", result.Status, result.Threads)
+	}
+
+	request.MaxThreads = 16
+	result, err = Run(request)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.Output != "done" {
+		t.Errorf("Status with MaxThreads=16 = %s (output %q), want ACCEPTED with output done", result.Status, result.Output)
+	}
+	if result.Threads < 5 {
+		t.Errorf("Threads = %d, want at least 5 (main thread plus four workers)", result.Threads)
+	}
+}
+
+func TestIntegrationCompileWarningsAreReported(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	code := `#include <iostream>
+int main() {
+    int unused;
+    std::cout << "ok" << std::endl;
+    return 0;
+}`
+	config := DefaultConfig()
+	config.CompileWarnings = true
+	Configure(config)
+
+	result, err := RunInContainer("CPP", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.Output != "ok" {
+		t.Fatalf("Status = %s, Output = %q, want ACCEPTED with ok", result.Status, result.Output)
+	}
+	if !strings.Contains(result.CompileOutput, "unused variable") {
+		t.Errorf("CompileOutput = %q, want an unused variable warning", result.CompileOutput)
+	}
+}
+
+func TestIntegrationCompileMillis(t *testing.T) {
+	requireDocker(t)
+
+	result, err := RunInContainer("CPP", "#include <iostream>\nint main() { std::cout << \"ok\"; }", "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.CompileMillis <= 0 {
+		t.Errorf("CPP: Status = %s, CompileMillis = %d, want ACCEPTED with a positive compile time", result.Status, result.CompileMillis)
+	}
+
+	result, err = RunInContainer("PYTHON", "print('ok')", "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.CompileMillis != 0 {
+		t.Errorf("PYTHON: Status = %s, CompileMillis = %d, want ACCEPTED with no compile time", result.Status, result.CompileMillis)
+	}
+
+	defer Configure(DefaultConfig())
+	config := DefaultConfig()
+	config.SyntaxCheck = true
+	Configure(config)
+	result, err = RunInContainer("PYTHON", "print('ok'", "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "COMPILATION_ERROR" || result.CompileMillis != 0 {
+		t.Errorf("PYTHON syntax error: Status = %s, CompileMillis = %d, want COMPILATION_ERROR with no compile time", result.Status, result.CompileMillis)
+	}
+}
+
+func TestIntegrationDebugBuildBacktrace(t *testing.T) {
+	requireDocker(t)
+
+	programs := map[string]string{
+		"CPP": "int main() {\n    int *p = nullptr;\n    *p = 1;\n    return 0;\n}\n",
+		"C":   "int main() {\n    int *p = 0;\n    *p = 1;\n    return 0;\n}\n",
+	}
+	for language, code := range programs {
+		line := langConfigs[language].SourceFile + ":3"
+		for _, debug := range []bool{true, false} {
+			result, err := Run(RunRequest{
+				SubmissionID:     1,
+				Language:         language,
+				Code:             code,
+				TimeLimitSeconds: 10,
+				MemoryLimitBytes: 128 * 1024 * 1024, // Scaled up for the sanitizer
+				DebugBuild:       debug,
+			})
+			if err != nil {
+				t.Fatalf("%s: Run(DebugBuild: %v) failed: %v", language, debug, err)
+			}
+			if result.Status != "RUNTIME_ERROR" {
+				t.Errorf("%s DebugBuild %v: Status = %s, want RUNTIME_ERROR", language, debug, result.Status)
+			}
+			if hasLine := strings.Contains(result.Output, line); hasLine != debug {
+				t.Errorf("%s DebugBuild %v: output %q, want a backtrace naming %s only in a debug build", language, debug, result.Output, line)
+			}
+		}
+	}
+}
+
+func TestIntegrationTimeLimitKillTiming(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	config := DefaultConfig()
+	config.TLEGracePeriod = 500 * time.Millisecond
+	Configure(config)
+
+	// Finishes inside the grace period: a TLE, but not killed.
+	result, err := RunInContainerWithLimits(0, "PYTHON", "import time\ntime.sleep(1.2)\nprint('late')", "", 1.0, 64*1024*1024)
+	if err != nil {
+		t.Fatalf("RunInContainerWithLimits failed: %v", err)
+	}
+	if result.Status != "TIME_LIMIT_EXCEEDED" || !result.Overran || result.KilledAtMillis != 0 {
+		t.Errorf("near miss = %s, overran %v, killed at %dms, want an unkilled TLE", result.Status, result.Overran, result.KilledAtMillis)
+	}
+	if result.OverrunMillis <= 0 || result.OverrunMillis >= 500 {
+		t.Errorf("near miss overrun = %dms, want within the 500ms grace period", result.OverrunMillis)
+	}
+
+	// Runs forever: killed once the grace period is used up.
+	result, err = RunInContainerWithLimits(0, "PYTHON", "while True:\n    pass", "", 1.0, 64*1024*1024)
+	if err != nil {
+		t.Fatalf("RunInContainerWithLimits failed: %v", err)
+	}
+	if result.Status != "TIME_LIMIT_EXCEEDED" || !result.Overran {
+		t.Errorf("runaway = %s, overran %v, want an overrunning TLE", result.Status, result.Overran)
+	}
+	if result.KilledAtMillis < 1500 || result.OverrunMillis < 500 {
+		t.Errorf("runaway killed at %dms with overrun %dms, want at least 1500ms and 500ms", result.KilledAtMillis, result.OverrunMillis)
+	}
+}
+
+func TestIntegrationIsolatedMountsHideHostPaths(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	config := DefaultConfig()
+	config.IsolateMounts = true
+	Configure(config)
+
+	code := `try:
+    with open('/etc/shadow') as f:
+        print('shadow:' + f.read())
+except OSError as e:
+    print('denied')
+with open('/app/main.py') as f:
+    print('app readable' if f.read() else 'app empty')`
+	result, err := RunInContainer("PYTHON", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" {
+		t.Fatalf("Status = %s, want ACCEPTED (output: %q)", result.Status, result.Output)
+	}
+	if strings.Contains(result.Output, "root:") {
+		t.Errorf("Output = %q, the submission could read /etc/shadow", result.Output)
+	}
+	if !strings.Contains(result.Output, "app readable") {
+		t.Errorf("Output = %q, want the submission to still see /app", result.Output)
+	}
+}
+
+func TestIntegrationStdinFileMatchesPipe(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	code := `import sys
+data = sys.stdin.read()
+print(len(data), sum(int(x) for x in data.split()))`
+	inputs := map[string]string{
+		"empty": "",
+		"small": "1 2 3\n",
+		"large": strings.Repeat("12345 67890\n", 200000), // well past a pipe buffer
+	}
+
+	for name, input := range inputs {
+		var results [2]*ExecutionResult
+		for i, mode := range []string{StdinPipe, StdinFile} {
+			config := DefaultConfig()
+			config.StdinMode = mode
+			Configure(config)
+
+			result, err := RunInContainerWithLimits(0, "PYTHON", code, input, 10.0, 256*1024*1024)
+			if err != nil {
+				t.Fatalf("%s input in %s mode: RunInContainerWithLimits failed: %v", name, mode, err)
+			}
+			results[i] = result
+		}
+		pipe, file := results[0], results[1]
+		if pipe.Status != "ACCEPTED" || file.Status != pipe.Status || file.Output != pipe.Output {
+			t.Errorf("%s input: pipe = %s %q, file = %s %q, want matching ACCEPTED results",
+				name, pipe.Status, pipe.Output, file.Status, file.Output)
+		}
+	}
+}
+
+func TestIntegrationMissingBinaryIsCompilationError(t *testing.T) {
+	requireDocker(t)
+
+	result, err := Run(RunRequest{
+		Language:         "CPP",
+		Code:             `int main() { return 0; }`,
+		TimeLimitSeconds: 2.0,
+		MemoryLimitBytes: 256 * 1024 * 1024,
+		// Compiles cleanly, but to a name the execute command does not run.
+		configure: func(config *LanguageConfig) {
+			config.CompileCmd = []string{"g++", "main.cpp", "-o", "program"}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Status != "COMPILATION_ERROR" {
+		t.Fatalf("Status = %s, want COMPILATION_ERROR (output: %q)", result.Status, result.Output)
+	}
+	if !strings.Contains(result.Output, "binary not produced") || !strings.Contains(result.Output, "/app/main") {
+		t.Errorf("Output = %q, want a binary not produced message naming /app/main", result.Output)
+	}
+}
+
+func TestIntegrationReusedContainerIsolatesSubmissions(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+	defer RemoveWarmContainers()
+
+	config := DefaultConfig()
+	config.ReuseContainers = true
+	Configure(config)
+
+	// The first tenant leaves files behind and a process running in the background.
+	first := `import os, socket, subprocess
+open('/app/secret.txt', 'w').write('first')
+open('/tmp/secret.txt', 'w').write('first')
+subprocess.Popen(['sleep', '1000'])
+print(socket.gethostname())`
+	// The second must get the same container, with none of that left.
+	second := `import os, socket
+print(socket.gethostname())
+print(sorted(os.listdir('/app')))
+print(os.listdir('/tmp'))
+print(any(open('/proc/%s/cmdline' % p).read().startswith('sleep\x001000') for p in os.listdir('/proc') if p.isdigit()))`
+
+	firstResult, err := RunInContainer("PYTHON", first, "")
+	if err != nil {
+		t.Fatalf("first RunInContainer failed: %v", err)
+	}
+	secondResult, err := RunInContainer("PYTHON", second, "")
+	if err != nil {
+		t.Fatalf("second RunInContainer failed: %v", err)
+	}
+	if firstResult.Status != "ACCEPTED" || secondResult.Status != "ACCEPTED" {
+		t.Fatalf("statuses = %s, %s, want ACCEPTED (outputs: %q, %q)", firstResult.Status, secondResult.Status, firstResult.Output, secondResult.Output)
+	}
+
+	lines := strings.Split(secondResult.Output, "\n")
+	if len(lines) != 4 {
+		t.Fatalf("second output = %q, want 4 lines", secondResult.Output)
+	}
+	if lines[0] != firstResult.Output {
+		t.Errorf("second ran in container %s, want the reused %s", lines[0], firstResult.Output)
+	}
+	if lines[1] != "['input.txt', 'main.py']" {
+		t.Errorf("/app = %s, want only the second submission's files", lines[1])
+	}
+	if lines[2] != "[]" {
+		t.Errorf("/tmp = %s, want it empty", lines[2])
+	}
+	if lines[3] != "False" {
+		t.Error("the first submission's background process survived into the second")
+	}
+}
+
+func TestIntegrationReusedContainerRefusedAfterImageChange(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+	defer RemoveWarmContainers()
+
+	config := DefaultConfig()
+	config.ReuseContainers = true
+	Configure(config)
+
+	// The first tenant plants a file outside the locations the reset wipes.
+	first := `import socket
+open('/root/planted.txt', 'w').write('first')
+print(socket.gethostname())`
+	second := `import os, socket
+print(socket.gethostname())
+print(os.path.exists('/root/planted.txt'))`
+
+	firstResult, err := RunInContainer("PYTHON", first, "")
+	if err != nil {
+		t.Fatalf("first RunInContainer failed: %v", err)
+	}
+	secondResult, err := RunInContainer("PYTHON", second, "")
+	if err != nil {
+		t.Fatalf("second RunInContainer failed: %v", err)
+	}
+	if firstResult.Status != "ACCEPTED" || secondResult.Status != "ACCEPTED" {
+		t.Fatalf("statuses = %s, %s, want ACCEPTED (outputs: %q, %q)", firstResult.Status, secondResult.Status, firstResult.Output, secondResult.Output)
+	}
+
+	lines := strings.Split(secondResult.Output, "\n")
+	if len(lines) != 2 {
+		t.Fatalf("second output = %q, want 2 lines", secondResult.Output)
+	}
+	if lines[0] == firstResult.Output {
+		t.Error("the container changed outside the reset locations was reused")
+	}
+	if lines[1] != "False" {
+		t.Error("the first submission's planted file reached the second")
+	}
+}
+
+func TestIntegrationOutputLineLimit(t *testing.T) {
+	requireDocker(t)
+
+	request := RunRequest{
+		Language:         "PYTHON",
+		Code:             "i = 0\nwhile True:\n    print(i)\n    i += 1",
+		TimeLimitSeconds: 10.0,
+		MemoryLimitBytes: 64 * 1024 * 1024,
+		MaxOutputLines:   1000,
+	}
+	result, err := Run(request)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Status != "OUTPUT_LIMIT_EXCEEDED" {
+		t.Fatalf("Status = %s, want OUTPUT_LIMIT_EXCEEDED (output: %q)", result.Status, result.Output)
+	}
+	if result.TimeMillis > 2000 {
+		t.Errorf("TimeMillis = %d, want the program stopped promptly rather than at the 10s limit", result.TimeMillis)
+	}
+
+	// Exactly at the limit is fine, and a crash still reports its exit status.
+	request.Code = "for i in range(1000):\n    print(i)"
+	if result, err = Run(request); err != nil || result.Status != "ACCEPTED" {
+		t.Errorf("1000 lines = %+v, %v, want ACCEPTED", result, err)
+	}
+	request.Code = "print(1)\nraise SystemExit(3)"
+	if result, err = Run(request); err != nil || result.Status != "RUNTIME_ERROR" {
+		t.Errorf("crash = %+v, %v, want RUNTIME_ERROR", result, err)
+	}
+
+	// The program cannot report a clean exit status for itself.
+	request.Code = `import os
+try:
+    os.write(3, b"0\n")
+except OSError:
+    pass
+open("/app/exit_status.txt", "w").write("0")
+raise SystemExit(3)`
+	if result, err = Run(request); err != nil || result.Status != "RUNTIME_ERROR" {
+		t.Errorf("forged exit status = %+v, %v, want RUNTIME_ERROR", result, err)
+	}
+}
+
+func TestIntegrationGVisorRuntime(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatalf("Docker client unavailable: %v", err)
+	}
+	defer cli.Close()
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		t.Fatalf("Info failed: %v", err)
+	}
+	if _, ok := info.Runtimes["runsc"]; !ok {
+		t.Skip("runsc runtime is not registered with the Docker daemon")
+	}
+
+	config := DefaultConfig()
+	config.Runtime = "runsc"
+	Configure(config)
+
+	// gVisor's kernel announces itself in the kernel log.
+	code := `import subprocess
+print('gVisor' in subprocess.run(['dmesg'], capture_output=True, text=True).stdout)`
+	result, err := RunInContainer("PYTHON", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.Output != "True" {
+		t.Errorf("Status = %s, Output = %q, want ACCEPTED under gVisor", result.Status, result.Output)
+	}
+}
+
+func TestIntegrationDiskUsage(t *testing.T) {
+	requireDocker(t)
+
+	code := `with open('/app/data.bin', 'wb') as f:
+    f.write(b'x' * 4 * 1024 * 1024)
+print('done')`
+	result, err := RunInContainer("PYTHON", code, "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" {
+		t.Fatalf("Status = %s, want ACCEPTED (output: %q)", result.Status, result.Output)
+	}
+	// The 4MB file plus the source and a few bytes of output.
+	if result.DiskKB < 4096 || result.DiskKB > 4096+64 {
+		t.Errorf("DiskKB = %d, want about 4096", result.DiskKB)
+	}
+}
+
+func TestIntegrationDebugTimeline(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	code := `import sys, time
+print('first', flush=True)
+time.sleep(0.3)
+print('oops', file=sys.stderr, flush=True)
+print('second', flush=True)`
+	for _, debug := range []bool{false, true} {
+		config := DefaultConfig()
+		config.Debug = debug
+		Configure(config)
+
+		result, err := RunInContainer("PYTHON", code, "")
+		if err != nil {
+			t.Fatalf("debug %v: RunInContainer failed: %v", debug, err)
+		}
+		if result.Status != "ACCEPTED" || result.Output != "first\nsecond" {
+			t.Fatalf("debug %v: Status = %s with output %q, want ACCEPTED with both lines", debug, result.Status, result.Output)
+		}
+		if !debug {
+			if result.Timeline != "" {
+				t.Errorf("Timeline = %q outside debug mode, want none", result.Timeline)
+			}
+			continue
+		}
+		lines := strings.Split(strings.TrimSpace(result.Timeline), "\n")
+		if len(lines) != 3 || !strings.HasSuffix(lines[0], "stdout: first") ||
+			!strings.HasSuffix(lines[1], "stderr: oops") || !strings.HasSuffix(lines[2], "stdout: second") {
+			t.Errorf("Timeline = %q, want first, oops and second in order", result.Timeline)
+		}
+	}
+}
+
+func TestIntegrationFastProgramOutputIsNeverEmpty(t *testing.T) {
+	requireDocker(t)
+
+	for i := 0; i < 30; i++ {
+		result, err := RunInContainer("PYTHON", "print('ok')", "")
+		if err != nil {
+			t.Fatalf("run %d: RunInContainer failed: %v", i, err)
+		}
+		if result.Status != "ACCEPTED" || result.Output != "ok" {
+			t.Fatalf("run %d: Status = %s with output %q, want ACCEPTED with ok", i, result.Status, result.Output)
+		}
+	}
+}
+
+func TestIntegrationPageCacheIsNotChargedAsMemory(t *testing.T) {
+	requireDocker(t)
+
+	// Writing and re-reading 256MB fills the page cache far past the 64MB limit while
+	// the program itself only ever holds 1MB.
+	code := `chunk = b'x' * (1024 * 1024)
+with open('/app/data.bin', 'wb') as f:
+    for _ in range(256):
+        f.write(chunk)
+total = 0
+with open('/app/data.bin', 'rb') as f:
+    while True:
+        block = f.read(1024 * 1024)
+        if not block:
+            break
+        total += len(block)
+print(total)`
+	result, err := RunInContainerWithLimits(1, "PYTHON", code, "", 30, 64*1024*1024)
+	if err != nil {
+		t.Fatalf("RunInContainerWithLimits failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.Output != "268435456" {
+		t.Fatalf("Status = %s with output %q, want ACCEPTED with 268435456", result.Status, result.Output)
+	}
+	if result.MemoryKB > 48*1024 {
+		t.Errorf("MemoryKB = %d, want the program's own memory, well under the 64MB limit", result.MemoryKB)
+	}
+}
+
+func TestIntegrationIgnoreExitCode(t *testing.T) {
+	requireDocker(t)
+
+	code := `import sys
+print(42)
+sys.exit(3)`
+	for _, ignore := range []bool{false, true} {
+		result, err := Run(RunRequest{
+			SubmissionID:     1,
+			Language:         "PYTHON",
+			Code:             code,
+			TimeLimitSeconds: 5,
+			MemoryLimitBytes: 64 * 1024 * 1024,
+			IgnoreExitCode:   ignore,
+		})
+		if err != nil {
+			t.Fatalf("ignore %v: Run failed: %v", ignore, err)
+		}
+		want := "RUNTIME_ERROR"
+		if ignore {
+			want = "ACCEPTED"
+		}
+		if result.Status != want || result.Output != "42" || result.ExitCode != 3 {
+			t.Errorf("ignore %v: Status = %s with output %q and exit code %d, want %s with 42 and 3",
+				ignore, result.Status, result.Output, result.ExitCode, want)
+		}
+	}
+}
+
+func TestIntegrationSeparateCompileHidesSource(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	config := DefaultConfig()
+	config.SeparateCompile = true
+	Configure(config)
+
+	tests := []struct {
+		language string
+		code     string
+	}{
+		{"CPP", `#include <fstream>
+#include <iostream>
+int main() {
+    std::cout << (std::ifstream("main.cpp").good() ? "source" : "no source") << std::endl;
+    return 0;
+}`},
+		{"JAVA", `public class Main {
+    public static void main(String[] args) {
+        System.out.println(new java.io.File("Main.java").exists() ? "source" : "no source");
+    }
+}`},
+	}
+	for _, tt := range tests {
+		result, err := RunInContainer(tt.language, tt.code, "")
+		if err != nil {
+			t.Fatalf("%s: RunInContainer failed: %v", tt.language, err)
+		}
+		if result.Status != "ACCEPTED" || result.Output != "no source" {
+			t.Errorf("%s: Status = %s, Output = %q, want ACCEPTED with no source", tt.language, result.Status, result.Output)
+		}
+	}
+
+	result, err := RunInContainer("CPP", "int main() { return missing; }", "")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "COMPILATION_ERROR" {
+		t.Errorf("Status = %s, want COMPILATION_ERROR", result.Status)
+	}
+}
+
+func TestIntegrationCompilerOutOfMemory(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	// Each level multiplies the preprocessed token count by ten
+	code := `#define A(x) x x x x x x x x x x
+#define B(x) A(A(A(x)))
+#define C(x) B(B(B(x)))
+int main() { return C(1 +) 1; }`
+	config := DefaultConfig()
+	config.CompileMemoryBytes = 128 * 1024 * 1024
+	for _, separate := range []bool{false, true} {
+		config.SeparateCompile = separate
+		Configure(config)
+
+		result, err := RunInContainer("CPP", code, "")
+		if err != nil {
+			t.Fatalf("separate %v: RunInContainer failed: %v", separate, err)
+		}
+		if result.Status != "COMPILATION_ERROR" || result.Output != compilerOOMMessage {
+			t.Errorf("separate %v: Status = %s, Output = %q, want COMPILATION_ERROR with %q",
+				separate, result.Status, result.Output, compilerOOMMessage)
+		}
+	}
+}
+
+func TestIntegrationSyntaxCheck(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+
+	config := DefaultConfig()
+	config.SyntaxCheck = true
+	Configure(config)
+
+	result, err := RunInContainer("PYTHON", "print('never runs')\nprint(input(", "1")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "COMPILATION_ERROR" || !strings.Contains(result.Output, "SyntaxError") || strings.Contains(result.Output, "never runs") {
+		t.Errorf("Status = %s, Output = %q, want COMPILATION_ERROR with the SyntaxError only", result.Status, result.Output)
+	}
+
+	result, err = RunInContainer("PYTHON", "print(input())", "1")
+	if err != nil {
+		t.Fatalf("RunInContainer failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.Output != "1" {
+		t.Errorf("Status = %s, Output = %q, want ACCEPTED with 1", result.Status, result.Output)
+	}
+}
+
+func TestIntegrationFunctionMode(t *testing.T) {
+	requireDocker(t)
+
+	tests := []struct {
+		code  string
+		input string
+		want  string
+	}{
+		{"def solve(a, b):\n    return a + b\n", "[2, 3]", "5"},
+		{"def solve(a, b):\n    return [a, b] if a < b else a > b\n", "[3, 2]", "true"},
+		{"def solve(name):\n    return 'hello ' + name\n", `["judge"]`, "hello judge"},
+	}
+	for _, tt := range tests {
+		result, err := Run(RunRequest{
+			SubmissionID:     1,
+			Language:         "PYTHON",
+			Code:             tt.code,
+			Input:            tt.input,
+			TimeLimitSeconds: 5,
+			MemoryLimitBytes: 64 * 1024 * 1024,
+			Function:         "solve",
+		})
+		if err != nil {
+			t.Fatalf("Run(%q) failed: %v", tt.input, err)
+		}
+		if result.Status != "ACCEPTED" || result.Output != tt.want {
+			t.Errorf("Run(%q) = %s with output %q, want ACCEPTED with %q", tt.input, result.Status, result.Output, tt.want)
+		}
+	}
+}
+
+func TestIntegrationExpiredWarmContainerRemoved(t *testing.T) {
+	requireDocker(t)
+	defer Configure(DefaultConfig())
+	defer RemoveWarmContainers()
+
+	config := DefaultConfig()
+	config.ReuseContainers = true
+	Configure(config)
+
+	if _, err := RunInContainer("PYTHON", "print(1)", ""); err != nil {
+		t.Fatalf("first RunInContainer failed: %v", err)
+	}
+	// Let the pooled container expire before the next run looks at it
+	var expired string
+	warm.mu.Lock()
+	for key, idle := range warm.idle {
+		for i := range idle {
+			idle[i].expires = time.Now()
+			expired = idle[i].id
+		}
+		warm.idle[key] = idle
+	}
+	warm.mu.Unlock()
+	if expired == "" {
+		t.Fatal("the first run left no container in the pool")
+	}
+
+	if _, err := RunInContainer("PYTHON", "print(2)", ""); err != nil {
+		t.Fatalf("second RunInContainer failed: %v", err)
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatalf("failed to create docker client: %v", err)
+	}
+	defer cli.Close()
+	if _, err := cli.ContainerInspect(context.Background(), expired); !client.IsErrNotFound(err) {
+		t.Errorf("inspecting the expired container returned %v, want it removed", err)
+	}
+}
+
+func TestIntegrationRepetitionsReuseTheContainer(t *testing.T) {
+	requireDocker(t)
+
+	// Each execution appends to a file in the container, and the third one fails. In
+	// fresh containers every execution would be the first and succeed.
+	result, err := Run(RunRequest{
+		Language:         "PYTHON",
+		Code:             "import sys\nf = open('/tmp/runs', 'a+'); f.write('x\\n'); f.seek(0); n = len(f.readlines())\nprint(n)\nsys.exit(3 if n == 3 else 0)",
+		TimeLimitSeconds: 5.0,
+		MemoryLimitBytes: 64 * 1024 * 1024,
+		Repetitions:      3,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Status != "ACCEPTED" || result.Output != "1" {
+		t.Fatalf("result = %s %q, want ACCEPTED from the first execution", result.Status, result.Output)
+	}
+	if len(result.RepeatMillis) != 1 {
+		t.Errorf("RepeatMillis = %v, want the time of the second execution only", result.RepeatMillis)
+	}
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+// defaultMaskedPaths mirrors the paths Docker masks by default. Setting
+// HostConfig.MaskedPaths replaces Docker's list, so it has to be repeated.
+var defaultMaskedPaths = []string{
+	"/proc/asound",
+	"/proc/acpi",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// isolatedMaskedPaths are hidden from the submission when mounts are isolated: the
+// files Docker bind-mounts into every container from the host side, and the image's
+// credential databases.
+var isolatedMaskedPaths = []string{
+	"/etc/hosts",
+	"/etc/hostname",
+	"/etc/resolv.conf",
+	"/etc/shadow",
+	"/etc/gshadow",
+}
+
+// buildHostConfig returns the host configuration of a submission container. Source
+// code is copied into the container rather than mounted, so there are never any bind
+// mounts or volumes; with IsolateMounts the remaining host-provided files are masked
+// as well, leaving the submission only /app and the image's runtime. The container
+// runs under the configured OCI runtime, if any.
+func buildHostConfig(memoryLimitBytes, nanoCPUs int64) *container.HostConfig {
+	hostConfig := &container.HostConfig{
+		Runtime: cfg.Runtime,
+		Resources: container.Resources{
+			Memory:   memoryLimitBytes,
+			NanoCPUs: nanoCPUs,
+		},
+	}
+	if cfg.IsolateMounts {
+		hostConfig.MaskedPaths = append(append([]string{}, defaultMaskedPaths...), isolatedMaskedPaths...)
+		hostConfig.NetworkMode = "none"
+	}
+	return hostConfig
+}
+
+// requestHostConfig returns buildHostConfig's host configuration with the request's
+// resource limits, and without a network when the request asks for none.
+func requestHostConfig(req RunRequest, memoryLimitBytes, nanoCPUs int64) *container.HostConfig {
+	hostConfig := buildHostConfig(memoryLimitBytes, nanoCPUs)
+	if req.NoNetwork {
+		hostConfig.NetworkMode = "none"
+	}
+	limits := req.Limits
+	if limits.MaxProcesses > 0 {
+		pids := limits.MaxProcesses
+		hostConfig.PidsLimit = &pids
+	}
+	if limits.StackBytes > 0 {
+		hostConfig.Ulimits = append(hostConfig.Ulimits, &units.Ulimit{Name: "stack", Soft: limits.StackBytes, Hard: limits.StackBytes})
+	}
+	if limits.FileSizeBytes > 0 {
+		hostConfig.Ulimits = append(hostConfig.Ulimits, &units.Ulimit{Name: "fsize", Soft: limits.FileSizeBytes, Hard: limits.FileSizeBytes})
+	}
+	return hostConfig
+}
@@ -0,0 +1,92 @@
+package docker
+
+import "testing"
+
+func TestBuildHostConfig(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	Configure(DefaultConfig())
+	hostConfig := buildHostConfig(64*1024*1024, 1e9)
+	if hostConfig.Memory != 64*1024*1024 || hostConfig.NanoCPUs != 1e9 {
+		t.Errorf("Resources = %+v, want the requested memory and CPU", hostConfig.Resources)
+	}
+	if len(hostConfig.Binds) != 0 || len(hostConfig.Mounts) != 0 || len(hostConfig.VolumesFrom) != 0 {
+		t.Errorf("host config mounts host paths: binds %v, mounts %v, volumes from %v", hostConfig.Binds, hostConfig.Mounts, hostConfig.VolumesFrom)
+	}
+	if hostConfig.MaskedPaths != nil {
+		t.Errorf("MaskedPaths = %v, want Docker's defaults when not isolating", hostConfig.MaskedPaths)
+	}
+	if hostConfig.Runtime != "" {
+		t.Errorf("Runtime = %q, want the daemon's default", hostConfig.Runtime)
+	}
+
+	config := DefaultConfig()
+	config.IsolateMounts = true
+	Configure(config)
+	hostConfig = buildHostConfig(64*1024*1024, 0)
+
+	masked := make(map[string]bool)
+	for _, path := range hostConfig.MaskedPaths {
+		masked[path] = true
+	}
+	for _, path := range append(append([]string{}, defaultMaskedPaths...), isolatedMaskedPaths...) {
+		if !masked[path] {
+			t.Errorf("MaskedPaths = %v, missing %s", hostConfig.MaskedPaths, path)
+		}
+	}
+	if hostConfig.NetworkMode != "none" {
+		t.Errorf("NetworkMode = %q, want none", hostConfig.NetworkMode)
+	}
+
+	config = DefaultConfig()
+	config.Runtime = "runsc"
+	Configure(config)
+	if hostConfig = buildHostConfig(64*1024*1024, 0); hostConfig.Runtime != "runsc" {
+		t.Errorf("Runtime = %q, want runsc", hostConfig.Runtime)
+	}
+}
+
+func TestRequestHostConfig(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	Configure(DefaultConfig())
+	if hostConfig := requestHostConfig(RunRequest{}, 64*1024*1024, 0); hostConfig.NetworkMode != "" {
+		t.Errorf("NetworkMode = %q, want the daemon's default", hostConfig.NetworkMode)
+	}
+	hostConfig := requestHostConfig(RunRequest{NoNetwork: true}, 64*1024*1024, 1e9)
+	if hostConfig.NetworkMode != "none" {
+		t.Errorf("NetworkMode = %q, want none", hostConfig.NetworkMode)
+	}
+	if hostConfig.Memory != 64*1024*1024 || hostConfig.NanoCPUs != 1e9 {
+		t.Errorf("Resources = %+v, want the requested memory and CPU", hostConfig.Resources)
+	}
+}
+
+func TestRequestHostConfigLimits(t *testing.T) {
+	defer Configure(DefaultConfig())
+	Configure(DefaultConfig())
+
+	hostConfig := requestHostConfig(RunRequest{}, 64*1024*1024, 0)
+	if hostConfig.PidsLimit != nil || len(hostConfig.Ulimits) != 0 {
+		t.Errorf("PidsLimit = %v, Ulimits = %v, want Docker's defaults", hostConfig.PidsLimit, hostConfig.Ulimits)
+	}
+
+	limits := ResourceLimits{CPUs: 0.5, MaxProcesses: 16, StackBytes: 64 << 20, FileSizeBytes: 8 << 20}
+	hostConfig = requestHostConfig(RunRequest{Limits: limits}, 64*1024*1024, containerNanoCPUs(limits.CPUs))
+	if hostConfig.NanoCPUs != 5e8 {
+		t.Errorf("NanoCPUs = %d, want half a core", hostConfig.NanoCPUs)
+	}
+	if hostConfig.PidsLimit == nil || *hostConfig.PidsLimit != 16 {
+		t.Errorf("PidsLimit = %v, want 16", hostConfig.PidsLimit)
+	}
+	ulimits := make(map[string]int64)
+	for _, ulimit := range hostConfig.Ulimits {
+		if ulimit.Soft != ulimit.Hard {
+			t.Errorf("ulimit %s soft %d differs from hard %d", ulimit.Name, ulimit.Soft, ulimit.Hard)
+		}
+		ulimits[ulimit.Name] = ulimit.Hard
+	}
+	if ulimits["stack"] != 64<<20 || ulimits["fsize"] != 8<<20 || len(ulimits) != 2 {
+		t.Errorf("Ulimits = %v, want stack 64MB and fsize 8MB", ulimits)
+	}
+}
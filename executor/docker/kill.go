@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// containerKiller is the part of the Docker client used to stop a timed-out container.
+type containerKiller interface {
+	ContainerKill(ctx context.Context, containerID, signal string) error
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+}
+
+// killPollInterval is how often a killed container is checked for having stopped.
+const killPollInterval = 50 * time.Millisecond
+
+// killContainer sends SIGKILL and waits up to window for the container to stop. A
+// process in uninterruptible sleep can outlive SIGKILL, so a container still running
+// after the window is force-removed instead, with the same window as its deadline.
+// It reports whether the force-remove was needed; either way it returns within about
+// twice the window.
+func killContainer(ctx context.Context, cli containerKiller, containerID string, window time.Duration) bool {
+	cli.ContainerKill(ctx, containerID, "SIGKILL")
+
+	waitCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+	ticker := time.NewTicker(killPollInterval)
+	defer ticker.Stop()
+	for {
+		inspect, err := cli.ContainerInspect(waitCtx, containerID)
+		if err == nil && (inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running) {
+			return false
+		}
+		select {
+		case <-waitCtx.Done():
+			removeCtx, cancelRemove := context.WithTimeout(ctx, window)
+			defer cancelRemove()
+			cli.ContainerRemove(removeCtx, containerID, types.ContainerRemoveOptions{Force: true})
+			return true
+		case <-ticker.C:
+		}
+	}
+}
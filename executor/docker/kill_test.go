@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// stubbornContainer is a containerKiller whose container only stops on SIGKILL if
+// stopsOnKill is set, like a program stuck in uninterruptible sleep when it is not.
+type stubbornContainer struct {
+	stopsOnKill bool
+	running     bool
+	killed      bool
+	removed     bool
+}
+
+func (c *stubbornContainer) ContainerKill(ctx context.Context, containerID, signal string) error {
+	c.killed = true
+	if c.stopsOnKill {
+		c.running = false
+	}
+	return nil
+}
+
+func (c *stubbornContainer) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		State: &types.ContainerState{Running: c.running},
+	}}, nil
+}
+
+func (c *stubbornContainer) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	if options.Force {
+		c.removed = true
+		c.running = false
+	}
+	return nil
+}
+
+func TestKillContainerStopsOnSIGKILL(t *testing.T) {
+	cli := &stubbornContainer{stopsOnKill: true, running: true}
+
+	if killContainer(context.Background(), cli, "c1", time.Second) {
+		t.Error("killContainer() = true, want no force-remove when SIGKILL works")
+	}
+	if !cli.killed || cli.removed {
+		t.Errorf("killed = %v, removed = %v, want killed only", cli.killed, cli.removed)
+	}
+}
+
+func TestKillContainerForceRemovesWhenSIGKILLIsIgnored(t *testing.T) {
+	cli := &stubbornContainer{stopsOnKill: false, running: true}
+
+	start := time.Now()
+	if !killContainer(context.Background(), cli, "c1", 200*time.Millisecond) {
+		t.Error("killContainer() = false, want the force-remove recovery")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("killContainer() took %v, want about the 200ms window", elapsed)
+	}
+	if !cli.killed || !cli.removed || cli.running {
+		t.Errorf("killed = %v, removed = %v, running = %v, want killed, then removed", cli.killed, cli.removed, cli.running)
+	}
+}
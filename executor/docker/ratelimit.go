@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"sync"
+	"time"
+)
+
+// creationLimiter is a token bucket over container creation. It smooths bursts of
+// submissions into a steady rate of ContainerCreate/ContainerStart calls that the
+// Docker daemon can keep up with, where languageSlots and cpuBudget only bound how
+// many containers run at once. Up to burst creations may happen back to back; after
+// that they are spaced one interval apart.
+type creationLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // 0 means unlimited
+	burst    int
+	// next is when the bucket would be empty again if no more creations were
+	// admitted early, i.e. the admission time of the next creation at a full rate.
+	next time.Time
+}
+
+func newCreationLimiter(perSecond float64, burst int) *creationLimiter {
+	if perSecond <= 0 {
+		return &creationLimiter{}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &creationLimiter{interval: time.Duration(float64(time.Second) / perSecond), burst: burst}
+}
+
+// wait blocks until another container may be created.
+func (l *creationLimiter) wait() {
+	if l.interval == 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	admitAt := l.next.Add(-time.Duration(l.burst-1) * l.interval)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay := admitAt.Sub(now); delay > 0 {
+		time.Sleep(delay)
+	}
+}
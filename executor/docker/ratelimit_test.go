@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreationLimiterSmoothsBursts(t *testing.T) {
+	const perSecond, burst, creations = 50.0, 3, 15
+	limiter := newCreationLimiter(perSecond, burst)
+
+	start := time.Now()
+	var mu sync.Mutex
+	var admitted []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < creations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.wait()
+			mu.Lock()
+			admitted = append(admitted, time.Since(start))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// However the burst is scheduled, by any time t at most burst + t*rate creations
+	// may have been admitted.
+	for _, at := range admitted {
+		n := 0
+		for _, other := range admitted {
+			if other <= at {
+				n++
+			}
+		}
+		if limit := burst + int(at.Seconds()*perSecond) + 1; n > limit {
+			t.Errorf("%d creations admitted within %v, want at most %d", n, at, limit)
+		}
+	}
+	want := time.Duration(creations-burst) * time.Second / perSecond
+	if elapsed := time.Since(start); elapsed < want {
+		t.Errorf("%d creations took %v, want at least %v", creations, elapsed, want)
+	}
+}
+
+func TestCreationLimiterUnlimited(t *testing.T) {
+	limiter := newCreationLimiter(0, 0)
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		limiter.wait()
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("1000 unlimited creations took %v", elapsed)
+	}
+}
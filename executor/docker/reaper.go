@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Labels set on every submission container. The reaper finds containers by
+// containerLabel, whatever they are named, and lifetimeLabel tells it how long a
+// container is expected to live, in seconds: its run's, or for a reusable container
+// Config.WarmContainerLifetime.
+const (
+	containerLabel  = "oj.executor"
+	lifetimeLabel   = "oj.lifetime"
+	submissionLabel = "oj.submission"
+)
+
+// containerLifetime is how long a one-shot container's keepalive runs: the time
+// limit and grace period of its run, plus Config.KeepaliveHeadroom for the compile
+// step and reading the results, in whole seconds with at least a second to spare.
+// Its submission is long done by then, so such a container that still exists was
+// orphaned, e.g. by an executor that crashed before removing it.
+func containerLifetime(timeLimitSeconds float64) time.Duration {
+	lifetime := time.Duration(timeLimitSeconds*float64(time.Second)) + cfg.TLEGracePeriod + cfg.KeepaliveHeadroom
+	return lifetime.Truncate(time.Second) + time.Second
+}
+
+// containerLabels returns the labels of a container created for a submission.
+func containerLabels(submissionID int64, lifetime time.Duration) map[string]string {
+	return map[string]string{
+		containerLabel:  "true",
+		submissionLabel: strconv.FormatInt(submissionID, 10),
+		lifetimeLabel:   strconv.Itoa(int(lifetime.Seconds())),
+	}
+}
+
+// containerReaper is the part of the Docker client used to remove orphaned containers.
+type containerReaper interface {
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+}
+
+// reapedContainers counts the orphaned containers removed since the executor started.
+var reapedContainers int64
+
+// ReapedContainers returns how many orphaned containers the reaper has removed.
+func ReapedContainers() int64 {
+	return atomic.LoadInt64(&reapedContainers)
+}
+
+// reapStaleContainers removes the labeled containers, running or not, that are older
+// than their lifetime label. It returns how many were removed.
+func reapStaleContainers(ctx context.Context, cli containerReaper, now time.Time) (int, error) {
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", containerLabel)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	removed := 0
+	for _, c := range containers {
+		seconds, err := strconv.Atoi(c.Labels[lifetimeLabel])
+		if err != nil {
+			continue // No lifetime: not one of ours to judge
+		}
+		if now.Sub(time.Unix(c.Created, 0)) <= time.Duration(seconds)*time.Second {
+			continue
+		}
+		if err := cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			log.Printf("Failed to remove orphaned container %s: %v", c.ID, err)
+			continue
+		}
+		log.Printf("Removed orphaned container %s of submission %s", c.ID, c.Labels[submissionLabel])
+		atomic.AddInt64(&reapedContainers, 1)
+		removed++
+	}
+	return removed, nil
+}
+
+// RunReaper removes orphaned submission containers every interval until stop is closed.
+func RunReaper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reapOnce()
+		}
+	}
+}
+
+func reapOnce() {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Printf("Failed to create docker client for the reaper: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if removed, err := reapStaleContainers(ctx, cli, time.Now()); err != nil {
+		log.Printf("Failed to reap orphaned containers: %v", err)
+	} else if removed > 0 {
+		log.Printf("Reaped %d orphaned containers.", removed)
+	}
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeDaemon is a containerReaper serving a fixed container list, filtered by label
+// like the daemon does.
+type fakeDaemon struct {
+	containers []types.Container
+	removed    []string
+}
+
+func (d *fakeDaemon) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	var matching []types.Container
+	for _, c := range d.containers {
+		keep := true
+		for _, label := range options.Filters.Get("label") {
+			if _, ok := c.Labels[label]; !ok {
+				keep = false
+			}
+		}
+		if keep {
+			matching = append(matching, c)
+		}
+	}
+	return matching, nil
+}
+
+func (d *fakeDaemon) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	d.removed = append(d.removed, containerID)
+	return nil
+}
+
+func TestReapStaleContainers(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) int64 { return now.Add(-d).Unix() }
+	daemon := &fakeDaemon{containers: []types.Container{
+		{ID: "orphan", Created: ago(time.Hour), Labels: containerLabels(1, 5*time.Minute)},
+		{ID: "running", Created: ago(time.Minute), Labels: containerLabels(2, 5*time.Minute)},
+		{ID: "warm", Created: ago(time.Minute), Labels: containerLabels(3, time.Hour)},
+		{ID: "pooled orphan", Created: ago(2 * time.Hour), Labels: containerLabels(4, time.Hour)},
+		{ID: "unlabeled", Created: ago(time.Hour), Labels: map[string]string{lifetimeLabel: "1"}},
+		{ID: "other", Created: ago(time.Hour)},
+	}}
+	before := ReapedContainers()
+
+	removed, err := reapStaleContainers(context.Background(), daemon, now)
+	if err != nil {
+		t.Fatalf("reapStaleContainers failed: %v", err)
+	}
+	if removed != 2 || strings.Join(daemon.removed, ",") != "orphan,pooled orphan" {
+		t.Errorf("removed %d containers %v, want only the orphans", removed, daemon.removed)
+	}
+	if got := ReapedContainers() - before; got != 2 {
+		t.Errorf("ReapedContainers() went up by %d, want 2", got)
+	}
+}
+
+func TestContainerLabels(t *testing.T) {
+	labels := containerLabels(42, 5*time.Minute)
+	if labels[containerLabel] == "" || labels[submissionLabel] != "42" || labels[lifetimeLabel] != "300" {
+		t.Errorf("containerLabels(42, 5m) = %v, want labeled with submission 42 and a 300s lifetime", labels)
+	}
+}
+
+func TestContainerLifetime(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name             string
+		timeLimitSeconds float64
+		grace            time.Duration
+		want             time.Duration
+	}{
+		{"short limit", 1, 0, 2*time.Minute + 2*time.Second},
+		{"fractional limit", 2.5, 0, 2*time.Minute + 3*time.Second},
+		{"long limit is not capped", 400, 0, 400*time.Second + 2*time.Minute + time.Second},
+		{"grace period", 400, 10 * time.Second, 410*time.Second + 2*time.Minute + time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.TLEGracePeriod = tt.grace
+			Configure(config)
+
+			got := containerLifetime(tt.timeLimitSeconds)
+			if got != tt.want {
+				t.Errorf("containerLifetime(%v) = %v, want %v", tt.timeLimitSeconds, got, tt.want)
+			}
+			if limit := time.Duration(tt.timeLimitSeconds*float64(time.Second)) + tt.grace; got <= limit {
+				t.Errorf("keepalive of %v would cut short a run allowed %v", got, limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// errExecutionTimedOut reports a repetition that ran past the hard time limit.
+var errExecutionTimedOut = errors.New("execution timed out")
+
+// repeatExecution executes the program of an accepted run again in the container it
+// ran in, until it ran req.Repetitions times in all, and returns the times of the
+// repetitions that exited cleanly within the time limit. The others are left out, as
+// the first run already decided the verdict. A repetition that has to be killed ends
+// the repetitions, and killed reports that the container cannot be reused.
+func repeatExecution(ctx context.Context, cli *client.Client, containerID string, execConfig types.ExecConfig, req RunRequest) (times []int64, killed bool) {
+	timeLimit := time.Duration(req.TimeLimitSeconds * float64(time.Second))
+	hardLimit := timeLimit + cfg.TLEGracePeriod
+	for i := 1; i < req.Repetitions; i++ {
+		elapsed, exitCode, err := executeOnce(ctx, cli, containerID, execConfig, req.Input, hardLimit)
+		if errors.Is(err, errExecutionTimedOut) {
+			killContainer(ctx, cli, containerID, cfg.KillTimeout)
+			log.Printf("[Submission %d] Repetition %d/%d timed out. Skipping the remaining repetitions.", req.SubmissionID, i+1, req.Repetitions)
+			return times, true
+		}
+		if err != nil {
+			log.Printf("[Submission %d] Repetition %d/%d failed: %v", req.SubmissionID, i+1, req.Repetitions, err)
+			continue
+		}
+		if elapsed > timeLimit || (exitCode != 0 && !req.IgnoreExitCode) {
+			log.Printf("[Submission %d] Repetition %d/%d exited with code %d after %v. Leaving it out of the timing.",
+				req.SubmissionID, i+1, req.Repetitions, exitCode, elapsed)
+			continue
+		}
+		times = append(times, elapsed.Milliseconds())
+	}
+	return times, false
+}
+
+// executeOnce runs the execution exec once more, feeding it input unless it reads a
+// file, and returns how long it ran and its exit code.
+func executeOnce(ctx context.Context, cli *client.Client, containerID string, execConfig types.ExecConfig, input string, hardLimit time.Duration) (time.Duration, int, error) {
+	execID, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create execution exec: %w", err)
+	}
+	execResp, err := cli.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to attach to execution exec: %w", err)
+	}
+	defer execResp.Close()
+	if err := cli.ContainerExecStart(ctx, execID.ID, types.ExecStartCheck{}); err != nil {
+		return 0, 0, fmt.Errorf("failed to start execution exec: %w", err)
+	}
+	if execConfig.AttachStdin {
+		if _, err := execResp.Conn.Write([]byte(input)); err != nil {
+			return 0, 0, fmt.Errorf("failed to write to stdin: %w", err)
+		}
+		execResp.CloseWrite()
+	}
+
+	startTime := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(ioutil.Discard, execResp.Reader) // Returns once the program exits, or on Close
+	}()
+	timer := time.NewTimer(hardLimit)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		return time.Since(startTime), 0, errExecutionTimedOut
+	}
+	elapsed := time.Since(startTime)
+
+	inspect, exited, err := waitForExecExit(ctx, cli, execID.ID, cfg.OutputGracePeriod)
+	if err != nil {
+		return elapsed, 0, fmt.Errorf("failed to inspect execution exec: %w", err)
+	}
+	if !exited {
+		return elapsed, 0, fmt.Errorf("execution exec still running %v after its output closed", cfg.OutputGracePeriod)
+	}
+	return elapsed, inspect.ExitCode, nil
+}
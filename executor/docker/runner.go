@@ -10,12 +10,16 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/google/uuid"
 )
 
@@ -25,6 +29,109 @@ type ExecutionResult struct {
 	Status     string // e.g., "ACCEPTED", "WRONG_ANSWER", "TIME_LIMIT_EXCEEDED"
 	TimeMillis int64
 	MemoryKB   int64
+	Threads    int64 // Peak number of threads the program had alive at once, as sampled.
+	// CompileOutput holds compiler diagnostics from a successful compile (warnings),
+	// when compile warnings are enabled. Failed compiles report diagnostics in Output.
+	CompileOutput string
+	// CompileMillis is how long the compiler ran; zero for interpreted languages.
+	CompileMillis int64
+	// Overran reports that the program ran past its time limit. OverrunMillis is by how
+	// much, and KilledAtMillis is the wall time at which it was killed (0 if it exited
+	// on its own, e.g. within the grace period).
+	Overran        bool
+	OverrunMillis  int64
+	KilledAtMillis int64
+	// DiskKB is the total size of the files in /app once the program has exited: its
+	// source, input and outputs, and anything else it wrote there.
+	DiskKB int64
+	// CompileCommand and ExecuteCommand are the shell-quoted command lines the run
+	// used, including injected flags. They are only recorded in debug mode, and
+	// CompileCommand is empty for interpreted languages.
+	CompileCommand string
+	ExecuteCommand string
+	// ExitCode is the program's exit code, when it exited by itself.
+	ExitCode int
+	// Signal is the signal that ended the program, if one did: SIGKILL for a program
+	// killed at the time limit, otherwise taken from an exit code above 128.
+	Signal int
+	// CPUMillis is the CPU time the program used, over all of its threads.
+	CPUMillis int64
+	// Timeline is the program's stdout and stderr, line by line in the order they were
+	// written, each line stamped with the time since the program started. It is only
+	// captured in debug mode, and not for runs with an output line limit.
+	Timeline string
+	// RepeatMillis are the times of the repetitions of RunRequest.Repetitions that
+	// exited cleanly within the time limit, after the run itself.
+	RepeatMillis []int64
+}
+
+// RunRequest describes one execution of a submission against a single input.
+type RunRequest struct {
+	SubmissionID     int64
+	Language         string
+	Code             string
+	Input            string
+	TimeLimitSeconds float64
+	MemoryLimitBytes int64
+	// MaxThreads fails the run with RESOURCE_LIMIT when more threads than this are
+	// observed alive at once. Zero means unlimited.
+	MaxThreads int
+	// MaxOutputLines stops the program once it prints more lines than this and fails
+	// the run with OUTPUT_LIMIT_EXCEEDED. Zero means unlimited.
+	MaxOutputLines int
+	// Interactive runs talk to their input as it is written, so they are always fed
+	// through the stdin pipe regardless of Config.StdinMode.
+	Interactive bool
+	// IgnoreExitCode judges a program that exits non-zero on its output, like one that
+	// exits cleanly, instead of failing it with RUNTIME_ERROR.
+	IgnoreExitCode bool
+	// SkipSyntaxCheck leaves out the syntax check of Config.SyntaxCheck, for a code
+	// that an earlier run of the submission already checked.
+	SkipSyntaxCheck bool
+	// Function, if set, runs Code in function mode: Code defines a function of this
+	// name, which the language's FunctionHarness calls (see wrapFunction).
+	Function string
+	// NoNetwork runs the program without a network even when mounts are not isolated,
+	// for judge-provided programs such as checkers. Such runs never use pooled containers.
+	NoNetwork bool
+	// Limits are the container limits beyond time and memory.
+	Limits ResourceLimits
+	// DebugBuild compiles with the language's DebugFlags, and makes the output of a
+	// RUNTIME_ERROR a short backtrace of the crash. The instrumented program is slower
+	// and uses more memory than a regular build, so it runs with debugMemoryFactor times
+	// MemoryLimitBytes. Languages without DebugFlags ignore it.
+	DebugBuild bool
+	// Repetitions, when above one, executes an ACCEPTED program again in the same
+	// container, without compiling it again, until it ran this many times in all. The
+	// repetitions' times are reported in ExecutionResult.RepeatMillis.
+	Repetitions int
+
+	// configure, when set, adjusts the language's configuration for this run only, so
+	// tests can run a variant of a language without editing langConfigs.
+	configure func(*LanguageConfig)
+}
+
+// ResourceLimits are a run's container limits beyond time and memory. Zero fields keep
+// the executor's defaults: ContainerCPUs, and no limit for the others. They apply to
+// the whole container, the compile step included.
+type ResourceLimits struct {
+	// CPUs is how many cores the container may use, within Config.CPUBudget.
+	CPUs float64
+	// MaxProcesses caps the processes and threads alive in the container at once;
+	// creating more fails (fork/clone return EAGAIN).
+	MaxProcesses int64
+	// StackBytes is the stack size limit (RLIMIT_STACK).
+	StackBytes int64
+	// FileSizeBytes is the largest file a process may write (RLIMIT_FSIZE), which
+	// bounds both the files a program leaves on disk and its redirected output.
+	FileSizeBytes int64
+}
+
+// resourceUsage is the peak usage observed by the execution monitor.
+type resourceUsage struct {
+	memoryBytes uint64
+	tasks       uint64
+	cpuNanos    uint64 // Cumulative CPU time of the container
 }
 
 // LanguageConfig defines the Docker image and commands for a language.
@@ -33,31 +140,119 @@ type LanguageConfig struct {
 	SourceFile string
 	CompileCmd []string
 	ExecuteCmd []string
+	// WarningFlags are added to CompileCmd when compile warnings are enabled.
+	WarningFlags []string
+	// DebugFlags are added to CompileCmd for a RunRequest.DebugBuild. They must make
+	// a crashing program print a symbolized backtrace to stderr by itself.
+	DebugFlags []string
+	// Binary is the file, relative to /app, that a successful compile must produce.
+	Binary string
+	// RuntimeImage, if set, runs programs compiled in a separate container instead
+	// of Image, e.g. a JRE without the compiler.
+	RuntimeImage string
+	// SyntaxCheckCmd checks an interpreted language's source without running it,
+	// when Config.SyntaxCheck is enabled.
+	SyntaxCheckCmd []string
+	// FunctionHarness is the program that runs a function-mode submission, with
+	// {{code}} standing for the submission's code and {{function}} for the name of the
+	// function to call. Languages without one do not support function mode.
+	FunctionHarness string
 }
 
 // A map of supported languages to their Docker configurations.
 var langConfigs = map[string]LanguageConfig{
 	"JAVA": {
-		Image:      "openjdk:11-jdk-slim",
-		SourceFile: "Main.java",
-		CompileCmd: []string{"javac", "Main.java"},
-		ExecuteCmd: []string{"java", "-cp", ".", "Main"},
+		Image:        "openjdk:11-jdk-slim",
+		RuntimeImage: "openjdk:11-jre-slim",
+		SourceFile:   "Main.java",
+		CompileCmd:   []string{"javac", "Main.java"},
+		ExecuteCmd:   []string{"java", "-cp", ".", "Main"},
+		WarningFlags: []string{"-Xlint:all"},
+		Binary:       "Main.class",
 	},
 	"PYTHON": {
-		Image:      "python:3.9-slim",
-		SourceFile: "main.py",
-		CompileCmd: nil, // Interpreted language
-		ExecuteCmd: []string{"python", "main.py"},
+		Image:           "python:3.9-slim",
+		SourceFile:      "main.py",
+		CompileCmd:      nil, // Interpreted language
+		ExecuteCmd:      []string{"python", "main.py"},
+		SyntaxCheckCmd:  []string{"python", "-m", "py_compile", "main.py"},
+		FunctionHarness: pythonFunctionHarness,
+	},
+	"C": {
+		Image:        "gcc:latest",
+		SourceFile:   "main.c",
+		CompileCmd:   []string{"gcc", "main.c", "-o", "main"},
+		ExecuteCmd:   []string{"./main"},
+		WarningFlags: []string{"-Wall", "-Wextra"},
+		DebugFlags:   []string{"-g", "-fsanitize=address", "-fno-omit-frame-pointer"},
+		Binary:       "main",
 	},
 	"CPP": {
-		Image:      "gcc:latest",
-		SourceFile: "main.cpp",
-		CompileCmd: []string{"g++", "main.cpp", "-o", "main"},
-		ExecuteCmd: []string{"./main"},
+		Image:        "gcc:latest",
+		SourceFile:   "main.cpp",
+		CompileCmd:   []string{"g++", "main.cpp", "-o", "main"},
+		ExecuteCmd:   []string{"./main"},
+		WarningFlags: []string{"-Wall", "-Wextra"},
+		DebugFlags:   []string{"-g", "-fsanitize=address", "-fno-omit-frame-pointer"},
+		Binary:       "main",
 	},
 	// Add other languages here
 }
 
+// langAliases maps common alternative spellings, in lower case, to langConfigs keys.
+// Config.LanguageAliases adds to and overrides these.
+var langAliases = map[string]string{
+	"c":       "C",
+	"gcc":     "C",
+	"java":    "JAVA",
+	"java11":  "JAVA",
+	"py":      "PYTHON",
+	"py3":     "PYTHON",
+	"python":  "PYTHON",
+	"python3": "PYTHON",
+	"c++":     "CPP",
+	"cpp":     "CPP",
+	"cxx":     "CPP",
+	"g++":     "CPP",
+}
+
+// ResolveLanguage returns the langConfigs key for a language name or alias. Matching
+// is case-insensitive; names that are neither a language nor an alias are not found.
+func ResolveLanguage(name string) (string, bool) {
+	if _, ok := langConfigs[name]; ok {
+		return name, true
+	}
+	if _, ok := langConfigs[strings.ToUpper(name)]; ok {
+		return strings.ToUpper(name), true
+	}
+	alias := strings.ToLower(strings.TrimSpace(name))
+	language, ok := cfg.LanguageAliases[alias]
+	if !ok {
+		language, ok = langAliases[alias]
+	}
+	if _, supported := langConfigs[language]; !ok || !supported {
+		return "", false
+	}
+	return language, true
+}
+
+// Compiles reports whether a language (a name or alias) has a compile step before its
+// programs run. Syntax checks of interpreted languages do not count.
+func Compiles(name string) bool {
+	language, ok := ResolveLanguage(name)
+	return ok && langConfigs[language].CompileCmd != nil
+}
+
+// languageConfig returns the configuration of a supported language, with the
+// configured overrides applied.
+func languageConfig(language string) LanguageConfig {
+	config := langConfigs[language]
+	if flags, ok := cfg.WarningFlags[language]; ok {
+		config.WarningFlags = flags
+	}
+	return config
+}
+
 // RunInContainer creates a Docker container, executes the code, and returns the result.
 func RunInContainer(language, code, input string) (*ExecutionResult, error) {
 	return RunInContainerWithLimits(0, language, code, input, 2.0, 256*1024*1024) // 2 seconds, 256MB
@@ -65,19 +260,56 @@ func RunInContainer(language, code, input string) (*ExecutionResult, error) {
 
 // RunInContainerWithLimits creates a Docker container with custom limits, executes the code, and returns the result.
 func RunInContainerWithLimits(submissionID int64, language, code, input string, timeLimitSeconds float64, memoryLimitBytes int64) (*ExecutionResult, error) {
+	return Run(RunRequest{
+		SubmissionID:     submissionID,
+		Language:         language,
+		Code:             code,
+		Input:            input,
+		TimeLimitSeconds: timeLimitSeconds,
+		MemoryLimitBytes: memoryLimitBytes,
+	})
+}
+
+// Languages returns the names of the supported languages in sorted order.
+func Languages() []string {
+	languages := make([]string, 0, len(langConfigs))
+	for language := range langConfigs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Run creates a Docker container for the request, executes the code, and returns the result.
+func Run(req RunRequest) (*ExecutionResult, error) {
+	submissionID, language, code, input := req.SubmissionID, req.Language, req.Code, req.Input
+	timeLimitSeconds, memoryLimitBytes := req.TimeLimitSeconds, req.MemoryLimitBytes
+
+	language, ok := ResolveLanguage(language)
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", req.Language)
+	}
+	config := languageConfig(language)
+	if req.configure != nil {
+		req.configure(&config)
+	}
+	memoryLimitBytes = runMemoryBytes(config, req)
+	if req.Function != "" {
+		wrapped, err := wrapFunction(language, config, code, req.Function)
+		if err != nil {
+			return nil, err
+		}
+		code = wrapped
+	}
+
 	ctx := context.Background()
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %w", err)
 	}
 
-	config, ok := langConfigs[language]
-	if !ok {
-		return nil, fmt.Errorf("unsupported language: %s", language)
-	}
-
 	// Create a temporary directory to store the source code
-	tempDir, err := ioutil.TempDir("", "online-judge-")
+	tempDir, err := newScratchDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
 	}
@@ -89,118 +321,182 @@ func RunInContainerWithLimits(submissionID int64, language, code, input string,
 		return nil, fmt.Errorf("failed to write source code: %w", err)
 	}
 
-	// Pull the Docker image if it doesn't exist
-	reader, err := cli.ImagePull(ctx, config.Image, types.ImagePullOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to pull image %s: %w", config.Image, err)
+	// Write the input next to it when stdin is redirected from a file
+	stdinFromFile := useStdinFile(req)
+	inputFilePath := fmt.Sprintf("%s/%s", tempDir, inputFile)
+	if stdinFromFile {
+		if err := ioutil.WriteFile(inputFilePath, []byte(input), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write input: %w", err)
+		}
 	}
-	io.Copy(ioutil.Discard, reader) // Wait for pull to complete
 
-	// Create the container with a long-running command so we can exec into it
-	resp, err := cli.ContainerCreate(ctx, &container.Config{
-		Image:        config.Image,
-		Cmd:          []string{"sleep", "300"}, // Keep container alive for 5 minutes
-		WorkingDir:   "/app",
-		Tty:          false,
-		OpenStdin:    true,
-		AttachStdout: true,
-		AttachStderr: true,
-	}, &container.HostConfig{
-		Resources: container.Resources{
-			Memory: memoryLimitBytes,
-		},
-	}, nil, nil, "oj-"+uuid.New().String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to create container: %w", err)
+	// Pull the Docker images if they don't exist
+	image := runImage(config)
+	images := []string{image}
+	if image != config.Image {
+		images = append(images, config.Image)
 	}
-	defer func() {
-		// Ensure container is removed
-		if err := cli.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+	for _, name := range images {
+		reader, err := cli.ImagePull(ctx, name, types.ImagePullOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull image %s: %w", name, err)
 		}
-	}()
-
-	// Start the container so we can execute commands in it
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return nil, fmt.Errorf("failed to start container: %w", err)
+		io.Copy(ioutil.Discard, reader) // Wait for pull to complete
 	}
 
-	// Copy source file into container using Docker CopyToContainer API
-	if err := copyFileToContainer(cli, ctx, resp.ID, sourceFilePath, config.SourceFile, submissionID); err != nil {
-		return nil, fmt.Errorf("failed to copy source file to container: %w", err)
+	// Wait until another container of this language may run
+	releaseSlot := slots.acquire(language)
+	defer releaseSlot()
+
+	// Wait for this container's share of the executor-wide CPU budget
+	nanoCPUs := containerNanoCPUs(req.Limits.CPUs)
+	budget.acquire(nanoCPUs)
+	defer budget.release(nanoCPUs)
+
+	// And for its memory to fit in the executor-wide memory budget
+	reserved := memoryReservation(memoryLimitBytes)
+	memory.acquire(reserved)
+	defer memory.release(reserved)
+
+	// Compile in a throwaway container when configured, so that the run container
+	// only ever receives the compiled artifact
+	var artifact []byte
+	var compiled compilation
+	if cfg.SeparateCompile && config.CompileCmd != nil {
+		var failure *ExecutionResult
+		hostConfig := requestHostConfig(req, compileMemoryBytes(memoryLimitBytes), nanoCPUs)
+		artifact, compiled, failure, err = compileSeparately(ctx, cli, language, config, req, sourceFilePath, hostConfig)
+		if err != nil {
+			return nil, err
+		}
+		if failure != nil {
+			return failure, nil
+		}
 	}
 
-	// --- COMPILE STEP ---
-	if config.CompileCmd != nil {
-		execConfig := types.ExecConfig{
-			Cmd:          config.CompileCmd,
+	// Interpreted languages keep no state outside the container's scratch locations,
+	// so their containers can be wiped and reused by the next submission. Pooled
+	// containers keep the network settings they were created with.
+	reuse := cfg.ReuseContainers && config.CompileCmd == nil && !req.NoNetwork
+	key := warmKey{language: language, memoryBytes: memoryLimitBytes, nanoCPUs: nanoCPUs, limits: req.Limits}
+	runLifetime := containerLifetime(timeLimitSeconds)
+	var pooled warmContainer
+	if reuse {
+		var expired []string
+		pooled, _, expired = warm.take(key, time.Now().Add(runLifetime))
+		removeContainers(ctx, cli, expired)
+	}
+	containerID := pooled.id
+	if containerID == "" {
+		// Create the container with a long-running command so we can exec into it
+		// that outlives the run, but not by much should the executor crash. A pooled
+		// container lives for WarmContainerLifetime, serving the runs that fit in it.
+		lifetime := runLifetime
+		if reuse {
+			lifetime = cfg.WarmContainerLifetime
+		}
+		keepalive := []string{"sleep", strconv.Itoa(int(lifetime.Seconds()))}
+		pooled = warmContainer{expires: time.Now().Add(lifetime)}
+		creations.wait() // Smooth bursts of creations for the daemon's sake
+		resp, err := cli.ContainerCreate(ctx, &container.Config{
+			Image:        image,
+			Cmd:          keepalive,
+			WorkingDir:   "/app",
+			Tty:          false,
+			OpenStdin:    true,
 			AttachStdout: true,
 			AttachStderr: true,
-		}
-		execID, err := cli.ContainerExecCreate(ctx, resp.ID, execConfig)
+			Labels:       containerLabels(submissionID, lifetime),
+		}, requestHostConfig(req, memoryLimitBytes, nanoCPUs), nil, nil, "oj-"+uuid.New().String())
 		if err != nil {
-			return nil, fmt.Errorf("failed to create compile exec: %w", err)
+			return nil, fmt.Errorf("failed to create container: %w", err)
 		}
+		containerID = resp.ID
+		pooled.id = containerID
 
-		execResp, err := cli.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to attach to compile exec: %w", err)
+		// Start the container so we can execute commands in it
+		if err := cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+			cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true})
+			return nil, fmt.Errorf("failed to start container: %w", err)
 		}
-		defer execResp.Close()
+	} else {
+		log.Printf("[Submission %d] Reusing warm %s container", submissionID, language)
+	}
 
-		if err := cli.ContainerExecStart(ctx, execID.ID, types.ExecStartCheck{}); err != nil {
-			return nil, fmt.Errorf("failed to start compile exec: %w", err)
+	// reusable is set once the program has exited on its own, leaving the container
+	// in a state that resetContainer can clean up
+	reusable := false
+	defer func() {
+		if reusable {
+			err := resetContainer(ctx, cli, containerID)
+			if err == nil {
+				warm.put(key, pooled)
+				return
+			}
+			log.Printf("[Submission %d] Failed to reset container for reuse: %v", submissionID, err)
 		}
-
-		// Check compilation result
-		inspect, err := cli.ContainerExecInspect(ctx, execID.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to inspect compile exec: %w", err)
+		// Ensure container is removed
+		if err := cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true}); err != nil {
 		}
+	}()
 
-		// Always read compilation output (even on success)
-		var compileOutput bytes.Buffer
-		io.Copy(&compileOutput, execResp.Reader)
-		compileOutputStr := compileOutput.String()
-
-		// Check for compilation failure - either non-zero exit code OR error messages in output
-		compilationFailed := inspect.ExitCode != 0 || strings.Contains(compileOutputStr, "fatal error") ||
-			strings.Contains(compileOutputStr, "No such file") || strings.Contains(compileOutputStr, "error:")
-
-		if compilationFailed {
-			return &ExecutionResult{
-				Status:     "COMPILATION_ERROR",
-				Output:     compileOutputStr,
-				TimeMillis: 0,
-				MemoryKB:   0,
-			}, nil
+	// Copy source file (or the separately compiled artifact) into container using
+	// Docker CopyToContainer API
+	if artifact != nil {
+		if err := cli.CopyToContainer(ctx, containerID, "/app", bytes.NewReader(artifact), types.CopyToContainerOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to copy artifact to container: %w", err)
 		}
+	} else if err := copyFileToContainer(cli, ctx, containerID, sourceFilePath, config.SourceFile, submissionID); err != nil {
+		return nil, fmt.Errorf("failed to copy source file to container: %w", err)
+	}
+	if stdinFromFile {
+		if err := copyFileToContainer(cli, ctx, containerID, inputFilePath, inputFile, submissionID); err != nil {
+			return nil, fmt.Errorf("failed to copy input file to container: %w", err)
+		}
+	}
 
-		// For C++, make the executable file executable
-		if language == "CPP" {
-			chmodConfig := types.ExecConfig{
-				Cmd:          []string{"chmod", "+x", "main"},
-				AttachStdout: false,
-				AttachStderr: false,
-			}
-			chmodExecID, err := cli.ContainerExecCreate(ctx, resp.ID, chmodConfig)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create chmod exec: %w", err)
-			}
-
-			if err := cli.ContainerExecStart(ctx, chmodExecID.ID, types.ExecStartCheck{}); err != nil {
-				return nil, fmt.Errorf("failed to start chmod exec: %w", err)
-			}
+	// --- COMPILE STEP ---
+	if config.CompileCmd != nil && artifact == nil {
+		// The compiler runs under its own memory limit, not the program's
+		var failure *ExecutionResult
+		err := withMemoryLimit(ctx, cli, containerID, compileMemoryBytes(memoryLimitBytes), memoryLimitBytes, func() error {
+			var err error
+			compiled, failure, err = compileSource(ctx, cli, containerID, language, config, req)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if failure != nil {
+			return failure, nil
+		}
+	} else if syntaxCheck(config, req) {
+		// Interpreted languages fail on syntax errors up front, as compiled ones do
+		checkConfig := config
+		checkConfig.CompileCmd, checkConfig.WarningFlags = config.SyntaxCheckCmd, nil
+		_, failure, err := compileSource(ctx, cli, containerID, language, checkConfig, req)
+		if err != nil {
+			return nil, err
+		}
+		if failure != nil {
+			failure.CompileMillis = 0 // Only a compile step has a compile time
+			return failure, nil
 		}
 	}
 
 	// --- EXECUTION STEP ---
 
 	// Create execution command that redirects stdout/stderr to files
+	// or, when capturing a timeline, streams them back over the exec connection
+	captureOutput := captureTimeline(req)
 	execConfig := types.ExecConfig{
-		Cmd:         []string{"sh", "-c", strings.Join(config.ExecuteCmd, " ") + " > /app/stdout.txt 2> /app/stderr.txt"},
-		AttachStdin: true,
+		Cmd:          buildExecuteCmd(config, req),
+		Env:          buildExecuteEnv(req),
+		AttachStdin:  !stdinFromFile,
+		AttachStdout: captureOutput,
+		AttachStderr: captureOutput,
 	}
-	execID, err := cli.ContainerExecCreate(ctx, resp.ID, execConfig)
+	execID, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create execution exec: %w", err)
 	}
@@ -215,67 +511,89 @@ func RunInContainerWithLimits(submissionID int64, language, code, input string,
 	}
 	defer execResp.Close()
 
+	// Sample the tasks already running (the keepalive) and the CPU time used so far
+	// (compiling, earlier runs in a reused container) so they are not charged to the program
+	baselineTasks := uint64(1)
+	var baselineCPU uint64
+	if usage, err := sampleUsage(ctx, cli, containerID); err == nil {
+		if usage.tasks > 0 {
+			baselineTasks = usage.tasks
+		}
+		baselineCPU = usage.cpuNanos
+	}
+
 	// Start execution
 	if err := cli.ContainerExecStart(dockerCtx, execID.ID, types.ExecStartCheck{}); err != nil {
 		return nil, fmt.Errorf("failed to start execution exec: %w", err)
 	}
 
-	// Write input to stdin
-	log.Printf("[Submission %d] Writing input to container stdin", submissionID)
-	_, err = execResp.Conn.Write([]byte(input))
-	if err != nil {
-		return nil, fmt.Errorf("failed to write to stdin: %w", err)
+	// Write input to stdin, unless the program reads it from /app/input.txt
+	if !stdinFromFile {
+		log.Printf("[Submission %d] Writing input to container stdin", submissionID)
+		_, err = execResp.Conn.Write([]byte(input))
+		if err != nil {
+			return nil, fmt.Errorf("failed to write to stdin: %w", err)
+		}
+		execResp.CloseWrite() // Close stdin to signal end of input
 	}
-	execResp.CloseWrite() // Close stdin to signal end of input
 	log.Printf("[Submission %d] Starting execution monitoring", submissionID)
 
 	startTime := time.Now()
+	output := newTimeline(startTime)
 	var memoryUsageKB int64
+	var peakTasks, cpuNanos uint64
 
-	// Start memory monitoring
-	memoryDone := make(chan int64, 1)
+	// Start memory and task-count monitoring
+	memoryDone := make(chan resourceUsage, 1)
 	memoryCtx, memoryCancel := context.WithTimeout(ctx, time.Duration(timeLimitSeconds*1.5)*time.Second)
 	go func() {
 		defer close(memoryDone)
 		defer memoryCancel()
 
-		var maxMemory uint64 = 1024 * 1024 // Default 1MB in bytes
+		peak := resourceUsage{memoryBytes: 1024 * 1024} // Default 1MB in bytes
 		ticker := time.NewTicker(10 * time.Millisecond)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-memoryCtx.Done():
-				memoryDone <- int64(maxMemory / 1024)
+				memoryDone <- peak
 				return
 			case <-ticker.C:
-				stats, err := cli.ContainerStats(memoryCtx, resp.ID, false)
+				usage, err := sampleUsage(memoryCtx, cli, containerID)
 				if err != nil {
 					continue // Continue monitoring on error
 				}
-				var statsData types.StatsJSON
-				if err := json.NewDecoder(stats.Body).Decode(&statsData); err != nil {
-					stats.Body.Close()
-					continue // Continue monitoring on decode error
+				if usage.memoryBytes > peak.memoryBytes {
+					peak.memoryBytes = usage.memoryBytes
 				}
-				stats.Body.Close()
-
-				if statsData.MemoryStats.Usage > 0 && statsData.MemoryStats.Usage > maxMemory {
-					maxMemory = statsData.MemoryStats.Usage
+				if usage.tasks > peak.tasks {
+					peak.tasks = usage.tasks
+				}
+				if usage.cpuNanos > peak.cpuNanos {
+					peak.cpuNanos = usage.cpuNanos
 				}
 			}
 		}
 	}()
 
-	// Wait for execution completion with timeout
+	// Wait for execution completion with timeout. The program is only killed once the
+	// grace period past the time limit has also run out.
+	timeLimit := time.Duration(timeLimitSeconds * float64(time.Second))
+	hardLimit := timeLimit + cfg.TLEGracePeriod
 	done := make(chan error)
-	execCtx, execCancel := context.WithTimeout(ctx, time.Duration(timeLimitSeconds)*time.Second)
+	execCtx, execCancel := context.WithTimeout(ctx, hardLimit)
 	defer execCancel()
 
 	go func() {
 		defer close(done)
 		// Use context-aware copy to prevent hanging
-		_, err := io.Copy(ioutil.Discard, execResp.Reader)
+		var err error
+		if captureOutput {
+			_, err = stdcopy.StdCopy(output.writer("stdout"), output.writer("stderr"), execResp.Reader)
+		} else {
+			_, err = io.Copy(ioutil.Discard, execResp.Reader)
+		}
 		select {
 		case done <- err:
 		case <-execCtx.Done():
@@ -283,26 +601,41 @@ func RunInContainerWithLimits(submissionID int64, language, code, input string,
 		}
 	}()
 
-	timeLimit := time.Duration(timeLimitSeconds * float64(time.Second))
 	var timedOut bool
+	var finishedAt, killedAt time.Duration
 	select {
-	case <-time.After(timeLimit):
+	case <-time.After(hardLimit):
 		execCancel() // Cancel the copy operation
-		cli.ContainerKill(ctx, resp.ID, "SIGKILL")
+		if killContainer(ctx, cli, containerID, cfg.KillTimeout) {
+			log.Printf("[Submission %d] Container survived SIGKILL for %v; force-removed it", submissionID, cfg.KillTimeout)
+		}
+		finishedAt = time.Since(startTime)
+		killedAt = finishedAt
 		timedOut = true
 		// Give a brief moment for cleanup
 		time.Sleep(100 * time.Millisecond)
 	case copyErr := <-done:
+		finishedAt = time.Since(startTime)
 		if copyErr != nil && execCtx.Err() != nil {
 			// Copy was cancelled due to timeout
 			timedOut = true
 		}
 		// Execution completed, check exit code
 	}
+	var overrun time.Duration
+	if finishedAt > timeLimit {
+		// Finishing within the grace period is still a TLE, just a close one
+		overrun = finishedAt - timeLimit
+		timedOut = true
+	}
+	memoryCancel() // The program is done; stop sampling and collect the peaks
 
 	// Wait for memory monitoring to complete with timeout
 	select {
-	case memoryUsageKB = <-memoryDone:
+	case usage := <-memoryDone:
+		memoryUsageKB = int64(usage.memoryBytes / 1024)
+		peakTasks = usage.tasks
+		cpuNanos = usage.cpuNanos
 		if memoryUsageKB <= 0 {
 			memoryUsageKB = 1024 // Default to 1MB if we can't measure
 		}
@@ -313,29 +646,87 @@ func RunInContainerWithLimits(submissionID int64, language, code, input string,
 
 	execTime := time.Since(startTime)
 
+	var threads int64
+	if req.MaxOutputLines > 0 {
+		baselineTasks += outputLimitTasks // Not the program's own threads
+	}
+	if peakTasks > baselineTasks {
+		threads = int64(peakTasks - baselineTasks)
+	}
+
+	result := &ExecutionResult{
+		TimeMillis:    execTime.Milliseconds(),
+		MemoryKB:      memoryUsageKB,
+		Threads:       threads,
+		CompileOutput: compiled.warnings,
+		CompileMillis: compiled.millis,
+		CPUMillis:     cpuMillis(baselineCPU, cpuNanos),
+	}
+	recordCommands(result, config, req)
+	if captureOutput {
+		result.Timeline = output.String()
+	}
+
 	if timedOut {
+		result.Overran = true
+		result.OverrunMillis = overrun.Milliseconds()
+		result.KilledAtMillis = killedAt.Milliseconds()
+		if killedAt > 0 {
+			result.Signal = int(syscall.SIGKILL)
+		}
 		log.Printf("[Submission %d] Code execution timed out after %.3fs", submissionID, execTime.Seconds())
-		return &ExecutionResult{
-			Status:     "TIME_LIMIT_EXCEEDED",
-			Output:     "Time limit exceeded",
-			TimeMillis: execTime.Milliseconds(),
-			MemoryKB:   memoryUsageKB,
-		}, nil
+		result.Status = "TIME_LIMIT_EXCEEDED"
+		result.Output = "Time limit exceeded"
+		return result, nil
 	}
 
-	// Check execution result
-	inspect, err := cli.ContainerExecInspect(ctx, execID.ID)
+	reusable = reuse // The program exited by itself; nothing of it is left running
+
+	if req.MaxThreads > 0 && threads > int64(req.MaxThreads) {
+		log.Printf("[Submission %d] Program used %d threads, allowed %d", submissionID, threads, req.MaxThreads)
+		result.Status = "RESOURCE_LIMIT"
+		result.Output = fmt.Sprintf("Thread limit exceeded: used %d threads, allowed %d", threads, req.MaxThreads)
+		return result, nil
+	}
+
+	// Check execution result, once the exec has exited and its output files are complete
+	inspect, exited, err := waitForExecExit(ctx, cli, execID.ID, cfg.OutputGracePeriod)
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect execution exec: %w", err)
 	}
+	if !exited {
+		log.Printf("[Submission %d] Execution exec still running %v after its output closed; reading output anyway", submissionID, cfg.OutputGracePeriod)
+	}
+	// Count the CPU time the program used after the monitor's last sample
+	if usage, err := sampleUsage(ctx, cli, containerID); err == nil && usage.cpuNanos > cpuNanos {
+		result.CPUMillis = cpuMillis(baselineCPU, usage.cpuNanos)
+	}
 
 	// Read output files from container
-	stdout, stderr, err := readOutputFiles(cli, ctx, resp.ID, submissionID)
-	if err != nil {
+	var stdout, stderr string
+	if captureOutput {
+		stdout, stderr = output.output("stdout"), output.output("stderr")
+	} else if stdout, stderr, err = readOutputFiles(cli, ctx, containerID, submissionID); err != nil {
 		return nil, fmt.Errorf("failed to read output files: %w", err)
 	}
 
-	if inspect.ExitCode != 0 {
+	if usage, err := diskUsageKB(ctx, cli, containerID); err == nil {
+		result.DiskKB = usage
+	} else {
+		log.Printf("[Submission %d] Failed to measure disk usage: %v", submissionID, err)
+	}
+
+	if req.MaxOutputLines > 0 && countLines(stdout) > req.MaxOutputLines {
+		// The program was stopped by SIGPIPE, so its exit status is meaningless
+		log.Printf("[Submission %d] Program printed more than %d lines", submissionID, req.MaxOutputLines)
+		result.Status = "OUTPUT_LIMIT_EXCEEDED"
+		result.Output = fmt.Sprintf("Output limit exceeded: more than %d lines", req.MaxOutputLines)
+		return result, nil
+	}
+
+	result.ExitCode = inspect.ExitCode
+	result.Signal = exitSignal(inspect.ExitCode)
+	if inspect.ExitCode != 0 && !req.IgnoreExitCode {
 
 		// Return stderr for runtime errors, stdout for output if stderr is empty
 		errorOutput := stderr
@@ -343,32 +734,284 @@ func RunInContainerWithLimits(submissionID int64, language, code, input string,
 			errorOutput = stdout
 		}
 
-		return &ExecutionResult{
-			Status:     "RUNTIME_ERROR",
-			Output:     strings.TrimSpace(errorOutput),
-			TimeMillis: execTime.Milliseconds(),
-			MemoryKB:   memoryUsageKB,
-		}, nil
+		result.Status = "RUNTIME_ERROR"
+		result.Output = strings.TrimSpace(errorOutput)
+		if req.DebugBuild {
+			result.Output = shortBacktrace(result.Output)
+		}
+		return result, nil
 	}
 
 	// Check memory limit
 	if memoryUsageKB*1024 > memoryLimitBytes {
-		return &ExecutionResult{
-			Status:     "MEMORY_LIMIT_EXCEEDED",
-			Output:     strings.TrimSpace(stdout),
-			TimeMillis: execTime.Milliseconds(),
-			MemoryKB:   memoryUsageKB,
-		}, nil
-	}
-
-	return &ExecutionResult{
-		Status:     "ACCEPTED",
-		Output:     strings.TrimSpace(stdout),
-		TimeMillis: execTime.Milliseconds(),
-		MemoryKB:   memoryUsageKB,
+		result.Status = "MEMORY_LIMIT_EXCEEDED"
+		result.Output = strings.TrimSpace(stdout)
+		return result, nil
+	}
+
+	result.Status = "ACCEPTED"
+	result.Output = strings.TrimSpace(stdout)
+	if req.Repetitions > 1 {
+		var killed bool
+		result.RepeatMillis, killed = repeatExecution(ctx, cli, containerID, execConfig, req)
+		reusable = reusable && !killed
+	}
+	return result, nil
+}
+
+// sampleUsage takes a single snapshot of the container's memory usage and live task
+// (thread) count from the pids cgroup.
+func sampleUsage(ctx context.Context, cli *client.Client, containerID string) (resourceUsage, error) {
+	stats, err := cli.ContainerStatsOneShot(ctx, containerID)
+	if err != nil {
+		return resourceUsage{}, err
+	}
+	defer stats.Body.Close()
+
+	var statsData types.StatsJSON
+	if err := json.NewDecoder(stats.Body).Decode(&statsData); err != nil {
+		return resourceUsage{}, err
+	}
+	return resourceUsage{
+		memoryBytes: programMemoryBytes(statsData.MemoryStats),
+		tasks:       statsData.PidsStats.Current,
+		cpuNanos:    statsData.CPUStats.CPUUsage.TotalUsage,
 	}, nil
 }
 
+// cpuMillis returns the CPU time used between two cumulative samples, in milliseconds.
+func cpuMillis(baselineNanos, totalNanos uint64) int64 {
+	if totalNanos <= baselineNanos {
+		return 0
+	}
+	return int64((totalNanos - baselineNanos) / uint64(time.Millisecond))
+}
+
+// exitSignal returns the signal an exit code reports, following the 128+n convention
+// of shells and container runtimes, or 0 for an ordinary exit code.
+func exitSignal(exitCode int) int {
+	if exitCode > 128 && exitCode < 128+65 {
+		return exitCode - 128
+	}
+	return 0
+}
+
+// programMemoryBytes returns the memory charged to the program: its anonymous memory
+// (heap, stacks, anonymous mappings), from cgroup v2's anon or cgroup v1's rss. Total
+// usage also counts the page cache of the files the program reads and writes, which
+// the kernel reclaims under pressure, so charging it would fail I/O-heavy programs
+// that stay well within their limit. Total usage is the fallback when neither
+// statistic is reported.
+func programMemoryBytes(stats types.MemoryStats) uint64 {
+	for _, key := range []string{"anon", "total_rss", "rss"} {
+		if value, ok := stats.Stats[key]; ok {
+			return value
+		}
+	}
+	return stats.Usage
+}
+
+// execOutput runs a helper command in the container and returns its combined output
+// and exit code.
+func execOutput(ctx context.Context, cli *client.Client, containerID string, cmd []string) (string, int, error) {
+	execID, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	execResp, err := cli.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", 0, err
+	}
+	defer execResp.Close()
+
+	// Reading to EOF waits for the command to exit before its exit code is inspected
+	var output bytes.Buffer
+	stdcopy.StdCopy(&output, &output, execResp.Reader)
+	inspect, err := cli.ContainerExecInspect(ctx, execID.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	return output.String(), inspect.ExitCode, nil
+}
+
+// fileExists reports whether path, relative to /app, is a regular file in the container.
+func fileExists(ctx context.Context, cli *client.Client, containerID, path string) (bool, error) {
+	_, exitCode, err := execOutput(ctx, cli, containerID, []string{"test", "-f", path})
+	return err == nil && exitCode == 0, err
+}
+
+// diskUsageKB returns the apparent size of everything under /app in KB.
+func diskUsageKB(ctx context.Context, cli *client.Client, containerID string) (int64, error) {
+	output, exitCode, err := execOutput(ctx, cli, containerID, []string{"du", "-sk", "--apparent-size", "/app"})
+	if err != nil {
+		return 0, err
+	}
+	if exitCode != 0 {
+		return 0, fmt.Errorf("du exited with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+	return parseDiskUsage(output)
+}
+
+// parseDiskUsage parses the size column of du's summary line.
+func parseDiskUsage(output string) (int64, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected du output %q", output)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected du output %q: %w", output, err)
+	}
+	return size, nil
+}
+
+// recordCommands sets the result's command lines in debug mode.
+func recordCommands(result *ExecutionResult, config LanguageConfig, req RunRequest) {
+	if !cfg.Debug {
+		return
+	}
+	if config.CompileCmd != nil {
+		result.CompileCommand = commandLine(buildCompileCmd(config, req))
+	}
+	result.ExecuteCommand = commandLine(buildExecuteCmd(config, req))
+}
+
+// commandLine joins a command into a line that a POSIX shell splits back into the
+// same arguments, single-quoting those that need it.
+func commandLine(cmd []string) string {
+	quoted := make([]string, len(cmd))
+	for i, arg := range cmd {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=./:,@") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// buildCompileCmd returns the language's compile command, with its warning flags
+// inserted after the compiler name when compile warnings are enabled, and its debug
+// flags for a debug build.
+func buildCompileCmd(config LanguageConfig, req RunRequest) []string {
+	var flags []string
+	if cfg.CompileWarnings {
+		flags = append(flags, config.WarningFlags...)
+	}
+	if req.DebugBuild {
+		flags = append(flags, config.DebugFlags...)
+	}
+	if len(flags) == 0 {
+		return config.CompileCmd
+	}
+	cmd := []string{config.CompileCmd[0]}
+	cmd = append(cmd, flags...)
+	return append(cmd, config.CompileCmd[1:]...)
+}
+
+// syntaxCheck reports whether the request's source is syntax-checked before it runs.
+func syntaxCheck(config LanguageConfig, req RunRequest) bool {
+	return cfg.SyntaxCheck && config.CompileCmd == nil && len(config.SyntaxCheckCmd) > 0 && !req.SkipSyntaxCheck
+}
+
+// inputFile is the name, under /app, of the input file stdin is redirected from.
+const inputFile = "input.txt"
+
+// useStdinFile reports whether the request's input is fed by redirecting stdin from
+// /app/input.txt rather than writing it through the exec connection.
+func useStdinFile(req RunRequest) bool {
+	return !req.Interactive && cfg.StdinMode != StdinPipe
+}
+
+// captureTimeline reports whether the run's output is streamed back and recorded in a
+// timeline instead of being redirected to files, which debug mode does for runs without
+// an output line limit.
+func captureTimeline(req RunRequest) bool {
+	return cfg.Debug && req.MaxOutputLines == 0
+}
+
+// buildExecuteCmd wraps the language's execute command in a shell that redirects
+// stdout/stderr to files in /app, and stdin from /app/input.txt unless the input is
+// piped in. The redirection is set up by the shell before the program starts, so
+// every byte the program hands to the kernel is captured even if it is killed
+// afterwards; only data still sitting in the program's own stdio buffers is lost on
+// an abnormal exit, which UnbufferedOutput guards against via stdbuf.
+// The shell execs the program so that it does not count towards the thread total.
+//
+// With an output line limit, stdout goes through head instead, which exits after
+// one line past the limit so that the program is stopped by SIGPIPE on its next
+// write. Since the pipeline's status is head's, the program's exit status is echoed
+// to the shell over fd 3, which is closed for the program so that it cannot forge it.
+//
+// When capturing a timeline, stdout and stderr are left connected to the exec
+// connection instead.
+func buildExecuteCmd(config LanguageConfig, req RunRequest) []string {
+	command := strings.Join(config.ExecuteCmd, " ")
+	if cfg.UnbufferedOutput {
+		command = "stdbuf -o0 -e0 " + command
+	}
+	if useStdinFile(req) {
+		command += " < /app/" + inputFile
+	}
+	if req.MaxOutputLines > 0 {
+		return []string{"sh", "-c", fmt.Sprintf(
+			"status=$({ { %s 3>&- 2> /app/stderr.txt; echo $? >&3; } | head -n %d > /app/stdout.txt; } 3>&1); exit $status",
+			command, req.MaxOutputLines+1)}
+	}
+	if captureTimeline(req) {
+		return []string{"sh", "-c", "exec " + command}
+	}
+	return []string{"sh", "-c", "exec " + command + " > /app/stdout.txt 2> /app/stderr.txt"}
+}
+
+// outputLimitTasks is how many tasks the output-limiting pipeline adds next to the
+// program: the shell, the command substitution reading the exit status, the subshell
+// that runs the program and head.
+const outputLimitTasks = 4
+
+// countLines returns how many lines the output has, counting a final line without a
+// trailing newline.
+func countLines(output string) int {
+	lines := strings.Count(output, "\n")
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		lines++
+	}
+	return lines
+}
+
+// debugMemoryFactor scales the memory limit of a debug build: the sanitizer's shadow
+// memory and redzones take two to three times the program's own memory.
+const debugMemoryFactor = 3
+
+// runMemoryBytes returns the memory limit of a run. A debug build gets debugMemoryFactor
+// times the requested limit, so that the sanitizer's overhead does not make a program
+// within its limit fail with MEMORY_LIMIT_EXCEEDED or crash.
+func runMemoryBytes(config LanguageConfig, req RunRequest) int64 {
+	if req.DebugBuild && len(config.DebugFlags) > 0 {
+		return req.MemoryLimitBytes * debugMemoryFactor
+	}
+	return req.MemoryLimitBytes
+}
+
+// buildExecuteEnv returns the environment for the execution step. Interpreters that
+// manage their own buffers (Python) ignore stdbuf and need to be told explicitly, and
+// a debug build's sanitizer is told what it cannot do in a container.
+func buildExecuteEnv(req RunRequest) []string {
+	var env []string
+	if cfg.UnbufferedOutput {
+		env = append(env, "PYTHONUNBUFFERED=1")
+	}
+	if req.DebugBuild {
+		// The leak checker needs ptrace, which containers do not allow
+		env = append(env, "ASAN_OPTIONS=detect_leaks=0")
+	}
+	return env
+}
+
 // copyFileToContainer copies a file from the host to the container using Docker's CopyToContainer API
 func copyFileToContainer(cli *client.Client, ctx context.Context, containerID, hostFilePath, containerFileName string, submissionID int64) error {
 	// Read the source file content
@@ -4,6 +4,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/docker/docker/api/types"
 )
 
 func TestLanguageConfigs(t *testing.T) {
@@ -13,6 +15,7 @@ func TestLanguageConfigs(t *testing.T) {
 	}{
 		{"JAVA", true},
 		{"PYTHON", true},
+		{"C", true},
 		{"CPP", true},
 		{"JAVASCRIPT", false},
 		{"GOLANG", false},
@@ -41,6 +44,9 @@ func TestLanguageConfigsStructure(t *testing.T) {
 			if len(config.ExecuteCmd) == 0 {
 				t.Error("ExecuteCmd should not be empty")
 			}
+			if config.CompileCmd != nil && config.Binary == "" {
+				t.Error("Binary should be set for compiled languages")
+			}
 		})
 	}
 }
@@ -207,3 +213,329 @@ func TestOutputTrimming(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildExecuteCmd(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name       string
+		unbuffered bool
+		req        RunRequest
+		language   string
+		want       string
+		wantEnv    []string
+	}{
+		{"buffered cpp", false, RunRequest{Interactive: true}, "CPP", "exec ./main > /app/stdout.txt 2> /app/stderr.txt", nil},
+		{"unbuffered cpp", true, RunRequest{Interactive: true}, "CPP", "exec stdbuf -o0 -e0 ./main > /app/stdout.txt 2> /app/stderr.txt", []string{"PYTHONUNBUFFERED=1"}},
+		{"unbuffered python", true, RunRequest{Interactive: true}, "PYTHON", "exec stdbuf -o0 -e0 python main.py > /app/stdout.txt 2> /app/stderr.txt", []string{"PYTHONUNBUFFERED=1"}},
+		{"stdin from file", false, RunRequest{}, "CPP", "exec ./main < /app/input.txt > /app/stdout.txt 2> /app/stderr.txt", nil},
+		{"output line limit", false, RunRequest{MaxOutputLines: 100}, "CPP",
+			"status=$({ { ./main < /app/input.txt 3>&- 2> /app/stderr.txt; echo $? >&3; } | head -n 101 > /app/stdout.txt; } 3>&1); exit $status", nil},
+		{"debug build", false, RunRequest{DebugBuild: true}, "CPP", "exec ./main < /app/input.txt > /app/stdout.txt 2> /app/stderr.txt", []string{"ASAN_OPTIONS=detect_leaks=0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(Config{UnbufferedOutput: tt.unbuffered})
+
+			cmd := buildExecuteCmd(langConfigs[tt.language], tt.req)
+			if len(cmd) != 3 || cmd[0] != "sh" || cmd[1] != "-c" {
+				t.Fatalf("buildExecuteCmd() = %v, want [sh -c ...]", cmd)
+			}
+			if cmd[2] != tt.want {
+				t.Errorf("shell command = %q, want %q", cmd[2], tt.want)
+			}
+
+			env := buildExecuteEnv(tt.req)
+			if strings.Join(env, ",") != strings.Join(tt.wantEnv, ",") {
+				t.Errorf("buildExecuteEnv() = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		output string
+		want   int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a\n", 1},
+		{"a\nb", 2},
+		{"a\nb\n", 2},
+		{"\n\n", 2},
+	}
+	for _, tt := range tests {
+		if got := countLines(tt.output); got != tt.want {
+			t.Errorf("countLines(%q) = %d, want %d", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	if got, err := parseDiskUsage("1028\t/app\n"); err != nil || got != 1028 {
+		t.Errorf("parseDiskUsage() = %d, %v, want 1028", got, err)
+	}
+	for _, output := range []string{"", "du: cannot access '/app'\n"} {
+		if _, err := parseDiskUsage(output); err == nil {
+			t.Errorf("parseDiskUsage(%q) succeeded, want an error", output)
+		}
+	}
+}
+
+func TestUseStdinFile(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name        string
+		mode        string
+		interactive bool
+		want        bool
+	}{
+		{"default", DefaultConfig().StdinMode, false, true},
+		{"pipe mode", StdinPipe, false, false},
+		{"interactive", StdinFile, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(Config{StdinMode: tt.mode})
+			if got := useStdinFile(RunRequest{Interactive: tt.interactive}); got != tt.want {
+				t.Errorf("useStdinFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyntaxCheck(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		language string
+		skip     bool
+		want     bool
+	}{
+		{"disabled", false, "PYTHON", false, false},
+		{"interpreted", true, "PYTHON", false, true},
+		{"already checked", true, "PYTHON", true, false},
+		{"compiled", true, "CPP", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(Config{SyntaxCheck: tt.enabled})
+			if got := syntaxCheck(langConfigs[tt.language], RunRequest{SkipSyntaxCheck: tt.skip}); got != tt.want {
+				t.Errorf("syntaxCheck() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCompileCmd(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name     string
+		warnings bool
+		debug    bool
+		language string
+		want     string
+	}{
+		{"cpp without warnings", false, false, "CPP", "g++ main.cpp -o main"},
+		{"cpp with warnings", true, false, "CPP", "g++ -Wall -Wextra main.cpp -o main"},
+		{"java with warnings", true, false, "JAVA", "javac -Xlint:all Main.java"},
+		{"cpp debug build", false, true, "CPP", "g++ -g -fsanitize=address -fno-omit-frame-pointer main.cpp -o main"},
+		{"cpp debug build with warnings", true, true, "CPP", "g++ -Wall -Wextra -g -fsanitize=address -fno-omit-frame-pointer main.cpp -o main"},
+		{"c debug build", false, true, "C", "gcc -g -fsanitize=address -fno-omit-frame-pointer main.c -o main"},
+		{"java debug build", false, true, "JAVA", "javac Main.java"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(Config{CompileWarnings: tt.warnings})
+
+			cmd := strings.Join(buildCompileCmd(langConfigs[tt.language], RunRequest{DebugBuild: tt.debug}), " ")
+			if cmd != tt.want {
+				t.Errorf("buildCompileCmd() = %q, want %q", cmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunMemoryBytes(t *testing.T) {
+	const limit = 64 * 1024 * 1024
+	tests := []struct {
+		language string
+		debug    bool
+		want     int64
+	}{
+		{"CPP", false, limit},
+		{"CPP", true, limit * debugMemoryFactor},
+		{"C", true, limit * debugMemoryFactor},
+		{"JAVA", true, limit}, // No DebugFlags, so no sanitizer
+	}
+
+	for _, tt := range tests {
+		got := runMemoryBytes(langConfigs[tt.language], RunRequest{MemoryLimitBytes: limit, DebugBuild: tt.debug})
+		if got != tt.want {
+			t.Errorf("runMemoryBytes(%s, DebugBuild: %v) = %d, want %d", tt.language, tt.debug, got, tt.want)
+		}
+	}
+}
+
+func TestLanguageConfigWarningFlags(t *testing.T) {
+	defer Configure(DefaultConfig())
+	Configure(Config{CompileWarnings: true, WarningFlags: map[string][]string{"CPP": {"-Wall", "-Wshadow"}, "JAVA": {}}})
+
+	tests := map[string]string{
+		"CPP":  "g++ -Wall -Wshadow main.cpp -o main",
+		"JAVA": "javac Main.java",
+	}
+	for language, want := range tests {
+		if cmd := strings.Join(buildCompileCmd(languageConfig(language), RunRequest{}), " "); cmd != want {
+			t.Errorf("%s compile command = %q, want %q", language, cmd, want)
+		}
+	}
+	if flags := langConfigs["CPP"].WarningFlags; len(flags) != 2 || flags[1] != "-Wextra" {
+		t.Errorf("built-in CPP warning flags = %v, want them left as they were", flags)
+	}
+}
+
+func TestRecordCommands(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	result := &ExecutionResult{}
+	Configure(Config{CompileWarnings: true})
+	recordCommands(result, langConfigs["CPP"], RunRequest{})
+	if result.CompileCommand != "" || result.ExecuteCommand != "" {
+		t.Errorf("commands = %q, %q, want none outside debug mode", result.CompileCommand, result.ExecuteCommand)
+	}
+
+	Configure(Config{CompileWarnings: true, Debug: true})
+	recordCommands(result, langConfigs["CPP"], RunRequest{})
+	if want := "g++ -Wall -Wextra main.cpp -o main"; result.CompileCommand != want {
+		t.Errorf("CompileCommand = %q, want %q", result.CompileCommand, want)
+	}
+	// Debug mode streams the output back for the timeline instead of redirecting it
+	if want := "sh -c 'exec ./main < /app/input.txt'"; result.ExecuteCommand != want {
+		t.Errorf("ExecuteCommand = %q, want %q", result.ExecuteCommand, want)
+	}
+
+	result = &ExecutionResult{}
+	recordCommands(result, langConfigs["PYTHON"], RunRequest{Interactive: true})
+	if result.CompileCommand != "" {
+		t.Errorf("CompileCommand = %q, want none for an interpreted language", result.CompileCommand)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"g++", "-std=c++20", "main.cpp"}, "g++ -std=c++20 main.cpp"},
+		{[]string{"sh", "-c", "exec ./main"}, "sh -c 'exec ./main'"},
+		{[]string{"echo", "it's", ""}, `echo 'it'\''s' ''`},
+	}
+	for _, tt := range tests {
+		if got := commandLine(tt.cmd); got != tt.want {
+			t.Errorf("commandLine(%q) = %s, want %s", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestResolveLanguage(t *testing.T) {
+	defer Configure(DefaultConfig())
+	config := DefaultConfig()
+	config.LanguageAliases = map[string]string{"pypy": "PYTHON", "cobol": "COBOL"}
+	Configure(config)
+
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"PYTHON", "PYTHON", true},
+		{"python", "PYTHON", true},
+		{"python3", "PYTHON", true},
+		{"py", "PYTHON", true},
+		{"c++", "CPP", true},
+		{"cpp", "CPP", true},
+		{"G++", "CPP", true},
+		{"Java", "JAVA", true},
+		{"pypy", "PYTHON", true},
+		{"cobol", "", false}, // configured alias for an unsupported language
+		{"brainfuck", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ResolveLanguage(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ResolveLanguage(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRunUnknownLanguage(t *testing.T) {
+	_, err := Run(RunRequest{Language: "brainfuck", Code: "+", TimeLimitSeconds: 1, MemoryLimitBytes: 1 << 20})
+	if err == nil || err.Error() != "unsupported language: brainfuck" {
+		t.Errorf("Run() error = %v, want unsupported language", err)
+	}
+}
+
+func TestProgramMemoryBytes(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name  string
+		stats types.MemoryStats
+		want  uint64
+	}{
+		{"cgroup v2 excludes file cache", types.MemoryStats{Usage: 300 * mb, Stats: map[string]uint64{"anon": 20 * mb, "file": 280 * mb}}, 20 * mb},
+		{"cgroup v1 hierarchical rss", types.MemoryStats{Usage: 300 * mb, Stats: map[string]uint64{"total_rss": 25 * mb, "rss": 24 * mb, "cache": 275 * mb}}, 25 * mb},
+		{"cgroup v1 rss", types.MemoryStats{Usage: 300 * mb, Stats: map[string]uint64{"rss": 24 * mb, "cache": 276 * mb}}, 24 * mb},
+		{"no breakdown falls back to usage", types.MemoryStats{Usage: 300 * mb}, 300 * mb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := programMemoryBytes(tt.stats); got != tt.want {
+				t.Errorf("programMemoryBytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitSignal(t *testing.T) {
+	tests := []struct {
+		exitCode int
+		want     int
+	}{
+		{0, 0},
+		{1, 0},
+		{128, 0},
+		{134, 6},  // SIGABRT, e.g. a failed assertion
+		{137, 9},  // SIGKILL
+		{139, 11}, // SIGSEGV
+		{255, 0},
+	}
+	for _, tt := range tests {
+		if got := exitSignal(tt.exitCode); got != tt.want {
+			t.Errorf("exitSignal(%d) = %d, want %d", tt.exitCode, got, tt.want)
+		}
+	}
+}
+
+func TestCPUMillis(t *testing.T) {
+	if got := cpuMillis(5e9, 5e9+1234e6); got != 1234 {
+		t.Errorf("cpuMillis() = %d, want 1234", got)
+	}
+	if got := cpuMillis(5e9, 0); got != 0 {
+		t.Errorf("cpuMillis() without a sample = %d, want 0", got)
+	}
+}
@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scratchDirPrefix is the name prefix of the per-run host directories holding source code.
+const scratchDirPrefix = "online-judge-"
+
+// newScratchDir creates a per-run scratch directory under the configured base directory.
+func newScratchDir() (string, error) {
+	return ioutil.TempDir(cfg.ScratchDir, scratchDirPrefix)
+}
+
+// SweepScratchDirs removes scratch directories under baseDir that are older than maxAge.
+// Runs clean up after themselves, so anything this finds was leaked by a crashed executor.
+// An empty baseDir means the system temp directory. It returns the number of directories removed.
+func SweepScratchDirs(baseDir string, maxAge time.Duration) (int, error) {
+	if baseDir == "" {
+		baseDir = os.TempDir()
+	}
+
+	entries, err := ioutil.ReadDir(baseDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list scratch directory %s: %w", baseDir, err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), scratchDirPrefix) {
+			continue
+		}
+		if entry.ModTime().After(cutoff) {
+			continue
+		}
+		path := filepath.Join(baseDir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Failed to remove stale scratch directory %s: %v", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSweepScratchDirs(t *testing.T) {
+	baseDir := t.TempDir()
+
+	stale := filepath.Join(baseDir, scratchDirPrefix+"stale")
+	recent := filepath.Join(baseDir, scratchDirPrefix+"recent")
+	unrelated := filepath.Join(baseDir, "other-stale")
+	for _, dir := range []string{stale, recent, unrelated} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(stale, "main.py"), []byte("print(1)"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, dir := range []string{stale, unrelated} {
+		if err := os.Chtimes(dir, old, old); err != nil {
+			t.Fatalf("failed to age %s: %v", dir, err)
+		}
+	}
+
+	removed, err := SweepScratchDirs(baseDir, time.Hour)
+	if err != nil {
+		t.Fatalf("SweepScratchDirs failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale scratch directory should have been removed")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Error("recent scratch directory should have been preserved")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Error("directory without the scratch prefix should have been preserved")
+	}
+}
+
+func TestSweepScratchDirsMissingBaseDir(t *testing.T) {
+	_, err := SweepScratchDirs(filepath.Join(t.TempDir(), "missing"), time.Hour)
+	if err == nil {
+		t.Error("expected error for missing base directory, got nil")
+	}
+}
+
+func TestNewScratchDirUsesConfiguredBase(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	baseDir := t.TempDir()
+	Configure(Config{ScratchDir: baseDir})
+
+	dir, err := newScratchDir()
+	if err != nil {
+		t.Fatalf("newScratchDir failed: %v", err)
+	}
+	if filepath.Dir(dir) != baseDir {
+		t.Errorf("scratch dir parent = %s, want %s", filepath.Dir(dir), baseDir)
+	}
+	if !strings.HasPrefix(filepath.Base(dir), scratchDirPrefix) {
+		t.Errorf("scratch dir name = %s, want prefix %s", filepath.Base(dir), scratchDirPrefix)
+	}
+}
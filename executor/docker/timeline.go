@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeline records the program's stdout and stderr as they arrive over the exec
+// connection, one line per entry with the time since the program started, so that
+// the interleaving of the two streams can be reconstructed when debugging.
+type timeline struct {
+	start time.Time
+
+	mu      sync.Mutex
+	entries []timelineEntry
+	partial map[string]*timelineEntry // of stream, the line still being written
+	streams map[string]*bytes.Buffer  // of stream, everything written to it
+}
+
+type timelineEntry struct {
+	at     time.Duration // when the line's first byte arrived
+	stream string
+	line   string
+}
+
+func newTimeline(start time.Time) *timeline {
+	return &timeline{
+		start:   start,
+		partial: make(map[string]*timelineEntry),
+		streams: map[string]*bytes.Buffer{"stdout": {}, "stderr": {}},
+	}
+}
+
+// writer returns a writer recording into the named stream.
+func (t *timeline) writer(stream string) *timelineWriter {
+	return &timelineWriter{timeline: t, stream: stream}
+}
+
+type timelineWriter struct {
+	timeline *timeline
+	stream   string
+}
+
+func (w *timelineWriter) Write(p []byte) (int, error) {
+	w.timeline.record(w.stream, string(p), time.Now())
+	return len(p), nil
+}
+
+func (t *timeline) record(stream, data string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.streams[stream].WriteString(data)
+	for data != "" {
+		entry := t.partial[stream]
+		if entry == nil {
+			entry = &timelineEntry{at: now.Sub(t.start), stream: stream}
+			t.partial[stream] = entry
+		}
+		line, rest, complete := strings.Cut(data, "\n")
+		entry.line += line
+		data = rest
+		if complete {
+			t.entries = append(t.entries, *entry)
+			delete(t.partial, stream)
+		}
+	}
+}
+
+// output returns everything written to the named stream.
+func (t *timeline) output(stream string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.streams[stream].String()
+}
+
+// String formats the timeline as "[  0.012s] stdout: line" lines in arrival order,
+// ending with any unterminated last lines.
+func (t *timeline) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := append([]timelineEntry(nil), t.entries...)
+	for _, stream := range []string{"stdout", "stderr"} {
+		if entry := t.partial[stream]; entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "[%8.3fs] %s: %s\n", entry.at.Seconds(), entry.stream, entry.line)
+	}
+	return b.String()
+}
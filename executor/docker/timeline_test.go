@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeline(t *testing.T) {
+	start := time.Now()
+	timeline := newTimeline(start)
+
+	timeline.record("stdout", "n = 3\npart", start.Add(10*time.Millisecond))
+	timeline.record("stderr", "warning\n", start.Add(20*time.Millisecond))
+	timeline.record("stdout", "ial\n", start.Add(30*time.Millisecond))
+	timeline.record("stdout", "no newline", start.Add(1500*time.Millisecond))
+
+	want := "[   0.010s] stdout: n = 3\n" +
+		"[   0.020s] stderr: warning\n" +
+		"[   0.010s] stdout: partial\n" +
+		"[   1.500s] stdout: no newline\n"
+	if got := timeline.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := timeline.output("stdout"); got != "n = 3\npartial\nno newline" {
+		t.Errorf("stdout = %q, want everything written to it", got)
+	}
+	if got := timeline.output("stderr"); got != "warning\n" {
+		t.Errorf("stderr = %q, want everything written to it", got)
+	}
+}
+
+func TestBuildExecuteCmdCapturesTimelineInDebugMode(t *testing.T) {
+	defer Configure(DefaultConfig())
+
+	tests := []struct {
+		name  string
+		debug bool
+		req   RunRequest
+		want  string
+	}{
+		{"split files outside debug mode", false, RunRequest{}, "exec ./main < /app/input.txt > /app/stdout.txt 2> /app/stderr.txt"},
+		{"streamed in debug mode", true, RunRequest{}, "exec ./main < /app/input.txt"},
+		{"output line limit keeps files", true, RunRequest{MaxOutputLines: 1},
+			"status=$({ { ./main < /app/input.txt 3>&- 2> /app/stderr.txt; echo $? >&3; } | head -n 2 > /app/stdout.txt; } 3>&1); exit $status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Debug = tt.debug
+			Configure(config)
+
+			if cmd := buildExecuteCmd(langConfigs["CPP"], tt.req); cmd[2] != tt.want {
+				t.Errorf("shell command = %q, want %q", cmd[2], tt.want)
+			}
+			if got, want := captureTimeline(tt.req), tt.want == "exec ./main < /app/input.txt"; got != want {
+				t.Errorf("captureTimeline() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// warmKey identifies containers that are interchangeable: the same language image
+// created with the same resource limits.
+type warmKey struct {
+	language    string
+	memoryBytes int64
+	nanoCPUs    int64
+	limits      ResourceLimits
+}
+
+// warmPool holds idle containers of interpreted languages for reuse by later
+// submissions. A container is only put back after resetContainer has wiped it.
+type warmPool struct {
+	mu   sync.Mutex
+	idle map[warmKey][]warmContainer
+}
+
+// warmContainer is a pooled container and when its keepalive ends. Like any other
+// container it stops by itself then; the pool hands it out for removal the next time
+// it is looked at, and the reaper removes it should the executor have crashed before.
+type warmContainer struct {
+	id      string
+	expires time.Time
+}
+
+func newWarmPool() *warmPool {
+	return &warmPool{idle: make(map[warmKey][]warmContainer)}
+}
+
+// take borrows an idle container that lives at least until the given time, if there
+// is one. Containers expiring sooner are dropped from the pool and returned as
+// expired, for the caller to remove.
+func (p *warmPool) take(key warmKey, until time.Time) (c warmContainer, ok bool, expired []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for idle := p.idle[key]; len(idle) > 0; idle = p.idle[key] {
+		c = idle[len(idle)-1]
+		p.idle[key] = idle[:len(idle)-1]
+		if c.expires.After(until) {
+			return c, true, expired
+		}
+		expired = append(expired, c.id)
+	}
+	return warmContainer{}, false, expired
+}
+
+// put returns a reset container to the pool.
+func (p *warmPool) put(key warmKey, c warmContainer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle[key] = append(p.idle[key], c)
+}
+
+// drain empties the pool and returns the containers that were in it.
+func (p *warmPool) drain() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []string
+	for key, idle := range p.idle {
+		for _, c := range idle {
+			ids = append(ids, c.id)
+		}
+		delete(p.idle, key)
+	}
+	return ids
+}
+
+var warm = newWarmPool()
+
+// resetDirs are the writable locations a program may leave files in. They are emptied
+// between tenants of a reused container.
+const resetDirs = "/app /tmp /var/tmp /dev/shm"
+
+// resetCmd kills every process except the keepalive (kill -1 spares the container's
+// init and the shell itself), deletes everything under resetDirs and fails unless
+// they are then empty.
+var resetCmd = []string{"sh", "-c",
+	"kill -9 -1 2>/dev/null; find " + resetDirs + " -mindepth 1 -delete; test -z \"$(find " + resetDirs + " -mindepth 1)\""}
+
+// resetContainer wipes a container so that the next submission run in it cannot see
+// anything of the previous one. Programs run as root on a writable filesystem, so one
+// could also have changed the image's files (e.g. planted a sitecustomize.py for the
+// next tenant's interpreter to load); such a container cannot be reset and is refused.
+func resetContainer(ctx context.Context, cli *client.Client, containerID string) error {
+	output, exitCode, err := execOutput(ctx, cli, containerID, resetCmd)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("reset exited with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+	changes, err := cli.ContainerDiff(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to list filesystem changes: %w", err)
+	}
+	if outside := changesOutsideResetDirs(changes); len(outside) > 0 {
+		return fmt.Errorf("filesystem changed outside %s: %s", resetDirs, strings.Join(outside, ", "))
+	}
+	return nil
+}
+
+// changesOutsideResetDirs returns the changed paths that the reset does not wipe. The
+// directories leading to the reset locations (e.g. /var for /var/tmp) show up as
+// changed along with them, and are fine by themselves.
+func changesOutsideResetDirs(changes []container.ContainerChangeResponseItem) []string {
+	var outside []string
+	for _, change := range changes {
+		if !withinResetDirs(change.Path) {
+			outside = append(outside, change.Path)
+		}
+	}
+	return outside
+}
+
+func withinResetDirs(path string) bool {
+	for _, dir := range strings.Fields(resetDirs) {
+		if path == dir || strings.HasPrefix(path, dir+"/") || strings.HasPrefix(dir, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// containerRemover is the part of the Docker client used to remove pooled containers.
+type containerRemover interface {
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+}
+
+// removeContainers force-removes the given containers and returns how many were removed.
+func removeContainers(ctx context.Context, cli containerRemover, ids []string) int {
+	removed := 0
+	for _, id := range ids {
+		if err := cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true}); err != nil {
+			log.Printf("Failed to remove warm container %s: %v", id, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// RemoveWarmContainers removes the idle reusable containers, e.g. on shutdown. It
+// returns how many were removed.
+func RemoveWarmContainers() (int, error) {
+	ids := warm.drain()
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	return removeContainers(context.Background(), cli, ids), nil
+}
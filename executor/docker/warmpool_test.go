@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestWarmPool(t *testing.T) {
+	pool := newWarmPool()
+	python := warmKey{language: "PYTHON", memoryBytes: 64 << 20}
+	pythonLarge := warmKey{language: "PYTHON", memoryBytes: 256 << 20}
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	if _, ok, _ := pool.take(python, now); ok {
+		t.Fatal("take() from an empty pool succeeded")
+	}
+
+	pool.put(python, warmContainer{"c1", later})
+	pool.put(python, warmContainer{"c2", later})
+	pool.put(pythonLarge, warmContainer{"c3", later})
+
+	// Containers with other limits are not interchangeable.
+	if c, ok, _ := pool.take(pythonLarge, now); !ok || c.id != "c3" {
+		t.Errorf("take(256MB) = %q, %v, want c3", c.id, ok)
+	}
+	if _, ok, _ := pool.take(pythonLarge, now); ok {
+		t.Error("take(256MB) lent the same container twice")
+	}
+	if c, ok, _ := pool.take(python, now); !ok || c.id != "c2" {
+		t.Errorf("take(64MB) = %q, %v, want the most recently returned c2", c.id, ok)
+	}
+
+	pool.put(pythonLarge, warmContainer{"c4", later})
+	ids := pool.drain()
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "c1" || ids[1] != "c4" {
+		t.Errorf("drain() = %v, want [c1 c4]", ids)
+	}
+	if _, ok, _ := pool.take(python, now); ok {
+		t.Error("take() after drain() succeeded")
+	}
+}
+
+func TestWarmPoolSkipsExpiringContainers(t *testing.T) {
+	pool := newWarmPool()
+	python := warmKey{language: "PYTHON", memoryBytes: 64 << 20}
+	now := time.Now()
+
+	pool.put(python, warmContainer{"lasting", now.Add(time.Hour)})
+	pool.put(python, warmContainer{"expiring", now.Add(time.Minute)})
+
+	// A run that would outlive the most recently returned container gets the other one
+	c, ok, expired := pool.take(python, now.Add(5*time.Minute))
+	if !ok || c.id != "lasting" {
+		t.Errorf("take() = %q, %v, want the container that outlives the run", c.id, ok)
+	}
+	if !reflect.DeepEqual(expired, []string{"expiring"}) {
+		t.Errorf("take() expired %v, want [expiring] handed out for removal", expired)
+	}
+	if ids := pool.drain(); len(ids) != 0 {
+		t.Errorf("drain() = %v, want the expiring container dropped from the pool", ids)
+	}
+}
+
+func TestRemoveContainers(t *testing.T) {
+	daemon := &fakeDaemon{}
+	if removed := removeContainers(context.Background(), daemon, []string{"expired1", "expired2"}); removed != 2 {
+		t.Errorf("removeContainers() = %d, want 2", removed)
+	}
+	if !reflect.DeepEqual(daemon.removed, []string{"expired1", "expired2"}) {
+		t.Errorf("removed %v, want both expired containers", daemon.removed)
+	}
+}
+
+func TestChangesOutsideResetDirs(t *testing.T) {
+	changes := []container.ContainerChangeResponseItem{
+		{Kind: 0, Path: "/app"},
+		{Kind: 1, Path: "/var"},
+		{Kind: 0, Path: "/var/tmp"},
+		{Kind: 1, Path: "/usr"},
+		{Kind: 1, Path: "/usr/lib/python3/site-packages/sitecustomize.py"},
+		{Kind: 1, Path: "/root/.bashrc"},
+		{Kind: 2, Path: "/etc/passwd"},
+		{Kind: 1, Path: "/application"},
+	}
+
+	got := changesOutsideResetDirs(changes)
+	want := []string{"/usr", "/usr/lib/python3/site-packages/sitecustomize.py", "/root/.bashrc", "/etc/passwd", "/application"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changesOutsideResetDirs() = %v, want %v", got, want)
+	}
+	if got := changesOutsideResetDirs(changes[:3]); len(got) != 0 {
+		t.Errorf("changesOutsideResetDirs() = %v for changes the reset wipes, want none", got)
+	}
+}
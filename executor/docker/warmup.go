@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// WarmUpImages pulls the image of every supported language, so that the first
+// submissions do not wait for the pulls. It first waits a random delay below jitter:
+// replicas started together by a deploy then spread their pulls out instead of all
+// hitting the registry at once. Failed pulls are logged; Run retries them anyway.
+func WarmUpImages(jitter time.Duration) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Printf("Failed to create docker client for the image warm-up: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	warmUp(languageImages(), jitter, randomDelay, time.Sleep, func(image string) error {
+		reader, err := cli.ImagePull(context.Background(), image, types.ImagePullOptions{})
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(ioutil.Discard, reader) // Wait for the pull to complete
+		return err
+	})
+}
+
+// warmUp sleeps for delay(jitter), then pulls each image in turn.
+func warmUp(images []string, jitter time.Duration, delay func(time.Duration) time.Duration, sleep func(time.Duration), pull func(string) error) {
+	if wait := delay(jitter); wait > 0 {
+		log.Printf("Waiting %v before warming up %d images.", wait.Round(time.Millisecond), len(images))
+		sleep(wait)
+	}
+	for _, image := range images {
+		if err := pull(image); err != nil {
+			log.Printf("Failed to warm up image %s: %v", image, err)
+			continue
+		}
+		log.Printf("Warmed up image %s.", image)
+	}
+}
+
+// randomDelay returns a uniformly random duration in [0, jitter). It seeds its own
+// source, as the default one would give every replica the same delay.
+func randomDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	source := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return time.Duration(source.Int63n(int64(jitter)))
+}
+
+// languageImages returns the distinct images of the supported languages, sorted.
+func languageImages() []string {
+	seen := make(map[string]bool, len(langConfigs))
+	var images []string
+	for _, config := range langConfigs {
+		for _, image := range []string{config.Image, runImage(config)} {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
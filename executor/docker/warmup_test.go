@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmUpWaitsForJitterBeforePulling(t *testing.T) {
+	const jitter = 30 * time.Second
+	var events []string
+	var slept time.Duration
+	sleep := func(d time.Duration) {
+		slept = d
+		events = append(events, "sleep")
+	}
+	pull := func(image string) error {
+		events = append(events, "pull "+image)
+		if image == "broken" {
+			return errors.New("registry unavailable")
+		}
+		return nil
+	}
+
+	warmUp([]string{"broken", "gcc:latest"}, jitter, randomDelay, sleep, pull)
+
+	if got := strings.Join(events, ", "); got != "sleep, pull broken, pull gcc:latest" {
+		t.Errorf("events = %s, want the jitter sleep before every pull", got)
+	}
+	if slept < 0 || slept >= jitter {
+		t.Errorf("slept %v, want below the %v jitter", slept, jitter)
+	}
+}
+
+func TestRandomDelayRespectsJitter(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if d := randomDelay(time.Second); d < 0 || d >= time.Second {
+			t.Fatalf("randomDelay(1s) = %v, want in [0, 1s)", d)
+		}
+	}
+	if d := randomDelay(0); d != 0 {
+		t.Errorf("randomDelay(0) = %v, want no delay", d)
+	}
+}
+
+func TestLanguageImages(t *testing.T) {
+	if got := strings.Join(languageImages(), ","); got != "gcc:latest,openjdk:11-jdk-slim,python:3.9-slim" {
+		t.Errorf("languageImages() = %s, want the three language images", got)
+	}
+}
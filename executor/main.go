@@ -1,14 +1,23 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"online-judge/executor/docker"
 	"online-judge/executor/master"
 	"online-judge/executor/rabbitmq"
+	"online-judge/executor/types"
+	"online-judge/executor/version"
+	"online-judge/executor/worker"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 const (
@@ -36,7 +45,50 @@ func main() {
 
 	log.Println("RabbitMQ client initialized.")
 
-	master, err := master.NewMaster(mqClient, workerCount, submissionQueue)
+	dockerConfig := loadDockerConfig()
+	docker.Configure(dockerConfig)
+	if removed, err := docker.SweepScratchDirs(dockerConfig.ScratchDir, dockerConfig.ScratchMaxAge); err != nil {
+		log.Printf("Failed to sweep stale scratch directories: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d stale scratch directories.", removed)
+	}
+
+	if dockerConfig.WarmUpImages {
+		go docker.WarmUpImages(dockerConfig.WarmUpJitter)
+	}
+	if dockerConfig.ReaperInterval > 0 {
+		go docker.RunReaper(dockerConfig.ReaperInterval, nil)
+	}
+
+	masterConfig := loadMasterConfig()
+	for _, route := range masterConfig.Worker.ResultRoutes {
+		if err := mqClient.DeclareExchange(route.Exchange); err != nil {
+			log.Fatalf("Failed to declare result route exchange %s: %v", route.Exchange, err)
+		}
+	}
+
+	if masterConfig.HeartbeatInterval > 0 {
+		if err := mqClient.DeclareExchange(rabbitmq.HeartbeatExchange); err != nil {
+			log.Fatalf("Failed to declare heartbeat exchange: %v", err)
+		}
+	}
+
+	if maxPriority := getEnvInt("SUBMISSION_MAX_PRIORITY", 0); maxPriority > 0 {
+		if maxPriority > 255 {
+			maxPriority = 255
+		}
+		if err := mqClient.DeclarePriorityQueue(submissionQueue, uint8(maxPriority)); err != nil {
+			log.Fatalf("Failed to declare priority queue %s: %v", submissionQueue, err)
+		}
+	}
+
+	if queue := masterConfig.Worker.RetryQueue; queue != "" {
+		if err := mqClient.DeclareQueue(queue); err != nil {
+			log.Fatalf("Failed to declare retry queue %s: %v", queue, err)
+		}
+	}
+
+	master, err := master.NewMaster(mqClient, workerCount, submissionQueue, masterConfig)
 	if err != nil {
 		log.Fatalf("Failed to create master node: %v", err)
 	}
@@ -44,10 +96,22 @@ func main() {
 	master.Start()
 	log.Printf("Master started with %d workers.", workerCount)
 
-	startHealthServer()
+	// The run stream judges code sent over HTTP, so it is only served when asked for
+	var streamConfig *worker.Config
+	if getEnvBool("RUN_STREAM", false) {
+		streamConfig = &masterConfig.Worker
+	}
+	startHealthServer(newCapabilities(workerCount, dockerConfig), master, streamConfig)
 
-	waitForShutdown()
+	waitForShutdown(master.Retiring())
 	log.Println("Shutting down executor...")
+	master.Drain()
+	master.FlushResults()
+	if removed, err := docker.RemoveWarmContainers(); err != nil {
+		log.Printf("Failed to remove warm containers: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d warm containers.", removed)
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -57,11 +121,385 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func startHealthServer() {
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %v", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %v", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return getListItems(value)
+}
+
+func getListItems(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %v", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func loadDockerConfig() docker.Config {
+	config := docker.DefaultConfig()
+	config.UnbufferedOutput = getEnvBool("UNBUFFERED_OUTPUT", config.UnbufferedOutput)
+	config.ScratchDir = getEnv("SCRATCH_DIR", config.ScratchDir)
+	config.ScratchMaxAge = getEnvDuration("SCRATCH_MAX_AGE", config.ScratchMaxAge)
+	config.CompileWarnings = getEnvBool("COMPILE_WARNINGS", config.CompileWarnings)
+	config.WarningFlags = parseWarningFlags(getEnv("WARNING_FLAGS", ""))
+	config.ContainerCPUs = getEnvFloat("CONTAINER_CPUS", config.ContainerCPUs)
+	config.CPUBudget = getEnvFloat("CPU_BUDGET", config.CPUBudget)
+	config.MemoryBudgetBytes = int64(getEnvInt("MEMORY_BUDGET_BYTES", int(config.MemoryBudgetBytes)))
+	config.TLEGracePeriod = getEnvDuration("TLE_GRACE_PERIOD", config.TLEGracePeriod)
+	config.IsolateMounts = getEnvBool("ISOLATE_MOUNTS", config.IsolateMounts)
+	config.LanguageAliases = parseLanguageAliases(getEnv("LANGUAGE_ALIASES", ""))
+	config.LanguageConcurrency = parseLanguageConcurrency(getEnv("LANGUAGE_CONCURRENCY", ""))
+	config.StdinMode = strings.ToUpper(getEnv("STDIN_MODE", config.StdinMode))
+	config.KillTimeout = getEnvDuration("KILL_TIMEOUT", config.KillTimeout)
+	config.ContainerCreateRate = getEnvFloat("CONTAINER_CREATE_RATE", config.ContainerCreateRate)
+	config.ContainerCreateBurst = getEnvInt("CONTAINER_CREATE_BURST", config.ContainerCreateBurst)
+	config.WarmUpImages = getEnvBool("WARM_UP_IMAGES", config.WarmUpImages)
+	config.WarmUpJitter = getEnvDuration("WARM_UP_JITTER", config.WarmUpJitter)
+	config.SeparateCompile = getEnvBool("SEPARATE_COMPILE", config.SeparateCompile)
+	config.CompileMemoryBytes = int64(getEnvInt("COMPILE_MEMORY_BYTES", int(config.CompileMemoryBytes)))
+	config.SyntaxCheck = getEnvBool("SYNTAX_CHECK", config.SyntaxCheck)
+	config.KeepaliveHeadroom = getEnvDuration("KEEPALIVE_HEADROOM", config.KeepaliveHeadroom)
+	config.ReaperInterval = getEnvDuration("CONTAINER_REAPER_INTERVAL", config.ReaperInterval)
+	config.OutputGracePeriod = getEnvDuration("OUTPUT_GRACE_PERIOD", config.OutputGracePeriod)
+	config.Debug = getEnvBool("DEBUG", config.Debug)
+	config.ReuseContainers = getEnvBool("REUSE_CONTAINERS", config.ReuseContainers)
+	config.WarmContainerLifetime = getEnvDuration("WARM_CONTAINER_LIFETIME", config.WarmContainerLifetime)
+	config.Runtime = getEnv("CONTAINER_RUNTIME", config.Runtime)
+	return config
+}
+
+func loadMasterConfig() master.Config {
+	config := master.DefaultConfig()
+	config.Worker.CompressResults = getEnvBool("RESULT_COMPRESSION", config.Worker.CompressResults)
+	config.Worker.CompressionThreshold = getEnvInt("RESULT_COMPRESSION_THRESHOLD", config.Worker.CompressionThreshold)
+	config.Worker.ProcessTimeout = getEnvDuration("PROCESS_TIMEOUT", config.Worker.ProcessTimeout)
+	config.Worker.MaxAttempts = getEnvInt("MAX_ATTEMPTS", config.Worker.MaxAttempts)
+	config.Worker.RetryQueue = getEnv("RETRY_QUEUE", config.Worker.RetryQueue)
+	config.Worker.CompareCacheSize = getEnvInt("COMPARE_CACHE_SIZE", config.Worker.CompareCacheSize)
+	config.Worker.LanguageCheck = getEnvBool("LANGUAGE_CHECK", config.Worker.LanguageCheck)
+	config.Worker.ResultBatchSize = getEnvInt("RESULT_BATCH_SIZE", config.Worker.ResultBatchSize)
+	config.Worker.ResultBatchDelay = getEnvDuration("RESULT_BATCH_DELAY", config.Worker.ResultBatchDelay)
+	config.Worker.CheckerTimeLimitSeconds = getEnvFloat("CHECKER_TIME_LIMIT_SECONDS", config.Worker.CheckerTimeLimitSeconds)
+	config.Worker.CheckerMemoryLimitMB = int64(getEnvInt("CHECKER_MEMORY_LIMIT_MB", int(config.Worker.CheckerMemoryLimitMB)))
+	config.Worker.ResultRoutes = parseResultRoutes(getEnv("RESULT_ROUTES", ""))
+	caps, err := parseResourceCaps(getEnv("RESOURCE_CAPS", ""))
+	if err != nil {
+		log.Fatalf("Invalid RESOURCE_CAPS: %v", err)
+	}
+	config.Worker.ResourceCaps = caps
+	config.Worker.ResultDedupWindow = getEnvDuration("RESULT_DEDUP_WINDOW", config.Worker.ResultDedupWindow)
+	config.Worker.QuarantineAfter = getEnvInt("QUARANTINE_AFTER", config.Worker.QuarantineAfter)
+	config.Worker.OutputFilters = parseOutputFilters(getEnv("OUTPUT_FILTERS", ""), config.Worker.OutputFilters)
+	config.Worker.TestCaseParallelism = getEnvInt("TEST_CASE_PARALLELISM", config.Worker.TestCaseParallelism)
+	zeroTestCases, err := parsePolicy(os.Getenv("ZERO_TEST_CASES"), config.Worker.ZeroTestCases,
+		worker.ZeroTestCasesCompilationError, worker.ZeroTestCasesInvalid, worker.ZeroTestCasesPassed)
+	if err != nil {
+		log.Fatalf("Invalid ZERO_TEST_CASES: %v", err)
+	}
+	config.Worker.ZeroTestCases = zeroTestCases
+	config.AcceptedContentTypes = getEnvList("ACCEPTED_CONTENT_TYPES", config.AcceptedContentTypes)
+	config.MaxSubmissionBytes = getEnvInt("MAX_SUBMISSION_BYTES", config.MaxSubmissionBytes)
+	config.HeartbeatInterval = getEnvDuration("HEARTBEAT_INTERVAL", config.HeartbeatInterval)
+	config.ExecutorID = getEnv("EXECUTOR_ID", config.ExecutorID)
+	config.MaxSubmissions = getEnvInt("MAX_SUBMISSIONS", config.MaxSubmissions)
+	config.MaxLifetime = getEnvDuration("MAX_LIFETIME", config.MaxLifetime)
+	duplicateIDs, err := parsePolicy(os.Getenv("DUPLICATE_TEST_CASE_IDS"), config.DuplicateTestCaseIDs,
+		master.DuplicateIDsReject, master.DuplicateIDsSuffix)
+	if err != nil {
+		log.Fatalf("Invalid DUPLICATE_TEST_CASE_IDS: %v", err)
+	}
+	config.DuplicateTestCaseIDs = duplicateIDs
+	return config
+}
+
+// parseResultRoutes parses "VERDICT=exchange:routingKey" pairs separated by commas.
+func parseResultRoutes(value string) map[string]worker.ResultRoute {
+	routes := make(map[string]worker.ResultRoute)
+	for _, entry := range getListItems(value) {
+		verdict, target, ok := strings.Cut(entry, "=")
+		exchange, routingKey, hasKey := strings.Cut(target, ":")
+		if !ok || !hasKey || verdict == "" || exchange == "" {
+			log.Printf("Ignoring invalid result route %q, expected VERDICT=exchange:routingKey", entry)
+			continue
+		}
+		routes[strings.TrimSpace(verdict)] = worker.ResultRoute{Exchange: exchange, RoutingKey: routingKey}
+	}
+	return routes
+}
+
+// parseResourceCaps parses the resource caps, a ResourceProfile in its JSON form
+// (e.g. {"timeLimit":10,"memoryLimit":1024}). The caps are a safety limit, so invalid
+// or negative caps are an error rather than ignored.
+func parseResourceCaps(value string) (types.ResourceProfile, error) {
+	var caps types.ResourceProfile
+	if value == "" {
+		return caps, nil
+	}
+	if err := json.Unmarshal([]byte(value), &caps); err != nil {
+		return types.ResourceProfile{}, fmt.Errorf("%q is not a resource profile: %w", value, err)
+	}
+	if err := caps.Validate(); err != nil {
+		return types.ResourceProfile{}, err
+	}
+	return caps, nil
+}
+
+// parsePolicy parses a policy name case-insensitively, returning defaultValue when it
+// is unset. An unknown policy is an error rather than silently behaving as another one.
+func parsePolicy(value, defaultValue string, policies ...string) (string, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	value = strings.ToUpper(value)
+	for _, policy := range policies {
+		if value == policy {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unknown policy %q, want one of %s", value, strings.Join(policies, ", "))
+}
+
+// parseWarningFlags parses per-language compile warning flags, a JSON object of
+// language to flags (e.g. {"CPP":["-Wall","-Wshadow"],"JAVA":[]}), which replace the
+// language's built-in flags. An invalid value keeps the built-in flags, and an unknown
+// language is skipped.
+func parseWarningFlags(value string) map[string][]string {
+	if value == "" {
+		return nil
+	}
+	var flags map[string][]string
+	if err := json.Unmarshal([]byte(value), &flags); err != nil {
+		log.Printf("Ignoring invalid warning flags %q: %v", value, err)
+		return nil
+	}
+	resolved := make(map[string][]string, len(flags))
+	for name, languageFlags := range flags {
+		language, ok := docker.ResolveLanguage(name)
+		if !ok {
+			log.Printf("Ignoring warning flags of unknown language %q", name)
+			continue
+		}
+		resolved[language] = append([]string{}, languageFlags...)
+	}
+	return resolved
+}
+
+// parseOutputFilters parses per-language output filters, a JSON object of language to
+// the patterns of the lines to drop (e.g. {"JAVA":["^Picked up "]}), over the defaults.
+// A language listed replaces its default filters; an empty list disables them. An
+// invalid value keeps the defaults, and an invalid pattern is skipped.
+func parseOutputFilters(value string, defaults map[string][]*regexp.Regexp) map[string][]*regexp.Regexp {
+	if value == "" {
+		return defaults
+	}
+	var patterns map[string][]string
+	if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+		log.Printf("Ignoring invalid output filters %q: %v", value, err)
+		return defaults
+	}
+	filters := make(map[string][]*regexp.Regexp, len(defaults)+len(patterns))
+	for language, languageFilters := range defaults {
+		filters[language] = languageFilters
+	}
+	for name, languagePatterns := range patterns {
+		language, known := docker.ResolveLanguage(name)
+		if !known {
+			log.Printf("Ignoring output filters for unknown language %q", name)
+			continue
+		}
+		languageFilters := []*regexp.Regexp{}
+		for _, pattern := range languagePatterns {
+			filter, err := regexp.Compile(pattern)
+			if err != nil {
+				log.Printf("Ignoring invalid %s output filter %q: %v", language, pattern, err)
+				continue
+			}
+			languageFilters = append(languageFilters, filter)
+		}
+		filters[language] = languageFilters
+	}
+	return filters
+}
+
+// parseLanguageAliases parses "alias=LANGUAGE,..." into lower-case aliases.
+func parseLanguageAliases(value string) map[string]string {
+	aliases := make(map[string]string)
+	for _, entry := range getListItems(value) {
+		alias, language, ok := strings.Cut(entry, "=")
+		alias, language = strings.TrimSpace(alias), strings.TrimSpace(language)
+		if !ok || alias == "" || language == "" {
+			log.Printf("Ignoring invalid language alias %q, expected alias=LANGUAGE", entry)
+			continue
+		}
+		aliases[strings.ToLower(alias)] = language
+	}
+	return aliases
+}
+
+// parseLanguageConcurrency parses "LANGUAGE=limit,..." into per-language container caps.
+func parseLanguageConcurrency(value string) map[string]int {
+	limits := make(map[string]int)
+	for _, entry := range getListItems(value) {
+		name, limit, ok := strings.Cut(entry, "=")
+		parsed, err := strconv.Atoi(strings.TrimSpace(limit))
+		language, known := docker.ResolveLanguage(strings.TrimSpace(name))
+		if !ok || err != nil || parsed <= 0 || !known {
+			log.Printf("Ignoring invalid language concurrency %q, expected LANGUAGE=limit", entry)
+			continue
+		}
+		limits[language] = parsed
+	}
+	return limits
+}
+
+// capabilities describes what this executor supports, so that producers can discover
+// it instead of hardcoding assumptions.
+type capabilities struct {
+	Languages    []string     `json:"languages"`
+	Verdicts     []string     `json:"verdicts"`
+	CompareModes []string     `json:"compareModes"`
+	Limits       resourceCaps `json:"limits"`
+}
+
+// resourceCaps are the executor-wide resource limits; zero values mean unlimited.
+type resourceCaps struct {
+	Workers               int     `json:"workers"`
+	TimeLimitSeconds      float64 `json:"timeLimitSeconds"`
+	ContainerCPUs         float64 `json:"containerCpus"`
+	CPUBudget             float64 `json:"cpuBudget"`
+	MemoryBudgetBytes     int64   `json:"memoryBudgetBytes"`
+	TLEGracePeriodSeconds float64 `json:"tleGracePeriodSeconds"`
+}
+
+func newCapabilities(workers int, dockerConfig docker.Config) capabilities {
+	return capabilities{
+		Languages:    docker.Languages(),
+		Verdicts:     worker.Verdicts,
+		CompareModes: worker.RegisteredCompareModes(),
+		Limits: resourceCaps{
+			Workers:               workers,
+			TimeLimitSeconds:      worker.RunTimeLimitSeconds,
+			ContainerCPUs:         dockerConfig.ContainerCPUs,
+			CPUBudget:             dockerConfig.CPUBudget,
+			MemoryBudgetBytes:     dockerConfig.MemoryBudgetBytes,
+			TLEGracePeriodSeconds: dockerConfig.TLEGracePeriod.Seconds(),
+		},
+	}
+}
+
+func capabilitiesHandler(caps capabilities) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(caps); err != nil {
+			log.Printf("Failed to write capabilities: %v", err)
+		}
+	}
+}
+
+// dispatchControlHandler pauses or resumes dispatching of new submissions. In-flight
+// submissions are unaffected either way.
+func dispatchControlHandler(m *master.Master, pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if pause {
+			m.Pause()
+		} else {
+			m.Resume()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"paused": m.Paused()})
+	}
+}
+
+// metricsHandler reports the executor's counters in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP oj_executor_reaped_containers_total Orphaned submission containers removed by the reaper.")
+	fmt.Fprintln(w, "# TYPE oj_executor_reaped_containers_total counter")
+	fmt.Fprintf(w, "oj_executor_reaped_containers_total %d\n", docker.ReapedContainers())
+}
+
+// healthHandler reports that the executor is up, and which build it runs.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	health := struct {
+		Status string `json:"status"`
+		version.Info
+	}{"OK", version.BuildInfo()}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		log.Printf("Failed to write health: %v", err)
+	}
+}
+
+func startHealthServer(caps capabilities, m *master.Master, streamConfig *worker.Config) {
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/capabilities", capabilitiesHandler(caps))
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/pause", dispatchControlHandler(m, true))
+	http.HandleFunc("/resume", dispatchControlHandler(m, false))
+	if streamConfig != nil {
+		http.HandleFunc("/run/stream", runStreamHandler(*streamConfig, caps.Limits.Workers))
+	}
 
 	port := getEnv("PORT", "8080")
 	go func() {
@@ -72,8 +510,12 @@ func startHealthServer() {
 	}()
 }
 
-func waitForShutdown() {
+// waitForShutdown returns on SIGINT or SIGTERM, or once the executor is retiring.
+func waitForShutdown(retiring <-chan struct{}) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	select {
+	case <-c:
+	case <-retiring:
+	}
 }
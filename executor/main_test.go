@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"online-judge/executor/docker"
+	"online-judge/executor/master"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"online-judge/executor/version"
+	"online-judge/executor/worker"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetEnvBool(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		defaultValue bool
+		want         bool
+	}{
+		{"unset uses default", "", true, true},
+		{"true", "true", false, true},
+		{"numeric false", "0", true, false},
+		{"invalid uses default", "maybe", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_BOOL", tt.value)
+			if got := getEnvBool("TEST_BOOL", tt.defaultValue); got != tt.want {
+				t.Errorf("getEnvBool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	t.Setenv("TEST_DURATION", "90s")
+	if got := getEnvDuration("TEST_DURATION", time.Minute); got != 90*time.Second {
+		t.Errorf("getEnvDuration() = %v, want 90s", got)
+	}
+
+	t.Setenv("TEST_DURATION", "soon")
+	if got := getEnvDuration("TEST_DURATION", time.Minute); got != time.Minute {
+		t.Errorf("getEnvDuration() with invalid value = %v, want 1m0s", got)
+	}
+}
+
+func TestLoadDockerConfig(t *testing.T) {
+	t.Setenv("UNBUFFERED_OUTPUT", "true")
+	t.Setenv("SCRATCH_DIR", "/var/lib/oj-scratch")
+	t.Setenv("SCRATCH_MAX_AGE", "30m")
+	t.Setenv("COMPILE_WARNINGS", "true")
+	t.Setenv("WARNING_FLAGS", `{"c++": ["-Wall", "-Wshadow"], "JAVA": [], "COBOL": ["-x"]}`)
+	t.Setenv("CONTAINER_CPUS", "0.5")
+	t.Setenv("CPU_BUDGET", "4")
+	t.Setenv("MEMORY_BUDGET_BYTES", "8589934592")
+	t.Setenv("TLE_GRACE_PERIOD", "500ms")
+	t.Setenv("ISOLATE_MOUNTS", "true")
+	t.Setenv("LANGUAGE_ALIASES", "Pypy=PYTHON, gnu++=CPP")
+	t.Setenv("LANGUAGE_CONCURRENCY", "JAVA=2, c++=4, COBOL=1, PYTHON=x")
+	t.Setenv("STDIN_MODE", "pipe")
+	t.Setenv("KILL_TIMEOUT", "2s")
+	t.Setenv("OUTPUT_GRACE_PERIOD", "500ms")
+	t.Setenv("CONTAINER_REAPER_INTERVAL", "10m")
+	t.Setenv("KEEPALIVE_HEADROOM", "90s")
+	t.Setenv("WARM_UP_IMAGES", "true")
+	t.Setenv("WARM_UP_JITTER", "45s")
+	t.Setenv("SEPARATE_COMPILE", "true")
+	t.Setenv("COMPILE_MEMORY_BYTES", "1073741824")
+	t.Setenv("SYNTAX_CHECK", "true")
+	t.Setenv("CONTAINER_CREATE_RATE", "2.5")
+	t.Setenv("CONTAINER_CREATE_BURST", "4")
+	t.Setenv("DEBUG", "true")
+	t.Setenv("REUSE_CONTAINERS", "true")
+	t.Setenv("WARM_CONTAINER_LIFETIME", "30m")
+	t.Setenv("CONTAINER_RUNTIME", "runsc")
+
+	config := loadDockerConfig()
+	if !config.UnbufferedOutput {
+		t.Error("UnbufferedOutput = false, want true")
+	}
+	if config.ScratchDir != "/var/lib/oj-scratch" {
+		t.Errorf("ScratchDir = %s, want /var/lib/oj-scratch", config.ScratchDir)
+	}
+	if config.ScratchMaxAge != 30*time.Minute {
+		t.Errorf("ScratchMaxAge = %v, want 30m0s", config.ScratchMaxAge)
+	}
+	if !config.CompileWarnings {
+		t.Error("CompileWarnings = false, want true")
+	}
+	if want := map[string][]string{"CPP": {"-Wall", "-Wshadow"}, "JAVA": {}}; !reflect.DeepEqual(config.WarningFlags, want) {
+		t.Errorf("WarningFlags = %v, want %v", config.WarningFlags, want)
+	}
+	if config.ContainerCPUs != 0.5 || config.CPUBudget != 4 {
+		t.Errorf("ContainerCPUs, CPUBudget = %v, %v, want 0.5, 4", config.ContainerCPUs, config.CPUBudget)
+	}
+	if config.MemoryBudgetBytes != 8<<30 {
+		t.Errorf("MemoryBudgetBytes = %d, want 8GB", config.MemoryBudgetBytes)
+	}
+	if config.TLEGracePeriod != 500*time.Millisecond {
+		t.Errorf("TLEGracePeriod = %v, want 500ms", config.TLEGracePeriod)
+	}
+	if !config.IsolateMounts {
+		t.Error("IsolateMounts = false, want true")
+	}
+	if config.LanguageAliases["pypy"] != "PYTHON" || config.LanguageAliases["gnu++"] != "CPP" {
+		t.Errorf("LanguageAliases = %v, want pypy and gnu++", config.LanguageAliases)
+	}
+	if len(config.LanguageConcurrency) != 2 || config.LanguageConcurrency["JAVA"] != 2 || config.LanguageConcurrency["CPP"] != 4 {
+		t.Errorf("LanguageConcurrency = %v, want JAVA=2 and CPP=4 only", config.LanguageConcurrency)
+	}
+	if config.StdinMode != docker.StdinPipe {
+		t.Errorf("StdinMode = %s, want PIPE", config.StdinMode)
+	}
+	if config.KillTimeout != 2*time.Second {
+		t.Errorf("KillTimeout = %v, want 2s", config.KillTimeout)
+	}
+	if config.ContainerCreateRate != 2.5 || config.ContainerCreateBurst != 4 {
+		t.Errorf("ContainerCreateRate, ContainerCreateBurst = %v, %d, want 2.5, 4", config.ContainerCreateRate, config.ContainerCreateBurst)
+	}
+	if !config.WarmUpImages || config.WarmUpJitter != 45*time.Second {
+		t.Errorf("WarmUpImages, WarmUpJitter = %v, %v, want true, 45s", config.WarmUpImages, config.WarmUpJitter)
+	}
+	if !config.SeparateCompile {
+		t.Error("SeparateCompile = false, want true")
+	}
+	if config.CompileMemoryBytes != 1<<30 {
+		t.Errorf("CompileMemoryBytes = %d, want 1GiB", config.CompileMemoryBytes)
+	}
+	if !config.SyntaxCheck {
+		t.Error("SyntaxCheck = false, want true")
+	}
+	if config.KeepaliveHeadroom != 90*time.Second {
+		t.Errorf("KeepaliveHeadroom = %v, want 90s", config.KeepaliveHeadroom)
+	}
+	if config.ReaperInterval != 10*time.Minute {
+		t.Errorf("ReaperInterval = %v, want 10m", config.ReaperInterval)
+	}
+	if config.OutputGracePeriod != 500*time.Millisecond {
+		t.Errorf("OutputGracePeriod = %v, want 500ms", config.OutputGracePeriod)
+	}
+	if !config.Debug {
+		t.Error("Debug = false, want true")
+	}
+	if !config.ReuseContainers {
+		t.Error("ReuseContainers = false, want true")
+	}
+	if config.WarmContainerLifetime != 30*time.Minute {
+		t.Errorf("WarmContainerLifetime = %v, want 30m", config.WarmContainerLifetime)
+	}
+	if config.Runtime != "runsc" {
+		t.Errorf("Runtime = %q, want runsc", config.Runtime)
+	}
+}
+
+func TestLoadMasterConfig(t *testing.T) {
+	t.Setenv("RESULT_COMPRESSION", "true")
+	t.Setenv("RESULT_COMPRESSION_THRESHOLD", "1024")
+	t.Setenv("ACCEPTED_CONTENT_TYPES", "application/json, text/json")
+	t.Setenv("DUPLICATE_TEST_CASE_IDS", "suffix")
+	t.Setenv("MAX_ATTEMPTS", "5")
+	t.Setenv("COMPARE_CACHE_SIZE", "1000")
+	t.Setenv("LANGUAGE_CHECK", "true")
+	t.Setenv("MAX_SUBMISSION_BYTES", "1048576")
+	t.Setenv("HEARTBEAT_INTERVAL", "15s")
+	t.Setenv("RESULT_BATCH_SIZE", "50")
+	t.Setenv("RETRY_QUEUE", "oj.q.submissions.retry")
+	t.Setenv("RESULT_BATCH_DELAY", "2s")
+	t.Setenv("EXECUTOR_ID", "executor-7")
+	t.Setenv("CHECKER_TIME_LIMIT_SECONDS", "2.5")
+	t.Setenv("CHECKER_MEMORY_LIMIT_MB", "128")
+	t.Setenv("MAX_SUBMISSIONS", "500")
+	t.Setenv("MAX_LIFETIME", "6h")
+	t.Setenv("RESOURCE_CAPS", `{"timeLimit": 10, "cpus": 2, "maxProcesses": 64}`)
+	t.Setenv("TEST_CASE_PARALLELISM", "4")
+	t.Setenv("ZERO_TEST_CASES", "passed")
+	t.Setenv("OUTPUT_FILTERS", `{"cpp": ["^warning: "]}`)
+	t.Setenv("QUARANTINE_AFTER", "3")
+	t.Setenv("RESULT_DEDUP_WINDOW", "5m")
+
+	config := loadMasterConfig()
+	if config.Worker.ResultDedupWindow != 5*time.Minute {
+		t.Errorf("ResultDedupWindow = %v, want 5m", config.Worker.ResultDedupWindow)
+	}
+	if config.Worker.QuarantineAfter != 3 {
+		t.Errorf("QuarantineAfter = %d, want 3", config.Worker.QuarantineAfter)
+	}
+	if filters := config.Worker.OutputFilters; len(filters["CPP"]) != 1 || len(filters["JAVA"]) == 0 {
+		t.Errorf("OutputFilters = %v, want the CPP filter over the defaults", filters)
+	}
+	if config.Worker.TestCaseParallelism != 4 {
+		t.Errorf("TestCaseParallelism = %d, want 4", config.Worker.TestCaseParallelism)
+	}
+	if config.Worker.ZeroTestCases != worker.ZeroTestCasesPassed {
+		t.Errorf("ZeroTestCases = %q, want %q", config.Worker.ZeroTestCases, worker.ZeroTestCasesPassed)
+	}
+	if caps := config.Worker.ResourceCaps; caps != (types.ResourceProfile{TimeLimit: 10, CPUs: 2, MaxProcesses: 64}) {
+		t.Errorf("ResourceCaps = %+v, want the configured caps", caps)
+	}
+	if config.MaxSubmissions != 500 || config.MaxLifetime != 6*time.Hour {
+		t.Errorf("MaxSubmissions = %d, MaxLifetime = %v, want 500 and 6h", config.MaxSubmissions, config.MaxLifetime)
+	}
+	if config.Worker.CheckerTimeLimitSeconds != 2.5 || config.Worker.CheckerMemoryLimitMB != 128 {
+		t.Errorf("checker limits = %vs, %dMB, want 2.5s, 128MB", config.Worker.CheckerTimeLimitSeconds, config.Worker.CheckerMemoryLimitMB)
+	}
+	if !config.Worker.CompressResults {
+		t.Error("CompressResults = false, want true")
+	}
+	if config.Worker.CompressionThreshold != 1024 {
+		t.Errorf("CompressionThreshold = %d, want 1024", config.Worker.CompressionThreshold)
+	}
+	if len(config.AcceptedContentTypes) != 2 || config.AcceptedContentTypes[1] != "text/json" {
+		t.Errorf("AcceptedContentTypes = %v, want [application/json text/json]", config.AcceptedContentTypes)
+	}
+	if config.DuplicateTestCaseIDs != master.DuplicateIDsSuffix {
+		t.Errorf("DuplicateTestCaseIDs = %s, want SUFFIX", config.DuplicateTestCaseIDs)
+	}
+	if config.Worker.MaxAttempts != 5 {
+		t.Errorf("MaxAttempts = %d, want 5", config.Worker.MaxAttempts)
+	}
+	if config.Worker.CompareCacheSize != 1000 {
+		t.Errorf("CompareCacheSize = %d, want 1000", config.Worker.CompareCacheSize)
+	}
+	if !config.Worker.LanguageCheck {
+		t.Error("LanguageCheck = false, want true")
+	}
+	if config.MaxSubmissionBytes != 1048576 {
+		t.Errorf("MaxSubmissionBytes = %d, want 1048576", config.MaxSubmissionBytes)
+	}
+	if config.Worker.RetryQueue != "oj.q.submissions.retry" {
+		t.Errorf("RetryQueue = %q, want oj.q.submissions.retry", config.Worker.RetryQueue)
+	}
+	if config.Worker.ResultBatchSize != 50 || config.Worker.ResultBatchDelay != 2*time.Second {
+		t.Errorf("ResultBatchSize, ResultBatchDelay = %d, %v, want 50, 2s", config.Worker.ResultBatchSize, config.Worker.ResultBatchDelay)
+	}
+	if config.HeartbeatInterval != 15*time.Second {
+		t.Errorf("HeartbeatInterval = %v, want 15s", config.HeartbeatInterval)
+	}
+	if config.ExecutorID != "executor-7" {
+		t.Errorf("ExecutorID = %q, want executor-7", config.ExecutorID)
+	}
+}
+
+func TestParseResultRoutes(t *testing.T) {
+	routes := parseResultRoutes("INTERNAL_ERROR=oj.ex.ops:submission.internal, bad-entry, COMPILATION_ERROR=oj.ex.ops:submission.compile")
+
+	if len(routes) != 2 {
+		t.Fatalf("routes = %v, want 2 entries", routes)
+	}
+	route := routes["INTERNAL_ERROR"]
+	if route.Exchange != "oj.ex.ops" || route.RoutingKey != "submission.internal" {
+		t.Errorf("INTERNAL_ERROR route = %+v, want oj.ex.ops/submission.internal", route)
+	}
+	if _, ok := routes["bad-entry"]; ok {
+		t.Error("invalid entry should be ignored")
+	}
+}
+
+func TestParseResourceCaps(t *testing.T) {
+	if caps, err := parseResourceCaps(""); err != nil || caps != (types.ResourceProfile{}) {
+		t.Errorf("parseResourceCaps(\"\") = %+v, %v, want no caps", caps, err)
+	}
+	if caps, err := parseResourceCaps(`{"memoryLimit": 512}`); err != nil || caps != (types.ResourceProfile{MemoryLimit: 512}) {
+		t.Errorf("parseResourceCaps() = %+v, %v, want a 512MB memory cap", caps, err)
+	}
+	for _, value := range []string{`{"memoryLimit": "512MB"}`, `{memoryLimit: 512}`, `{"timeLimit": -1}`} {
+		if _, err := parseResourceCaps(value); err == nil {
+			t.Errorf("parseResourceCaps(%s) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policies := []string{worker.ZeroTestCasesCompilationError, worker.ZeroTestCasesPassed}
+	if got, err := parsePolicy("", worker.ZeroTestCasesCompilationError, policies...); err != nil || got != worker.ZeroTestCasesCompilationError {
+		t.Errorf("parsePolicy(\"\") = %q, %v, want the default", got, err)
+	}
+	if got, err := parsePolicy("passed", worker.ZeroTestCasesCompilationError, policies...); err != nil || got != worker.ZeroTestCasesPassed {
+		t.Errorf("parsePolicy(\"passed\") = %q, %v, want PASSED", got, err)
+	}
+	if got, err := parsePolicy("pased", worker.ZeroTestCasesCompilationError, policies...); err == nil {
+		t.Errorf("parsePolicy(\"pased\") = %q, want an error", got)
+	}
+	if got, err := parsePolicy("sufix", master.DuplicateIDsReject, master.DuplicateIDsReject, master.DuplicateIDsSuffix); err == nil {
+		t.Errorf("parsePolicy(\"sufix\") = %q, want an error", got)
+	}
+}
+
+func TestParseOutputFilters(t *testing.T) {
+	defaults := worker.DefaultOutputFilters()
+	filters := parseOutputFilters(`{"PYTHON": [], "CPP": ["^warning: ", "(bad"], "COBOL": ["x"]}`, defaults)
+
+	if len(filters["PYTHON"]) != 0 {
+		t.Errorf("PYTHON filters = %v, want the defaults disabled", filters["PYTHON"])
+	}
+	if len(filters["CPP"]) != 1 || filters["CPP"][0].String() != "^warning: " {
+		t.Errorf("CPP filters = %v, want the valid pattern only", filters["CPP"])
+	}
+	if len(filters["JAVA"]) != len(defaults["JAVA"]) {
+		t.Errorf("JAVA filters = %v, want the defaults", filters["JAVA"])
+	}
+	if _, ok := filters["COBOL"]; ok {
+		t.Error("filters for an unknown language should be ignored")
+	}
+	if got := parseOutputFilters("{not json", defaults); len(got) != len(defaults) {
+		t.Errorf("invalid filters = %v, want the defaults", got)
+	}
+}
+
+func TestCapabilitiesHandler(t *testing.T) {
+	dockerConfig := docker.DefaultConfig()
+	dockerConfig.CPUBudget = 8
+	dockerConfig.MemoryBudgetBytes = 4 << 30
+	dockerConfig.TLEGracePeriod = 250 * time.Millisecond
+
+	rec := httptest.NewRecorder()
+	capabilitiesHandler(newCapabilities(4, dockerConfig)).ServeHTTP(rec, httptest.NewRequest("GET", "/capabilities", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var caps capabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	if got := strings.Join(caps.Languages, ","); got != "C,CPP,JAVA,PYTHON" {
+		t.Errorf("Languages = %v, want [C CPP JAVA PYTHON]", caps.Languages)
+	}
+	if strings.Join(caps.CompareModes, ",") != strings.Join(worker.RegisteredCompareModes(), ",") {
+		t.Errorf("CompareModes = %v, want %v", caps.CompareModes, worker.RegisteredCompareModes())
+	}
+	if len(caps.Verdicts) != len(worker.Verdicts) {
+		t.Errorf("Verdicts = %v, want %v", caps.Verdicts, worker.Verdicts)
+	}
+	want := resourceCaps{Workers: 4, TimeLimitSeconds: worker.RunTimeLimitSeconds, CPUBudget: 8, MemoryBudgetBytes: 4 << 30, TLEGracePeriodSeconds: 0.25}
+	if caps.Limits != want {
+		t.Errorf("Limits = %+v, want %+v", caps.Limits, want)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	defer func(v string) { version.Version = v }(version.Version)
+
+	tests := []struct {
+		name     string
+		injected string
+		want     string
+	}{
+		{"injected version", "v1.4.0", "v1.4.0"},
+		{"default version", "", version.DefaultVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version.Version = tt.injected
+			rec := httptest.NewRecorder()
+			healthHandler(rec, httptest.NewRequest("GET", "/health", nil))
+
+			if rec.Code != 200 {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			var health struct {
+				Status  string `json:"status"`
+				Version string `json:"version"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+				t.Fatalf("failed to decode health: %v", err)
+			}
+			if health.Status != "OK" || health.Version != tt.want {
+				t.Errorf("health = %+v, want OK and version %q", health, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.Contains(rec.Body.String(), "oj_executor_reaped_containers_total 0\n") {
+		t.Errorf("metrics = %q, want the reaped container counter", rec.Body.String())
+	}
+}
+
+func TestDispatchControlHandler(t *testing.T) {
+	m, _ := master.NewMaster(&testutil.RecordingClient{}, 1, "test.queue", master.DefaultConfig())
+
+	rec := httptest.NewRecorder()
+	dispatchControlHandler(m, true).ServeHTTP(rec, httptest.NewRequest("GET", "/pause", nil))
+	if rec.Code != 405 || m.Paused() {
+		t.Errorf("GET /pause = %d, paused %v, want 405 and not paused", rec.Code, m.Paused())
+	}
+
+	rec = httptest.NewRecorder()
+	dispatchControlHandler(m, true).ServeHTTP(rec, httptest.NewRequest("POST", "/pause", nil))
+	if rec.Code != 200 || !m.Paused() || strings.TrimSpace(rec.Body.String()) != `{"paused":true}` {
+		t.Errorf("POST /pause = %d %s, paused %v, want 200 and paused", rec.Code, rec.Body.String(), m.Paused())
+	}
+
+	rec = httptest.NewRecorder()
+	dispatchControlHandler(m, false).ServeHTTP(rec, httptest.NewRequest("POST", "/resume", nil))
+	if rec.Code != 200 || m.Paused() || strings.TrimSpace(rec.Body.String()) != `{"paused":false}` {
+		t.Errorf("POST /resume = %d %s, paused %v, want 200 and resumed", rec.Code, rec.Body.String(), m.Paused())
+	}
+}
@@ -0,0 +1,60 @@
+package master
+
+import (
+	"online-judge/executor/worker"
+	"time"
+)
+
+// Policies for submissions that repeat a test case ID.
+const (
+	// DuplicateIDsReject dead-letters the submission as invalid.
+	DuplicateIDsReject = "REJECT"
+	// DuplicateIDsSuffix renames the repeats (tc1, tc1#2, ...) and judges the submission.
+	DuplicateIDsSuffix = "SUFFIX"
+)
+
+// Config holds the settings of the master and the workers it starts.
+type Config struct {
+	Worker worker.Config
+
+	// AcceptedContentTypes lists the AMQP content types admitted from the submission
+	// queue; an empty entry admits deliveries without one. Deliveries with any other
+	// content type are dead-lettered unparsed. The backend publishes its JSON as a
+	// string, which Spring AMQP's default converter tags text/plain, so the default
+	// admits that as JSON too.
+	AcceptedContentTypes []string
+
+	// DuplicateTestCaseIDs is the policy for submissions with repeated test case IDs,
+	// which would make their results ambiguous: DuplicateIDsReject or DuplicateIDsSuffix.
+	DuplicateTestCaseIDs string
+
+	// MaxSubmissionBytes is the largest submission message admitted. Larger ones are
+	// answered with an INVALID verdict and dead-lettered, well before they run into the
+	// broker's own message size limits. Zero means no limit.
+	MaxSubmissionBytes int
+
+	// HeartbeatInterval is how often the executor announces itself, its languages and
+	// its free capacity on the heartbeat exchange. Zero disables heartbeats.
+	HeartbeatInterval time.Duration
+
+	// ExecutorID identifies this executor in heartbeats. Empty means the host name.
+	ExecutorID string
+
+	// MaxSubmissions and MaxLifetime retire the executor once it dispatched that many
+	// submissions or ran that long, for rolling deployments: dispatching stops, the
+	// submissions in flight are finished and the executor exits, to be replaced by its
+	// orchestrator. Zero means no limit.
+	MaxSubmissions int
+	MaxLifetime    time.Duration
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		Worker:               worker.DefaultConfig(),
+		AcceptedContentTypes: []string{"application/json", "text/plain", ""},
+		DuplicateTestCaseIDs: DuplicateIDsReject,
+		MaxSubmissionBytes:   0,
+		HeartbeatInterval:    0,
+	}
+}
@@ -0,0 +1,52 @@
+package master
+
+import (
+	"log"
+	"online-judge/executor/docker"
+	"online-judge/executor/rabbitmq"
+	"online-judge/executor/types"
+	"online-judge/executor/worker"
+	"os"
+	"time"
+)
+
+// sendHeartbeats publishes a heartbeat every HeartbeatInterval until done is closed.
+// A failed publish is logged and retried at the next tick; the coordinator treats an
+// executor whose heartbeats stop as gone.
+func (m *Master) sendHeartbeats(done <-chan struct{}) {
+	ticker := time.NewTicker(m.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := m.mqClient.Publish(rabbitmq.HeartbeatExchange, rabbitmq.HeartbeatRoutingKey, m.heartbeat()); err != nil {
+				log.Printf("Failed to publish heartbeat: %v", err)
+			}
+		}
+	}
+}
+
+// heartbeat describes this executor's current capacity.
+func (m *Master) heartbeat() types.HeartbeatMessage {
+	return types.HeartbeatMessage{
+		ExecutorID: m.executorID(),
+		Languages:  docker.Languages(),
+		Workers:    m.workerCount,
+		Busy:       worker.Busy(),
+		Paused:     m.Paused(),
+		Timestamp:  time.Now().UTC(),
+	}
+}
+
+func (m *Master) executorID() string {
+	if m.config.ExecutorID != "" {
+		return m.config.ExecutorID
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -2,10 +2,16 @@ package master
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"online-judge/executor/rabbitmq"
 	"online-judge/executor/types"
 	"online-judge/executor/worker"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -15,27 +21,87 @@ type Master struct {
 	jobQueue    chan amqp091.Delivery
 	workerCount int
 	queueName   string
+	config      Config
+	batcher     *worker.ResultBatcher
+
+	pauseMu  sync.Mutex
+	unpaused *sync.Cond
+	paused   bool
+
+	// dispatched and inFlight count the submissions handed to the workers in total
+	// and not yet finished; they are guarded by pauseMu, and idle is signalled when
+	// inFlight drops to zero.
+	dispatched int
+	inFlight   int
+	idle       *sync.Cond
+
+	retireOnce sync.Once
+	retiring   chan struct{}
 }
 
-func NewMaster(mqClient rabbitmq.ClientInterface, workerCount int, queueName string) (*Master, error) {
-	return &Master{
+func NewMaster(mqClient rabbitmq.ClientInterface, workerCount int, queueName string, config Config) (*Master, error) {
+	m := &Master{
 		mqClient:    mqClient,
 		jobQueue:    make(chan amqp091.Delivery, workerCount),
 		workerCount: workerCount,
 		queueName:   queueName,
-	}, nil
+		config:      config,
+		retiring:    make(chan struct{}),
+	}
+	m.unpaused = sync.NewCond(&m.pauseMu)
+	m.idle = sync.NewCond(&m.pauseMu)
+	return m, nil
 }
 
 func (m *Master) Start() {
+	workerConfig := m.config.Worker
+	workerConfig.SubmissionQueue = m.queueName
+	workerConfig.JobDone = m.jobDone
+	workerConfig.Crashes = worker.NewCrashTracker()
+	if window := workerConfig.ResultDedupWindow; window > 0 {
+		workerConfig.PublishedResults = worker.NewPublishedResults(window)
+	}
+	if workerConfig.ResultBatchSize > 0 {
+		m.batcher = worker.NewResultBatcher(m.mqClient, workerConfig.ResultBatchSize, workerConfig.ResultBatchDelay)
+		workerConfig.Batcher = m.batcher
+	}
 	for workerID := 1; workerID <= m.workerCount; workerID++ {
-		worker := worker.NewWorker(workerID, m.jobQueue, m.mqClient)
+		worker := worker.NewWorker(workerID, m.jobQueue, m.mqClient, workerConfig)
 		go worker.Start()
 	}
 
 	go m.consumeAndDispatch()
+	if m.config.HeartbeatInterval > 0 {
+		go m.sendHeartbeats(nil)
+	}
+	if lifetime := m.config.MaxLifetime; lifetime > 0 {
+		time.AfterFunc(lifetime, func() {
+			m.retire(fmt.Sprintf("reached its maximum lifetime of %s", lifetime))
+		})
+	}
+}
+
+// prefetchSetter is implemented by clients whose consumers hold a bounded number of
+// unacknowledged submissions.
+type prefetchSetter interface {
+	SetPrefetch(count int)
+}
+
+// prefetch is how many unacknowledged submissions a consumer may hold: one per worker,
+// plus a full result batch when batching, since a batched submission is only
+// acknowledged once its batch is published and meanwhile its worker goes on.
+func (m *Master) prefetch() int {
+	prefetch := m.workerCount
+	if m.config.Worker.ResultBatchSize > 0 {
+		prefetch += m.config.Worker.ResultBatchSize
+	}
+	return prefetch
 }
 
 func (m *Master) consumeAndDispatch() {
+	if client, ok := m.mqClient.(prefetchSetter); ok {
+		client.SetPrefetch(m.prefetch())
+	}
 	msgs, err := m.mqClient.ConsumeSubmissions(m.queueName)
 	if err != nil {
 		log.Fatalf("Failed to start consuming submissions: %v", err)
@@ -43,14 +109,225 @@ func (m *Master) consumeAndDispatch() {
 
 	log.Printf("Master is waiting for submissions on queue '%s'. To exit press CTRL+C", m.queueName)
 
-	for d := range msgs {
-		var submission types.SubmissionMessage
-		if err := json.Unmarshal(d.Body, &submission); err != nil {
-			log.Printf("Error deserializing submission: %v. Rejecting message.", err)
-			d.Ack(false) // Ack the malformed request
+	// Retries have a lane of their own, which is drained first
+	var retries <-chan amqp091.Delivery
+	if queue := m.config.Worker.RetryQueue; queue != "" {
+		retries, err = m.mqClient.ConsumeSubmissions(queue)
+		if err != nil {
+			log.Fatalf("Failed to start consuming retries: %v", err)
+		}
+		log.Printf("Master is dispatching retries from queue '%s' first.", queue)
+	}
+
+	for {
+		d, ok := nextDelivery(msgs, &retries)
+		if !ok {
+			return
+		}
+		m.waitWhilePaused()
+		submission, err := m.admit(&d)
+		if err != nil {
+			var tooLarge *oversizedError
+			if errors.As(err, &tooLarge) {
+				m.publishInvalid(submission, tooLarge.Error())
+			}
+			log.Printf("Rejecting submission message: %v. Sending to DLQ.", err)
+			d.Nack(false, false) // Nack without requeue so the broker dead-letters it
 			continue
 		}
-		log.Printf("[Submission %d] Received submission. Dispatching to a worker.", submission.SubmissionID)
+		// Priority comes from the AMQP header; a priority queue has already delivered
+		// the highest-priority submissions first, so dispatch keeps the broker's order.
+		log.Printf("[Submission %d] Received submission with priority %d. Dispatching to a worker.", submission.SubmissionID, d.Priority)
+		m.pauseMu.Lock()
+		m.inFlight++
+		m.dispatched++
+		dispatched := m.dispatched
+		m.pauseMu.Unlock()
 		m.jobQueue <- d
+		if limit := m.config.MaxSubmissions; limit > 0 && dispatched >= limit {
+			m.retire(fmt.Sprintf("dispatched its maximum of %d submissions", limit))
+		}
+	}
+}
+
+// nextDelivery receives the next delivery to dispatch, taking a waiting retry over a
+// waiting new submission. A closed retry lane is set to nil and no longer waited on.
+// It reports false once the submission channel is closed.
+func nextDelivery(msgs <-chan amqp091.Delivery, retries *<-chan amqp091.Delivery) (amqp091.Delivery, bool) {
+	for {
+		select {
+		case d, ok := <-*retries:
+			if ok {
+				return d, true
+			}
+			*retries = nil
+			continue
+		default:
+		}
+		select {
+		case d, ok := <-*retries:
+			if ok {
+				return d, true
+			}
+			*retries = nil
+		case d, ok := <-msgs:
+			return d, ok
+		}
+	}
+}
+
+// FlushResults publishes the results still waiting in a result batch, e.g. on shutdown.
+func (m *Master) FlushResults() {
+	if m.batcher != nil {
+		m.batcher.Flush()
+	}
+}
+
+// Pause stops dispatching submissions to the workers, e.g. to drain the executor before
+// maintenance. Jobs already dispatched run to completion; a delivery received while
+// paused stays unacknowledged on this executor until Resume is called.
+func (m *Master) Pause() {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	if !m.paused {
+		log.Println("Master paused. No new submissions will be dispatched.")
+	}
+	m.paused = true
+}
+
+// Resume restarts dispatching after Pause, unless the executor is retiring.
+func (m *Master) Resume() {
+	select {
+	case <-m.retiring:
+		log.Println("Master is retiring. Not resuming dispatch.")
+		return
+	default:
+	}
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	if m.paused {
+		log.Println("Master resumed. Dispatching submissions again.")
+	}
+	m.paused = false
+	m.unpaused.Broadcast()
+}
+
+// Paused reports whether dispatching is paused.
+func (m *Master) Paused() bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	return m.paused
+}
+
+// jobDone records that a worker finished a dispatched submission.
+func (m *Master) jobDone() {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	m.inFlight--
+	if m.inFlight == 0 {
+		m.idle.Broadcast()
+	}
+}
+
+// Drain pauses dispatching and waits until the workers finished every submission
+// dispatched to them, e.g. before the executor exits.
+func (m *Master) Drain() {
+	m.Pause()
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	for m.inFlight > 0 {
+		m.idle.Wait()
+	}
+}
+
+// retire pauses dispatching for good and closes Retiring, the first time it is called.
+func (m *Master) retire(reason string) {
+	m.retireOnce.Do(func() {
+		log.Printf("Executor %s. Draining before exit.", reason)
+		m.Pause()
+		close(m.retiring)
+	})
+}
+
+// Retiring is closed once the executor reached MaxSubmissions or MaxLifetime and
+// should drain and exit.
+func (m *Master) Retiring() <-chan struct{} {
+	return m.retiring
+}
+
+func (m *Master) waitWhilePaused() {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	for m.paused {
+		m.unpaused.Wait()
+	}
+}
+
+// admit checks that a delivery has an accepted content type and carries a valid submission.
+// Under DuplicateIDsSuffix it rewrites the delivery body with the renamed test cases.
+func (m *Master) admit(d *amqp091.Delivery) (types.SubmissionMessage, error) {
+	var submission types.SubmissionMessage
+	if !m.isAcceptedContentType(d.ContentType) {
+		return submission, fmt.Errorf("unsupported content type %q", d.ContentType)
+	}
+	if err := json.Unmarshal(d.Body, &submission); err != nil {
+		return submission, fmt.Errorf("error deserializing submission: %w", err)
+	}
+	if limit := m.config.MaxSubmissionBytes; limit > 0 && len(d.Body) > limit {
+		return submission, &oversizedError{size: len(d.Body), limit: limit}
+	}
+	if m.config.DuplicateTestCaseIDs == DuplicateIDsSuffix && submission.DisambiguateTestCaseIDs() {
+		log.Printf("[Submission %d] Renamed duplicate test case IDs.", submission.SubmissionID)
+		body, err := json.Marshal(submission)
+		if err != nil {
+			return submission, fmt.Errorf("error serializing submission %d: %w", submission.SubmissionID, err)
+		}
+		d.Body = body
+	}
+	if err := submission.Validate(); err != nil {
+		return submission, fmt.Errorf("invalid submission %d: %w", submission.SubmissionID, err)
+	}
+	return submission, nil
+}
+
+// oversizedError rejects a submission message larger than MaxSubmissionBytes.
+type oversizedError struct {
+	size, limit int
+}
+
+func (e *oversizedError) Error() string {
+	return fmt.Sprintf("submission is %d bytes, over the %d byte limit; generate large test data "+
+		"with a seeded generator program instead of sending it inline", e.size, e.limit)
+}
+
+// publishInvalid answers a submission that will not be judged with an INVALID verdict,
+// so that its author learns why instead of waiting for a result that never comes.
+func (m *Master) publishInvalid(submission types.SubmissionMessage, reason string) {
+	submissionID := submission.SubmissionID
+	exchange, routingKey := rabbitmq.ResultExchange, rabbitmq.ResultRoutingKey
+	if route, ok := m.config.Worker.ResultRoutes["INVALID"]; ok {
+		exchange, routingKey = route.Exchange, route.RoutingKey
+	}
+	result := types.ResultNotificationMessage{
+		SubmissionID: submissionID,
+		Status:       "INVALID",
+		Message:      reason,
+		Metadata:     submission.Metadata,
+	}
+	if err := m.mqClient.Publish(exchange, routingKey, result); err != nil {
+		log.Printf("[Submission %d] Failed to publish INVALID verdict: %v", submissionID, err)
+	}
+}
+
+func (m *Master) isAcceptedContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, accepted := range m.config.AcceptedContentTypes {
+		if strings.EqualFold(mediaType, accepted) {
+			return true
+		}
 	}
+	return false
 }
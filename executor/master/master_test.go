@@ -1,7 +1,14 @@
 package master
 
 import (
+	"encoding/json"
+	"online-judge/executor/docker"
+	"online-judge/executor/rabbitmq"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -18,10 +25,20 @@ func (m *mockClient) Publish(exchange, routingKey string, body interface{}) erro
 	return nil
 }
 
+// laneClient consumes a separate channel per queue.
+type laneClient struct {
+	testutil.RecordingClient
+	queues map[string]chan amqp091.Delivery
+}
+
+func (c *laneClient) ConsumeSubmissions(queueName string) (<-chan amqp091.Delivery, error) {
+	return c.queues[queueName], nil
+}
+
 func TestNewMaster(t *testing.T) {
 	mqClient := &mockClient{}
 
-	master, err := NewMaster(mqClient, 5, "test.queue")
+	master, err := NewMaster(mqClient, 5, "test.queue", DefaultConfig())
 	if err != nil {
 		t.Fatalf("NewMaster failed: %v", err)
 	}
@@ -43,7 +60,7 @@ func TestNewMaster(t *testing.T) {
 func TestNewMasterWithZeroWorkers(t *testing.T) {
 	mqClient := &mockClient{}
 
-	master, err := NewMaster(mqClient, 0, "test.queue")
+	master, err := NewMaster(mqClient, 0, "test.queue", DefaultConfig())
 	if err != nil {
 		t.Fatalf("NewMaster with zero workers failed: %v", err)
 	}
@@ -60,7 +77,7 @@ func TestMasterJobQueueCapacity(t *testing.T) {
 	workerCount := 10
 	mqClient := &mockClient{}
 
-	master, err := NewMaster(mqClient, workerCount, "test.queue")
+	master, err := NewMaster(mqClient, workerCount, "test.queue", DefaultConfig())
 	if err != nil {
 		t.Fatalf("NewMaster failed: %v", err)
 	}
@@ -69,3 +86,478 @@ func TestMasterJobQueueCapacity(t *testing.T) {
 		t.Errorf("Job queue capacity = %d, want %d", cap(master.jobQueue), workerCount)
 	}
 }
+
+func submissionDelivery(t *testing.T, tag uint64, contentType string, submission types.SubmissionMessage, acker amqp091.Acknowledger) amqp091.Delivery {
+	t.Helper()
+	body, err := json.Marshal(submission)
+	if err != nil {
+		t.Fatalf("failed to marshal submission: %v", err)
+	}
+	return amqp091.Delivery{Acknowledger: acker, DeliveryTag: tag, ContentType: contentType, Body: body}
+}
+
+func TestAdmit(t *testing.T) {
+	master, _ := NewMaster(&mockClient{}, 1, "test.queue", DefaultConfig())
+	valid := testutil.CreatePythonHelloWorldSubmission()
+
+	schemaInvalid := valid
+	schemaInvalid.Code = ""
+
+	tests := []struct {
+		name     string
+		delivery amqp091.Delivery
+		wantErr  bool
+	}{
+		{"valid json", submissionDelivery(t, 1, "application/json", valid, nil), false},
+		{"content type with charset", submissionDelivery(t, 1, "application/json; charset=utf-8", valid, nil), false},
+		{"json sent as text by the backend", submissionDelivery(t, 1, "text/plain", valid, nil), false},
+		{"text with charset", submissionDelivery(t, 1, "text/plain; charset=UTF-8", valid, nil), false},
+		{"missing content type", submissionDelivery(t, 1, "", valid, nil), false},
+		{"wrong content type", submissionDelivery(t, 1, "application/xml", valid, nil), true},
+		{"invalid json", amqp091.Delivery{ContentType: "application/json", Body: []byte("{not json")}, true},
+		{"schema invalid json", submissionDelivery(t, 1, "application/json", schemaInvalid, nil), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := master.admit(&tt.delivery)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("admit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdmitRejectsMissingRequiredFields(t *testing.T) {
+	valid := testutil.CreatePythonHelloWorldSubmission()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing submission id", `{"language":"PYTHON","code":"cHJpbnQoMSk=","timeLimit":1,"memoryLimit":64,"testCases":[]}`},
+		{"missing language", `{"submissionId":1,"code":"cHJpbnQoMSk=","timeLimit":1,"memoryLimit":64,"testCases":[]}`},
+		{"missing test cases", `{"submissionId":1,"language":"PYTHON","code":"cHJpbnQoMSk=","timeLimit":1,"memoryLimit":64}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acker := testutil.NewRecordingAcknowledger()
+			client := &testutil.RecordingClient{Deliveries: []amqp091.Delivery{
+				{Acknowledger: acker, DeliveryTag: 1, ContentType: "application/json", Body: []byte(tt.body)},
+				submissionDelivery(t, 2, "application/json", valid, acker),
+			}}
+			master, _ := NewMaster(client, 1, "test.queue", DefaultConfig())
+
+			master.consumeAndDispatch()
+
+			if s, ok := acker.Settlement(1); !ok || !s.Nacked || s.Requeued {
+				t.Errorf("malformed delivery = %+v, want nacked to the DLQ", s)
+			}
+			select {
+			case job := <-master.jobQueue:
+				if job.DeliveryTag != 2 {
+					t.Errorf("dispatched delivery %d, want only the valid delivery 2", job.DeliveryTag)
+				}
+			default:
+				t.Error("valid delivery was not dispatched")
+			}
+			if len(master.jobQueue) != 0 {
+				t.Errorf("%d extra deliveries reached the workers", len(master.jobQueue))
+			}
+		})
+	}
+}
+
+func TestAdmitDuplicateTestCaseIDs(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(1)", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", "1"),
+		testutil.CreateSimpleTestCase("tc1", "", "1"),
+		testutil.CreateSimpleTestCase("tc2", "", "1"),
+	})
+
+	strict, _ := NewMaster(&mockClient{}, 1, "test.queue", DefaultConfig())
+	delivery := submissionDelivery(t, 1, "application/json", submission, nil)
+	if _, err := strict.admit(&delivery); err == nil {
+		t.Error("admit() under the reject policy accepted duplicate test case IDs")
+	}
+
+	config := DefaultConfig()
+	config.DuplicateTestCaseIDs = DuplicateIDsSuffix
+	lenient, _ := NewMaster(&mockClient{}, 1, "test.queue", config)
+	delivery = submissionDelivery(t, 1, "application/json", submission, nil)
+	admitted, err := lenient.admit(&delivery)
+	if err != nil {
+		t.Fatalf("admit() under the suffix policy returned error: %v", err)
+	}
+
+	// Workers read the delivery body, so the renamed IDs must be in it.
+	var dispatched types.SubmissionMessage
+	if err := json.Unmarshal(delivery.Body, &dispatched); err != nil {
+		t.Fatalf("dispatched body is not a submission: %v", err)
+	}
+	for _, got := range []types.SubmissionMessage{admitted, dispatched} {
+		var ids []string
+		for _, testCase := range got.TestCases {
+			ids = append(ids, testCase.TestCaseID)
+		}
+		if strings.Join(ids, ",") != "tc1,tc1#2,tc2" {
+			t.Errorf("test case IDs = %v, want [tc1 tc1#2 tc2]", ids)
+		}
+	}
+}
+
+func TestAdmitConfiguredContentTypes(t *testing.T) {
+	config := DefaultConfig()
+	config.AcceptedContentTypes = []string{"application/json"}
+	master, _ := NewMaster(&mockClient{}, 1, "test.queue", config)
+
+	delivery := submissionDelivery(t, 1, "application/json", testutil.CreatePythonHelloWorldSubmission(), nil)
+	if _, err := master.admit(&delivery); err != nil {
+		t.Errorf("admit() with a configured content type returned error: %v", err)
+	}
+	delivery = submissionDelivery(t, 2, "text/plain", testutil.CreatePythonHelloWorldSubmission(), nil)
+	if _, err := master.admit(&delivery); err == nil {
+		t.Error("admit() admitted text/plain, which is no longer configured")
+	}
+}
+
+func TestConsumeAndDispatchRejectsToDLQ(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	valid := testutil.CreatePythonHelloWorldSubmission()
+	schemaInvalid := valid
+	schemaInvalid.TimeLimit = 0
+
+	client := &testutil.RecordingClient{Deliveries: []amqp091.Delivery{
+		submissionDelivery(t, 1, "application/xml", valid, acker),
+		{Acknowledger: acker, DeliveryTag: 2, ContentType: "application/json", Body: []byte("not json")},
+		submissionDelivery(t, 3, "application/json", schemaInvalid, acker),
+		submissionDelivery(t, 4, "text/plain", valid, acker),
+	}}
+	master, _ := NewMaster(client, 1, "test.queue", DefaultConfig())
+
+	master.consumeAndDispatch()
+
+	for _, tag := range []uint64{1, 2, 3} {
+		s, ok := acker.Settlement(tag)
+		if !ok || !s.Nacked || s.Requeued || s.Acked {
+			t.Errorf("delivery %d = %+v, want nacked without requeue", tag, s)
+		}
+	}
+	if s, ok := acker.Settlement(4); ok {
+		t.Errorf("valid delivery should not be settled by the master, got %+v", s)
+	}
+
+	select {
+	case d := <-master.jobQueue:
+		if d.DeliveryTag != 4 {
+			t.Errorf("dispatched delivery %d, want 4", d.DeliveryTag)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("valid delivery was not dispatched")
+	}
+	if len(master.jobQueue) != 0 {
+		t.Errorf("job queue has %d extra deliveries, want 0", len(master.jobQueue))
+	}
+}
+
+func TestConsumeAndDispatchRejectsOversizedSubmissions(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	small := testutil.CreatePythonHelloWorldSubmission()
+	large := testutil.CreateTestSubmission(2, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", strings.Repeat("1", 4096), strings.Repeat("1", 4096)),
+	})
+	large.Metadata = map[string]string{"userId": "42"}
+	client := &testutil.RecordingClient{Deliveries: []amqp091.Delivery{
+		submissionDelivery(t, 1, "application/json", small, acker),
+		submissionDelivery(t, 2, "application/json", large, acker),
+	}}
+	config := DefaultConfig()
+	config.MaxSubmissionBytes = 4096
+	master, _ := NewMaster(client, 1, "test.queue", config)
+
+	master.consumeAndDispatch()
+
+	if s, ok := acker.Settlement(2); !ok || !s.Nacked || s.Requeued {
+		t.Errorf("oversized delivery = %+v, want nacked without requeue", s)
+	}
+	if n := len(master.jobQueue); n != 1 {
+		t.Errorf("%d deliveries dispatched, want only the small one", n)
+	}
+
+	published := client.Published()
+	if len(published) != 1 || published[0].Exchange != rabbitmq.ResultExchange {
+		t.Fatalf("published %+v, want one result", published)
+	}
+	result, ok := published[0].Body.(types.ResultNotificationMessage)
+	if !ok || result.SubmissionID != 2 || result.Status != "INVALID" {
+		t.Fatalf("published %+v, want an INVALID verdict for submission 2", published[0].Body)
+	}
+	if !strings.Contains(result.Message, "4096 byte limit") || !strings.Contains(result.Message, "generator") {
+		t.Errorf("Message = %q, want the limit and the generator recommendation", result.Message)
+	}
+	if result.Metadata["userId"] != "42" {
+		t.Errorf("Metadata = %v, want the submission's metadata", result.Metadata)
+	}
+}
+
+func TestPauseAndResumeDispatch(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	client := &testutil.RecordingClient{Deliveries: []amqp091.Delivery{
+		submissionDelivery(t, 1, "application/json", testutil.CreatePythonHelloWorldSubmission(), acker),
+		submissionDelivery(t, 2, "application/json", testutil.CreatePythonHelloWorldSubmission(), acker),
+	}}
+	master, _ := NewMaster(client, 2, "test.queue", DefaultConfig())
+
+	master.Pause()
+	if !master.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		master.consumeAndDispatch()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := len(master.jobQueue); n != 0 {
+		t.Fatalf("%d deliveries dispatched while paused, want 0", n)
+	}
+
+	master.Resume()
+	if master.Paused() {
+		t.Fatal("Paused() = true after Resume")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch did not resume")
+	}
+	if n := len(master.jobQueue); n != 2 {
+		t.Errorf("%d deliveries dispatched after resume, want 2", n)
+	}
+}
+
+func TestRetiresAfterMaxSubmissions(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	client := &testutil.RecordingClient{}
+	for tag := uint64(1); tag <= 3; tag++ {
+		client.Deliveries = append(client.Deliveries, submissionDelivery(t, tag, "application/json", testutil.CreatePythonHelloWorldSubmission(), acker))
+	}
+	config := DefaultConfig()
+	config.MaxSubmissions = 2
+	master, _ := NewMaster(client, 2, "test.queue", config)
+	go master.consumeAndDispatch()
+
+	select {
+	case <-master.Retiring():
+	case <-time.After(time.Second):
+		t.Fatal("executor did not retire after MaxSubmissions")
+	}
+	if !master.Paused() {
+		t.Error("Paused() = false, want dispatching stopped while retiring")
+	}
+	master.Resume()
+	time.Sleep(100 * time.Millisecond)
+	if n := len(master.jobQueue); n != 2 {
+		t.Fatalf("%d deliveries dispatched, want 2", n)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		master.Drain()
+	}()
+	for i := 0; i < 2; i++ {
+		<-master.jobQueue
+		select {
+		case <-drained:
+			t.Fatalf("Drain returned with %d submissions in flight", 2-i)
+		case <-time.After(50 * time.Millisecond):
+		}
+		master.jobDone()
+	}
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return once the submissions in flight were done")
+	}
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.HeartbeatInterval = 20 * time.Millisecond
+	config.ExecutorID = "executor-1"
+	master, _ := NewMaster(client, 3, "test.queue", config)
+	master.Pause()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		master.sendHeartbeats(done)
+	}()
+	time.Sleep(110 * time.Millisecond)
+	close(done)
+	<-stopped
+
+	published := client.Published()
+	if n := len(published); n < 3 || n > 6 {
+		t.Fatalf("%d heartbeats in 110ms at a 20ms interval, want about 5", n)
+	}
+	var last time.Time
+	for _, p := range published {
+		if p.Exchange != rabbitmq.HeartbeatExchange || p.RoutingKey != rabbitmq.HeartbeatRoutingKey {
+			t.Fatalf("published to %s/%s, want the heartbeat exchange", p.Exchange, p.RoutingKey)
+		}
+		heartbeat, ok := p.Body.(types.HeartbeatMessage)
+		if !ok {
+			t.Fatalf("published %T, want types.HeartbeatMessage", p.Body)
+		}
+		if heartbeat.ExecutorID != "executor-1" || heartbeat.Workers != 3 || heartbeat.Busy != 0 || !heartbeat.Paused {
+			t.Errorf("heartbeat = %+v, want executor-1 with 3 idle workers, paused", heartbeat)
+		}
+		if len(heartbeat.Languages) == 0 {
+			t.Error("heartbeat lists no languages")
+		}
+		if !heartbeat.Timestamp.After(last) {
+			t.Errorf("heartbeat timestamp %v is not after %v", heartbeat.Timestamp, last)
+		}
+		last = heartbeat.Timestamp
+	}
+}
+
+func TestConsumeAndDispatchRetriesAheadOfNewSubmissions(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	newSubmissions := make(chan amqp091.Delivery)
+	client := &laneClient{queues: map[string]chan amqp091.Delivery{
+		"test.queue":       newSubmissions,
+		"test.queue.retry": make(chan amqp091.Delivery, 1),
+	}}
+	config := DefaultConfig()
+	config.Worker.RetryQueue = "test.queue.retry"
+	master, _ := NewMaster(client, 1, "test.queue", config)
+
+	// New submissions keep arriving for as long as the test runs
+	fresh := submissionDelivery(t, 2, "application/json", testutil.CreatePythonHelloWorldSubmission(), acker)
+	done := make(chan struct{})
+	go func() {
+		defer close(newSubmissions)
+		for {
+			select {
+			case newSubmissions <- fresh:
+			case <-done:
+				return
+			}
+		}
+	}()
+	stopped := make(chan struct{})
+	go func() {
+		master.consumeAndDispatch()
+		close(stopped)
+	}()
+	defer func() {
+		close(done)
+		for {
+			select {
+			case <-master.jobQueue:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	// The busy worker takes a few new submissions before the retry comes in
+	for i := 0; i < 5; i++ {
+		<-master.jobQueue
+	}
+	retried := testutil.CreatePythonHelloWorldSubmission()
+	retried.SubmissionID, retried.Attempts = 7, 1
+	client.queues["test.queue.retry"] <- submissionDelivery(t, 7, "application/json", retried, acker)
+
+	// At most the one queued for the worker and the one the master holds go first
+	for i := 0; i < 3; i++ {
+		if d := <-master.jobQueue; d.DeliveryTag == 7 {
+			return
+		}
+	}
+	t.Error("retry was not dispatched ahead of the continuously arriving submissions")
+}
+
+// qosClient emulates the broker's per-consumer prefetch: a consumer holds at most
+// prefetch unacknowledged deliveries, and only gets the next one once one is settled.
+type qosClient struct {
+	testutil.RecordingClient
+	submissions []types.SubmissionMessage
+	prefetch    int
+	credits     chan struct{}
+}
+
+func (c *qosClient) SetPrefetch(count int) {
+	c.prefetch = count
+}
+
+func (c *qosClient) ConsumeSubmissions(queueName string) (<-chan amqp091.Delivery, error) {
+	c.credits = make(chan struct{}, c.prefetch+len(c.submissions)+1)
+	for i := 0; i < c.prefetch || i == 0; i++ {
+		c.credits <- struct{}{}
+	}
+	msgs := make(chan amqp091.Delivery)
+	go func() {
+		for i, submission := range c.submissions {
+			<-c.credits
+			delivery := testutil.CreateTestDelivery(submission)
+			delivery.Acknowledger, delivery.DeliveryTag = c, uint64(i+1)
+			msgs <- delivery
+		}
+	}()
+	return msgs, nil
+}
+
+func (c *qosClient) Ack(tag uint64, multiple bool) error {
+	c.credits <- struct{}{}
+	return nil
+}
+
+func (c *qosClient) Nack(tag uint64, multiple bool, requeue bool) error {
+	c.credits <- struct{}{}
+	return nil
+}
+
+func (c *qosClient) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+func TestResultBatchFillsWithinPrefetch(t *testing.T) {
+	const batchSize = 4
+	client := &qosClient{}
+	for id := int64(1); id <= batchSize; id++ {
+		submission := testutil.CreatePythonHelloWorldSubmission()
+		submission.SubmissionID = id
+		submission.Rejudge = true
+		client.submissions = append(client.submissions, submission)
+	}
+	config := DefaultConfig()
+	config.Worker.ResultBatchSize = batchSize
+	config.Worker.ResultBatchDelay = time.Minute // Only a full batch is published in time
+	config.Worker.Runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+	master, _ := NewMaster(client, 2, "test.queue", config)
+	master.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, p := range client.Published() {
+			if batch, ok := p.Body.(types.ResultBatchMessage); ok {
+				if len(batch.Results) != batchSize {
+					t.Fatalf("published a batch of %d results, want %d", len(batch.Results), batchSize)
+				}
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no full batch published with a prefetch of %d for 2 workers", client.prefetch)
+}
@@ -2,18 +2,24 @@ package rabbitmq
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
 // Exchange and Routing Key constants, must match the Java backend configuration.
 const (
-	ResultExchange   = "oj.ex.results"
-	ResultRoutingKey = "submission.result"
-	StatusExchange   = "oj.ex.status"
-	StatusRoutingKey = "submission.status"
+	ResultExchange        = "oj.ex.results"
+	ResultRoutingKey      = "submission.result"
+	ResultBatchRoutingKey = "submission.result.batch"
+	StatusExchange        = "oj.ex.status"
+	StatusRoutingKey      = "submission.status"
+
+	HeartbeatExchange   = "oj.ex.heartbeats"
+	HeartbeatRoutingKey = "executor.heartbeat"
 )
 
 type ClientInterface interface {
@@ -24,8 +30,64 @@ type ClientInterface interface {
 type Client struct {
 	conn *amqp091.Connection
 	ch   *amqp091.Channel
+
+	// Messages are published on a channel of their own: the broker closes the channel
+	// a publish to a missing exchange was sent on, which must not end the consumers.
+	// The channel is in confirm mode, since a publish only fails later, asynchronously:
+	// the broker answers a missing exchange by closing the channel, which nacks the
+	// publishes awaiting confirmation.
+	pubMu         sync.Mutex
+	pub           publisher
+	openPublisher func() (publisher, error)
+	exchanges     []string // Declared so far, declared again on a new publish channel
+
+	prefetch int
+}
+
+// exchangeDeclarer is the part of an AMQP channel that declares exchanges.
+type exchangeDeclarer interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error
+}
+
+// publisher is the part of an AMQP channel in confirm mode that publishing uses.
+type publisher interface {
+	exchangeDeclarer
+	PublishWithDeferredConfirm(exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) (confirmation, error)
+	Close() error
+}
+
+// confirmation is the broker's pending answer to a publish.
+type confirmation interface {
+	// Wait blocks until the broker acked (true) or nacked the message. Closing the
+	// channel nacks the messages still awaiting confirmation.
+	Wait() bool
+}
+
+// confirmChannel is an AMQP channel put in confirm mode.
+type confirmChannel struct {
+	*amqp091.Channel
 }
 
+func openConfirmChannel(conn *amqp091.Connection) (*confirmChannel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	return &confirmChannel{ch}, nil
+}
+
+func (c *confirmChannel) PublishWithDeferredConfirm(exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) (confirmation, error) {
+	return c.Channel.PublishWithDeferredConfirm(exchange, key, mandatory, immediate, msg)
+}
+
+// errNotConfirmed fails a publish the broker nacked, typically because it closed the
+// channel over a missing exchange.
+var errNotConfirmed = errors.New("the broker did not confirm the message")
+
 func NewClient(url string) (*Client, error) {
 	conn, err := amqp091.Dial(url)
 	if err != nil {
@@ -38,24 +100,47 @@ func NewClient(url string) (*Client, error) {
 		return nil, fmt.Errorf("failed to open a channel: %w", err)
 	}
 
+	client := &Client{conn: conn, ch: ch}
+	client.openPublisher = func() (publisher, error) {
+		pub, err := openConfirmChannel(conn)
+		if err != nil {
+			return nil, err
+		}
+		return pub, nil
+	}
+	if client.pub, err = client.openPublisher(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to open a publish channel: %w", err)
+	}
+
 	// Declare exchanges to ensure they exist.
-	err = ch.ExchangeDeclare(
-		ResultExchange,
-		"direct", // kind
-		true,     // durable
-		false,    // autoDelete
-		false,    // internal
-		false,    // noWait
-		nil,      // args
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
+	if err := client.DeclareExchange(ResultExchange); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to declare result exchange: %w", err)
 	}
+	if err := client.DeclareExchange(StatusExchange); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to declare status exchange: %w", err)
+	}
 
-	err = ch.ExchangeDeclare(
-		StatusExchange,
+	return client, nil
+}
+
+// DeclareExchange declares a durable direct exchange, creating it if it does not exist.
+// The client declares it again whenever publishing finds it missing.
+func (c *Client) DeclareExchange(name string) error {
+	if err := declareExchange(c.ch, name); err != nil {
+		return err
+	}
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+	c.exchanges = append(c.exchanges, name)
+	return nil
+}
+
+func declareExchange(ch exchangeDeclarer, name string) error {
+	return ch.ExchangeDeclare(
+		name,
 		"direct", // kind
 		true,     // durable
 		false,    // autoDelete
@@ -63,20 +148,57 @@ func NewClient(url string) (*Client, error) {
 		false,    // noWait
 		nil,      // args
 	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare status exchange: %w", err)
-	}
+}
+
+// queueDeclarer is the part of an AMQP channel that declares queues.
+type queueDeclarer interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error)
+}
+
+// DeclareQueue declares a durable queue, creating it if it does not exist.
+func (c *Client) DeclareQueue(name string) error {
+	return declareQueue(c.ch, name, nil)
+}
+
+// DeclarePriorityQueue declares a durable queue that delivers messages with a higher
+// AMQP priority property first, honoring priorities up to maxPriority. Declaring an
+// existing queue with different arguments fails, so the queue must have been created
+// as a priority queue (or not at all) beforehand.
+func (c *Client) DeclarePriorityQueue(name string, maxPriority uint8) error {
+	return declarePriorityQueue(c.ch, name, maxPriority)
+}
+
+func declarePriorityQueue(ch queueDeclarer, name string, maxPriority uint8) error {
+	return declareQueue(ch, name, amqp091.Table{"x-max-priority": int32(maxPriority)})
+}
 
-	return &Client{conn: conn, ch: ch}, nil
+func declareQueue(ch queueDeclarer, name string, args amqp091.Table) error {
+	_, err := ch.QueueDeclare(
+		name,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		args,
+	)
+	return err
+}
+
+// SetPrefetch sets how many unacknowledged submissions each consumer started afterwards
+// may hold, e.g. one per worker. Less than one means one.
+func (c *Client) SetPrefetch(count int) {
+	c.prefetch = count
 }
 
 func (c *Client) ConsumeSubmissions(queueName string) (<-chan amqp091.Delivery, error) {
+	prefetch := c.prefetch
+	if prefetch < 1 {
+		prefetch = 1
+	}
 	err := c.ch.Qos(
-		1,     // prefetchCount: Each worker gets one message at a time.
-		0,     // prefetchSize
-		false, // global
+		prefetch, // prefetchCount
+		0,        // prefetchSize
+		false,    // global: per consumer
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to set QoS: %w", err)
@@ -98,21 +220,35 @@ func (c *Client) ConsumeSubmissions(queueName string) (<-chan amqp091.Delivery,
 }
 
 func (c *Client) Publish(exchange, routingKey string, body interface{}) error {
+	return c.PublishWithPriority(exchange, routingKey, body, 0)
+}
+
+// PublishWithPriority publishes like Publish, with the given AMQP priority property,
+// which a priority queue delivers ahead of lower priorities.
+func (c *Client) PublishWithPriority(exchange, routingKey string, body interface{}, priority uint8) error {
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to marshal body to JSON: %w", err)
 	}
 
-	err = c.ch.Publish(
-		exchange,
-		routingKey,
-		false, // mandatory
-		false, // immediate
-		amqp091.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp091.Persistent,
-			Body:         jsonBody,
-		})
+	msg := amqp091.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp091.Persistent,
+		Priority:     priority,
+		Body:         jsonBody,
+	}
+	c.pubMu.Lock()
+	pub := c.pub
+	c.pubMu.Unlock()
+	err = publishConfirmed(pub, exchange, routingKey, msg)
+	if err != nil && exchangeMissing(err) {
+		// E.g. the broker was reset: declare the exchanges again and retry once, instead
+		// of failing the publish and having the submission judged all over again
+		log.Printf("Publishing to exchange '%s' failed: %v. Declaring the exchanges again.", exchange, err)
+		if pub, err = c.reopenPublisher(pub); err == nil {
+			err = publishConfirmed(pub, exchange, routingKey, msg)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to publish a message: %w", err)
 	}
@@ -120,7 +256,57 @@ func (c *Client) Publish(exchange, routingKey string, body interface{}) error {
 	return nil
 }
 
+// publishConfirmed publishes a message and waits for the broker to confirm it.
+func publishConfirmed(pub publisher, exchange, routingKey string, msg amqp091.Publishing) error {
+	confirmation, err := pub.PublishWithDeferredConfirm(exchange, routingKey, false, false, msg) // Neither mandatory nor immediate
+	if err != nil {
+		return err
+	}
+	if !confirmation.Wait() {
+		return errNotConfirmed
+	}
+	return nil
+}
+
+// exchangeMissing reports whether a publish failed because its exchange does not
+// exist: the broker nacked it by closing its channel, or the channel was already
+// closed by an earlier publish to a missing exchange.
+func exchangeMissing(err error) bool {
+	if errors.Is(err, errNotConfirmed) {
+		return true
+	}
+	var amqpErr *amqp091.Error
+	return errors.As(err, &amqpErr) && (amqpErr.Code == amqp091.NotFound || amqpErr.Code == amqp091.ChannelError)
+}
+
+// reopenPublisher replaces the publish channel failed with a new one, on which it
+// declares the client's exchanges again. When another publish already replaced failed,
+// its replacement is returned.
+func (c *Client) reopenPublisher(failed publisher) (publisher, error) {
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+	if c.pub != failed {
+		return c.pub, nil
+	}
+	failed.Close()
+	pub, err := c.openPublisher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen the publish channel: %w", err)
+	}
+	for _, name := range c.exchanges {
+		if err := declareExchange(pub, name); err != nil {
+			pub.Close()
+			return nil, fmt.Errorf("failed to declare exchange %s again: %w", name, err)
+		}
+	}
+	c.pub = pub
+	return pub, nil
+}
+
 func (c *Client) Close() {
+	if c.pub != nil {
+		c.pub.Close()
+	}
 	if c.ch != nil {
 		c.ch.Close()
 	}
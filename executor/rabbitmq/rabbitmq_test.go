@@ -2,6 +2,8 @@ package rabbitmq
 
 import (
 	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
 )
 
 func TestConstants(t *testing.T) {
@@ -23,3 +25,157 @@ func TestClientClose(t *testing.T) {
 	client := &Client{ch: nil, conn: nil}
 	client.Close()
 }
+
+// fakeQueueChannel records the queues declared on it.
+type fakeQueueChannel struct {
+	declared map[string]amqp091.Table
+}
+
+func (c *fakeQueueChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+	if !durable || autoDelete || exclusive {
+		return amqp091.Queue{}, &amqp091.Error{Code: amqp091.PreconditionFailed, Reason: "submission queues are durable and shared"}
+	}
+	c.declared[name] = args
+	return amqp091.Queue{Name: name}, nil
+}
+
+func TestDeclarePriorityQueue(t *testing.T) {
+	ch := &fakeQueueChannel{declared: map[string]amqp091.Table{}}
+	if err := declarePriorityQueue(ch, "submission.queue", 10); err != nil {
+		t.Fatalf("declarePriorityQueue() failed: %v", err)
+	}
+	// The broker expects x-max-priority as a signed integer argument
+	if got, ok := ch.declared["submission.queue"]["x-max-priority"].(int32); !ok || got != 10 {
+		t.Errorf("x-max-priority = %#v, want int32(10)", ch.declared["submission.queue"]["x-max-priority"])
+	}
+	if err := declareQueue(ch, "plain.queue", nil); err != nil || ch.declared["plain.queue"] != nil {
+		t.Errorf("declareQueue() = %v with args %v, want a queue without arguments", err, ch.declared["plain.queue"])
+	}
+}
+
+// fakeBroker holds the exchanges that exist, shared by the fake channels opened on it.
+type fakeBroker struct {
+	exchanges  map[string]bool
+	published  []string
+	priorities []uint8
+	opened     int
+}
+
+func (b *fakeBroker) open() (publisher, error) {
+	b.opened++
+	return &fakeChannel{broker: b}, nil
+}
+
+// fakeChannel behaves like an AMQP channel in confirm mode: a publish to a missing
+// exchange is sent without error, but the broker then closes the channel, nacking it,
+// and later publishes fail with ErrClosed.
+type fakeChannel struct {
+	broker *fakeBroker
+	closed bool
+}
+
+// fakeConfirmation is the broker's answer to a publish.
+type fakeConfirmation bool
+
+func (c fakeConfirmation) Wait() bool {
+	return bool(c)
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error {
+	if c.closed {
+		return amqp091.ErrClosed
+	}
+	c.broker.exchanges[name] = true
+	return nil
+}
+
+func (c *fakeChannel) PublishWithDeferredConfirm(exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) (confirmation, error) {
+	if c.closed {
+		return nil, amqp091.ErrClosed
+	}
+	if !c.broker.exchanges[exchange] {
+		c.closed = true // NOT_FOUND closes the channel
+		return fakeConfirmation(false), nil
+	}
+	c.broker.published = append(c.broker.published, exchange)
+	c.broker.priorities = append(c.broker.priorities, msg.Priority)
+	return fakeConfirmation(true), nil
+}
+
+func (c *fakeChannel) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestPublishDeclaresMissingExchangeAgain(t *testing.T) {
+	broker := &fakeBroker{exchanges: map[string]bool{ResultExchange: true, StatusExchange: true}}
+	pub, _ := broker.open()
+	client := &Client{pub: pub, openPublisher: broker.open, exchanges: []string{ResultExchange, StatusExchange}}
+
+	if err := client.Publish(ResultExchange, ResultRoutingKey, "first"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	// The broker is reset and loses its exchanges
+	broker.exchanges = map[string]bool{}
+	if err := client.Publish(ResultExchange, ResultRoutingKey, "second"); err != nil {
+		t.Fatalf("Publish after the exchange went missing failed: %v", err)
+	}
+	if !broker.exchanges[ResultExchange] || !broker.exchanges[StatusExchange] {
+		t.Errorf("exchanges = %v, want both declared again", broker.exchanges)
+	}
+	if broker.opened != 2 {
+		t.Errorf("opened %d publish channels, want 2", broker.opened)
+	}
+	if err := client.Publish(StatusExchange, StatusRoutingKey, "third"); err != nil {
+		t.Fatalf("Publish on the new channel failed: %v", err)
+	}
+	if len(broker.published) != 3 {
+		t.Errorf("published to %v, want 3 messages", broker.published)
+	}
+}
+
+func TestPublishWithPriority(t *testing.T) {
+	broker := &fakeBroker{exchanges: map[string]bool{"": true}}
+	pub, _ := broker.open()
+	client := &Client{pub: pub, openPublisher: broker.open}
+
+	if err := client.PublishWithPriority("", "submission.queue", "urgent", 7); err != nil {
+		t.Fatalf("PublishWithPriority failed: %v", err)
+	}
+	if err := client.Publish("", "submission.queue", "regular"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if len(broker.priorities) != 2 || broker.priorities[0] != 7 || broker.priorities[1] != 0 {
+		t.Errorf("published with priorities %v, want [7 0]", broker.priorities)
+	}
+}
+
+func TestPublishFailsForUndeclaredExchange(t *testing.T) {
+	broker := &fakeBroker{exchanges: map[string]bool{}}
+	pub, _ := broker.open()
+	client := &Client{pub: pub, openPublisher: broker.open}
+
+	// Declaring the known exchanges again cannot create one the client never declared
+	if err := client.Publish("oj.ex.unknown", "key", "body"); err == nil {
+		t.Fatal("Publish to an exchange that was never declared succeeded, want an error")
+	}
+	if broker.opened != 2 {
+		t.Errorf("opened %d publish channels, want a single retry", broker.opened)
+	}
+}
+
+func TestPublishReopensClosedChannel(t *testing.T) {
+	broker := &fakeBroker{exchanges: map[string]bool{ResultExchange: true}}
+	pub, _ := broker.open()
+	client := &Client{pub: pub, openPublisher: broker.open, exchanges: []string{ResultExchange}}
+
+	// The channel was closed by an earlier publish to a missing exchange
+	pub.Close()
+	if err := client.Publish(ResultExchange, ResultRoutingKey, "body"); err != nil {
+		t.Fatalf("Publish on a closed channel failed: %v", err)
+	}
+	if broker.opened != 2 || len(broker.published) != 1 {
+		t.Errorf("opened %d channels and published %v, want 2 channels and 1 message", broker.opened, broker.published)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"online-judge/executor/types"
+	"online-judge/executor/worker"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// streamEvent is a server-sent event: its name and the value sent as its JSON data.
+type streamEvent struct {
+	name string
+	data interface{}
+}
+
+// testCaseProgress is the data of a testCase event.
+type testCaseProgress struct {
+	SubmissionID int64                       `json:"submissionId"`
+	Judged       int                         `json:"judged"`
+	Total        int                         `json:"total"`
+	Result       types.TestCaseResultMessage `json:"result"`
+}
+
+// streamClient turns what a worker publishes into events: status updates into status
+// events and the final result into a result event. Once the stream is closed, events
+// are dropped instead of blocking the worker.
+type streamClient struct {
+	events chan<- streamEvent
+	closed <-chan struct{}
+}
+
+func (c *streamClient) ConsumeSubmissions(queueName string) (<-chan amqp091.Delivery, error) {
+	return nil, fmt.Errorf("a stream does not consume from queue %s", queueName)
+}
+
+func (c *streamClient) Publish(exchange, routingKey string, body interface{}) error {
+	switch body.(type) {
+	case types.StatusUpdateMessage:
+		c.send(streamEvent{"status", body})
+	case types.ResultNotificationMessage:
+		c.send(streamEvent{"result", body})
+	}
+	return nil
+}
+
+func (c *streamClient) send(event streamEvent) {
+	select {
+	case c.events <- event:
+	case <-c.closed:
+	}
+}
+
+// runStreamHandler judges the submission in the submission query parameter (its JSON
+// form) and streams its progress as server-sent events: a status event for QUEUED,
+// COMPILING (for compiled languages) and RUNNING, a testCase event as each test case is
+// judged, then the result event. The submission goes through the same pipeline as a
+// queued one, with the given settings. At most maxJudging streamed submissions are
+// judged at once; the others stay QUEUED until one is done. A submission whose client
+// disconnects stops being judged.
+func runStreamHandler(config worker.Config, maxJudging int) http.HandlerFunc {
+	judging := make(chan struct{}, maxJudging)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		var submission types.SubmissionMessage
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("submission")), &submission); err != nil {
+			http.Error(w, fmt.Sprintf("invalid submission: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := submission.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid submission: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		events := make(chan streamEvent)
+		closed := make(chan struct{})
+		defer close(closed)
+		client := &streamClient{events: events, closed: closed}
+
+		// The stream is not a queue: nothing is retried, batched or routed elsewhere
+		config := config
+		config.MaxAttempts = 0
+		config.Batcher = nil
+		config.ResultRoutes = nil
+		config.JobDone = nil
+		config.ReportCompiling = true
+		config.Progress = func(submissionID int64, result types.TestCaseResultMessage, judged, total int) {
+			client.send(streamEvent{"testCase", testCaseProgress{submissionID, judged, total, result}})
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		writeEvent(w, flusher, streamEvent{"status", types.StatusUpdateMessage{SubmissionID: submission.SubmissionID, Status: "QUEUED"}})
+
+		select {
+		case judging <- struct{}{}:
+		case <-r.Context().Done():
+			log.Printf("[Submission %d] Stream closed by the client while queued.", submission.SubmissionID)
+			return
+		}
+		go func() {
+			// The slot is only free once judging stopped, not when the client left
+			defer func() { <-judging }()
+			defer close(events)
+			if err := worker.NewWorker(0, nil, client, config).Judge(r.Context(), submission); err != nil {
+				log.Printf("[Submission %d] Failed to judge streamed submission: %v", submission.SubmissionID, err)
+			}
+		}()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				writeEvent(w, flusher, event)
+			case <-r.Context().Done():
+				log.Printf("[Submission %d] Stream closed by the client before the result.", submission.SubmissionID)
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, event streamEvent) {
+	data, err := json.Marshal(event.data)
+	if err != nil {
+		log.Printf("Failed to serialize %s event: %v", event.name, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+	flusher.Flush()
+}
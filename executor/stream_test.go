@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"online-judge/executor/worker"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunStreamHandler(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "CPP", "int main() {}", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "1", "1"),
+		testutil.CreateSimpleTestCase("tc2", "2", "2"),
+		testutil.CreateSimpleTestCase("tc3", "3", "4"),
+	})
+	config := worker.DefaultConfig()
+	config.Runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	runStreamHandler(config, 1).ServeHTTP(rec, streamRequest(t, submission))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	events, data := readEvents(rec)
+	want := []string{"status", "status", "status", "testCase", "testCase", "testCase", "result"}
+	if strings.Join(events, ",") != strings.Join(want, ",") || len(data) != len(want) {
+		t.Fatalf("events = %v, want %v each with data", events, want)
+	}
+
+	for i, status := range []string{"QUEUED", "COMPILING", "RUNNING"} {
+		var update types.StatusUpdateMessage
+		if err := json.Unmarshal([]byte(data[i]), &update); err != nil || update.Status != status {
+			t.Errorf("status event %d = %s, want %s", i, data[i], status)
+		}
+	}
+	for i, status := range []string{"PASSED", "PASSED", "WRONG_ANSWER"} {
+		var progress testCaseProgress
+		if err := json.Unmarshal([]byte(data[3+i]), &progress); err != nil {
+			t.Fatalf("failed to decode testCase event: %v", err)
+		}
+		if progress.Judged != i+1 || progress.Total != 3 || progress.Result.Status != status {
+			t.Errorf("testCase event %d = %+v, want %d/3 %s", i, progress, i+1, status)
+		}
+	}
+	var result types.ResultNotificationMessage
+	if err := json.Unmarshal([]byte(data[6]), &result); err != nil || result.Status != "WRONG_ANSWER" || len(result.Results) != 3 {
+		t.Errorf("result event = %s, want WRONG_ANSWER with 3 test cases", data[6])
+	}
+}
+
+func TestRunStreamHandlerInterpretedSkipsCompiling(t *testing.T) {
+	config := worker.DefaultConfig()
+	config.Runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	runStreamHandler(config, 1).ServeHTTP(rec, streamRequest(t, testutil.CreatePythonHelloWorldSubmission()))
+
+	events, data := readEvents(rec)
+	if strings.Join(events, ",") != "status,status,testCase,result" || !strings.Contains(data[1], `"RUNNING"`) {
+		t.Errorf("events = %v %v, want QUEUED and RUNNING only", events, data)
+	}
+}
+
+func TestRunStreamHandlerStopsJudgingWhenClientLeaves(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "1", "1"),
+		testutil.CreateSimpleTestCase("tc2", "2", "2"),
+		testutil.CreateSimpleTestCase("tc3", "3", "3"),
+	})
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var runs int32
+	config := worker.DefaultConfig()
+	config.Runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		atomic.AddInt32(&runs, 1)
+		started <- struct{}{}
+		<-release
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+	}
+	handler := runStreamHandler(config, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), streamRequest(t, submission).WithContext(ctx))
+	}()
+	<-started
+	cancel()
+	<-done
+	close(release)
+
+	// The only slot is free once the abandoned submission stopped being judged
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, streamRequest(t, submission))
+	if events, _ := readEvents(rec); len(events) == 0 || events[len(events)-1] != "result" {
+		t.Fatalf("events = %v, want a result for the second stream", events)
+	}
+	if n := atomic.LoadInt32(&runs); n != 4 {
+		t.Errorf("ran %d test cases, want 1 before the client left and 3 for the second stream", n)
+	}
+}
+
+func TestRunStreamHandlerLimitsConcurrentJudging(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	ran := map[int64]bool{}
+	config := worker.DefaultConfig()
+	config.Runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		mu.Lock()
+		ran[req.SubmissionID] = true
+		mu.Unlock()
+		<-release
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+	handler := runStreamHandler(config, 1)
+
+	recs := []*httptest.ResponseRecorder{httptest.NewRecorder(), httptest.NewRecorder()}
+	var wg sync.WaitGroup
+	for i, rec := range recs {
+		submission := testutil.CreatePythonHelloWorldSubmission()
+		submission.SubmissionID = int64(i + 1)
+		req := streamRequest(t, submission)
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			handler.ServeHTTP(rec, req)
+		}(rec)
+	}
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	judging := len(ran)
+	mu.Unlock()
+	close(release)
+	wg.Wait()
+
+	if judging != 1 {
+		t.Errorf("judged %d streamed submissions at once, want 1", judging)
+	}
+	for i, rec := range recs {
+		if events, _ := readEvents(rec); len(events) == 0 || events[len(events)-1] != "result" {
+			t.Errorf("stream %d events = %v, want a result once a slot was free", i+1, events)
+		}
+	}
+}
+
+// streamRequest is a request to stream the judging of submission.
+func streamRequest(t *testing.T, submission types.SubmissionMessage) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(submission)
+	if err != nil {
+		t.Fatalf("failed to marshal submission: %v", err)
+	}
+	return httptest.NewRequest("GET", "/run/stream?submission="+url.QueryEscape(string(body)), nil)
+}
+
+// readEvents returns the names and data of the server-sent events in rec.
+func readEvents(rec *httptest.ResponseRecorder) (events, data []string) {
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		} else if strings.HasPrefix(line, "data: ") {
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return events, data
+}
+
+func TestRunStreamHandlerRejectsInvalidSubmission(t *testing.T) {
+	for _, target := range []string{"/run/stream", "/run/stream?submission=%7Bnot+json", "/run/stream?submission=%7B%7D"} {
+		rec := httptest.NewRecorder()
+		runStreamHandler(worker.DefaultConfig(), 1).ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != 400 {
+			t.Errorf("GET %s status = %d, want 400", target, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	runStreamHandler(worker.DefaultConfig(), 1).ServeHTTP(rec, httptest.NewRequest("POST", "/run/stream", nil))
+	if rec.Code != 405 {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package testutil
+
+import (
+	"sync"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Settlement records how a delivery was settled with the broker.
+type Settlement struct {
+	Acked    bool
+	Nacked   bool
+	Requeued bool
+}
+
+// RecordingAcknowledger is an amqp091.Acknowledger that records settlements by delivery tag.
+type RecordingAcknowledger struct {
+	mu          sync.Mutex
+	settlements map[uint64]Settlement
+}
+
+func NewRecordingAcknowledger() *RecordingAcknowledger {
+	return &RecordingAcknowledger{settlements: make(map[uint64]Settlement)}
+}
+
+func (a *RecordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.settlements[tag]
+	s.Acked = true
+	a.settlements[tag] = s
+	return nil
+}
+
+func (a *RecordingAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.settlements[tag]
+	s.Nacked = true
+	s.Requeued = requeue
+	a.settlements[tag] = s
+	return nil
+}
+
+func (a *RecordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// Settlement returns how the delivery with the given tag was settled, if at all.
+func (a *RecordingAcknowledger) Settlement(tag uint64) (Settlement, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.settlements[tag]
+	return s, ok
+}
+
+// PublishedMessage is a message captured by RecordingClient.
+type PublishedMessage struct {
+	Exchange   string
+	RoutingKey string
+	Body       interface{}
+	Priority   uint8
+}
+
+// RecordingClient is a RabbitMQ client that serves a fixed set of deliveries and records publishes.
+type RecordingClient struct {
+	Deliveries []amqp091.Delivery
+
+	mu        sync.Mutex
+	published []PublishedMessage
+}
+
+func (c *RecordingClient) ConsumeSubmissions(queueName string) (<-chan amqp091.Delivery, error) {
+	ch := make(chan amqp091.Delivery, len(c.Deliveries))
+	for _, d := range c.Deliveries {
+		ch <- d
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (c *RecordingClient) Publish(exchange, routingKey string, body interface{}) error {
+	return c.PublishWithPriority(exchange, routingKey, body, 0)
+}
+
+func (c *RecordingClient) PublishWithPriority(exchange, routingKey string, body interface{}, priority uint8) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, PublishedMessage{Exchange: exchange, RoutingKey: routingKey, Body: body, Priority: priority})
+	return nil
+}
+
+// Published returns a copy of the messages published so far.
+func (c *RecordingClient) Published() []PublishedMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]PublishedMessage(nil), c.published...)
+}
@@ -0,0 +1,50 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestRecordingAcknowledger(t *testing.T) {
+	acker := NewRecordingAcknowledger()
+	acked := amqp091.Delivery{Acknowledger: acker, DeliveryTag: 1}
+	requeued := amqp091.Delivery{Acknowledger: acker, DeliveryTag: 2}
+
+	acked.Ack(false)
+	requeued.Nack(false, true)
+
+	if s, ok := acker.Settlement(1); !ok || !s.Acked || s.Nacked {
+		t.Errorf("Settlement(1) = %+v, %v, want acked", s, ok)
+	}
+	if s, ok := acker.Settlement(2); !ok || !s.Nacked || !s.Requeued {
+		t.Errorf("Settlement(2) = %+v, %v, want nacked with requeue", s, ok)
+	}
+	if _, ok := acker.Settlement(3); ok {
+		t.Error("Settlement(3) should not exist")
+	}
+}
+
+func TestRecordingClient(t *testing.T) {
+	client := &RecordingClient{Deliveries: []amqp091.Delivery{{DeliveryTag: 1}, {DeliveryTag: 2}}}
+
+	msgs, err := client.ConsumeSubmissions("test.queue")
+	if err != nil {
+		t.Fatalf("ConsumeSubmissions failed: %v", err)
+	}
+	count := 0
+	for range msgs {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("consumed %d deliveries, want 2", count)
+	}
+
+	if err := client.Publish("ex", "key", "body"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	published := client.Published()
+	if len(published) != 1 || published[0].Exchange != "ex" || published[0].RoutingKey != "key" || published[0].Body != "body" {
+		t.Errorf("Published() = %+v, want one message to ex/key", published)
+	}
+}
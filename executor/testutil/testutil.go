@@ -9,7 +9,7 @@ import (
 )
 
 func CreateTestSubmission(submissionID int64, language, code string, timeLimit float64, memoryLimit int64, testCases []TestCase) types.SubmissionMessage {
-	var testCaseMessages []types.TestCaseMessage
+	testCaseMessages := []types.TestCaseMessage{}
 	for _, tc := range testCases {
 		testCaseMessages = append(testCaseMessages, types.TestCaseMessage{
 			TestCaseID:     tc.ID,
@@ -36,7 +36,8 @@ type TestCase struct {
 
 func CreateTestDelivery(submission types.SubmissionMessage) amqp091.Delivery {
 	data, _ := json.Marshal(submission)
-	return amqp091.Delivery{Body: data}
+	// The backend publishes the JSON as a string, which Spring AMQP tags text/plain
+	return amqp091.Delivery{ContentType: "text/plain", Body: data}
 }
 
 func CreateSimpleTestCase(id, input, expectedOutput string) TestCase {
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	// ResultSchemaVersionCompressed marks result messages whose per-test-case results
+	// are carried in CompressedResults instead of testCaseResults. Messages without a
+	// schema version use the original uncompressed layout.
+	ResultSchemaVersionCompressed = 2
+
+	// CompressionGzip is the only supported value of ResultNotificationMessage.Compression.
+	CompressionGzip = "gzip"
+)
+
+// CompressResults gzips the per-test-case results into CompressedResults when their JSON
+// encoding is at least minSize bytes. It reports whether the message was compressed.
+func (m *ResultNotificationMessage) CompressResults(minSize int) (bool, error) {
+	raw, err := json.Marshal(m.Results)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal results: %w", err)
+	}
+	if len(raw) < minSize {
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return false, fmt.Errorf("failed to compress results: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return false, fmt.Errorf("failed to finish compressing results: %w", err)
+	}
+
+	m.SchemaVersion = ResultSchemaVersionCompressed
+	m.Compression = CompressionGzip
+	m.CompressedResults = base64.StdEncoding.EncodeToString(buf.Bytes())
+	m.Results = nil
+	return true, nil
+}
+
+// DecompressResults restores Results from CompressedResults. Uncompressed messages are left untouched.
+func (m *ResultNotificationMessage) DecompressResults() error {
+	if m.Compression == "" {
+		return nil
+	}
+	if m.Compression != CompressionGzip {
+		return fmt.Errorf("unsupported result compression: %s", m.Compression)
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(m.CompressedResults)
+	if err != nil {
+		return fmt.Errorf("failed to decode compressed results: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return fmt.Errorf("failed to open compressed results: %w", err)
+	}
+	defer zr.Close()
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return fmt.Errorf("failed to decompress results: %w", err)
+	}
+
+	var results []TestCaseResultMessage
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return fmt.Errorf("failed to unmarshal decompressed results: %w", err)
+	}
+
+	m.Results = results
+	m.SchemaVersion = 0
+	m.Compression = ""
+	m.CompressedResults = ""
+	return nil
+}
@@ -0,0 +1,97 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func largeResultMessage() ResultNotificationMessage {
+	output := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1 2 3 4 5\n", 2000)))
+	var results []TestCaseResultMessage
+	for i := 0; i < 50; i++ {
+		results = append(results, TestCaseResultMessage{
+			TestCaseID: "tc" + string(rune('a'+i%26)),
+			Output:     output,
+			Status:     "PASSED",
+			TimeTaken:  0.25,
+			MemoryUsed: 2048,
+		})
+	}
+	return ResultNotificationMessage{
+		SubmissionID: 42,
+		Status:       "PASSED",
+		TimeTaken:    0.25,
+		MemoryUsed:   2048,
+		Results:      results,
+	}
+}
+
+func TestCompressResultsRoundTrip(t *testing.T) {
+	original := largeResultMessage()
+	msg := largeResultMessage()
+
+	compressed, err := msg.CompressResults(1024)
+	if err != nil {
+		t.Fatalf("CompressResults failed: %v", err)
+	}
+	if !compressed {
+		t.Fatal("expected large results to be compressed")
+	}
+	if msg.Results != nil {
+		t.Error("Results should be cleared after compression")
+	}
+	if msg.Compression != CompressionGzip || msg.SchemaVersion != ResultSchemaVersionCompressed {
+		t.Errorf("Compression = %q, SchemaVersion = %d, want %q and %d", msg.Compression, msg.SchemaVersion, CompressionGzip, ResultSchemaVersionCompressed)
+	}
+
+	compressedJSON, _ := json.Marshal(msg)
+	originalJSON, _ := json.Marshal(original)
+	if len(compressedJSON) >= len(originalJSON) {
+		t.Errorf("compressed payload = %d bytes, want less than %d", len(compressedJSON), len(originalJSON))
+	}
+
+	var received ResultNotificationMessage
+	if err := json.Unmarshal(compressedJSON, &received); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if err := received.DecompressResults(); err != nil {
+		t.Fatalf("DecompressResults failed: %v", err)
+	}
+	if !reflect.DeepEqual(received, original) {
+		t.Error("decompressed message does not match the original")
+	}
+}
+
+func TestCompressResultsBelowThreshold(t *testing.T) {
+	msg := ResultNotificationMessage{
+		SubmissionID: 1,
+		Status:       "PASSED",
+		Results:      []TestCaseResultMessage{{TestCaseID: "tc1", Status: "PASSED"}},
+	}
+
+	compressed, err := msg.CompressResults(1 << 20)
+	if err != nil {
+		t.Fatalf("CompressResults failed: %v", err)
+	}
+	if compressed {
+		t.Error("small results should not be compressed")
+	}
+	if len(msg.Results) != 1 || msg.Compression != "" || msg.SchemaVersion != 0 {
+		t.Error("message should be left untouched below the threshold")
+	}
+
+	data, _ := json.Marshal(msg)
+	if strings.Contains(string(data), "compress") || strings.Contains(string(data), "schemaVersion") {
+		t.Errorf("uncompressed message should keep the original wire format, got %s", data)
+	}
+}
+
+func TestDecompressResultsUnsupported(t *testing.T) {
+	msg := ResultNotificationMessage{Compression: "brotli", CompressedResults: "abc"}
+	if err := msg.DecompressResults(); err == nil {
+		t.Error("expected error for unsupported compression, got nil")
+	}
+}
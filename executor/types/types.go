@@ -1,5 +1,13 @@
 package types
 
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
 // SubmissionMessage corresponds to the message received from the submission queue.
 type SubmissionMessage struct {
 	SubmissionID int64             `json:"submissionId"`
@@ -8,6 +16,242 @@ type SubmissionMessage struct {
 	TimeLimit    float64           `json:"timeLimit"`
 	MemoryLimit  int64             `json:"memoryLimit"`
 	TestCases    []TestCaseMessage `json:"testCases"`
+	// MaxThreads limits how many threads the program may run at once (0 = unlimited).
+	MaxThreads int `json:"maxThreads,omitempty"`
+	// MaxOutputLines stops a program that prints more lines than this (0 = unlimited).
+	MaxOutputLines int `json:"maxOutputLines,omitempty"`
+	// CheckerConfig holds the problem's judging semantics; when absent, outputs are
+	// compared with the defaults described on CheckerConfig.
+	CheckerConfig CheckerConfig `json:"checkerConfig"`
+	// Deadline is an absolute cutoff (e.g. the end of a contest) after which results are
+	// worthless: test cases not started by then are skipped as DEADLINE_EXCEEDED.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Attempts counts how many times processing this submission has already failed with
+	// INTERNAL_ERROR. The executor increments it whenever it requeues the submission.
+	Attempts int `json:"attempts,omitempty"`
+	// Generator produces the input of test cases that carry a Seed, and Reference, if
+	// set, produces their expected output from that input.
+	Generator *ProgramMessage `json:"generator,omitempty"`
+	Reference *ProgramMessage `json:"reference,omitempty"`
+	// Checker, if set, judges the output of every test case that ran cleanly instead of
+	// CheckerConfig's comparison. It reads a JSON object with the test case's "input",
+	// "expectedOutput" and the program's "output" from stdin, and accepts the output by
+	// printing OK as its first line; any other output is WRONG_ANSWER.
+	Checker *ProgramMessage `json:"checker,omitempty"`
+	// Resources, if set, holds the problem's resource limits in one place. Its fields
+	// take precedence over MemoryLimit and MaxOutputLines; see ResourceProfile.
+	Resources *ResourceProfile `json:"resources,omitempty"`
+	// Rejudge marks a submission judged again in bulk, whose result nobody is waiting
+	// on. Its result may be published in a ResultBatchMessage together with others.
+	Rejudge bool `json:"rejudge,omitempty"`
+	// PreviousStatus is the verdict the submission had before this judging, typically
+	// for a rejudge. It is echoed in the result with whether the verdict changed.
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	// StopOn lists the test case verdicts that end judging early (e.g. RUNTIME_ERROR):
+	// once a test case gets one of them, the remaining test cases are neither run nor
+	// reported. Empty runs all test cases.
+	StopOn []string `json:"stopOn,omitempty"`
+	// DebugBuild compiles C and C++ with debug symbols and sanitizers, so that a
+	// RUNTIME_ERROR reports a short backtrace of the crash in its output. Runs are slower,
+	// and get three times the memory limit for the sanitizer.
+	DebugBuild bool `json:"debugBuild,omitempty"`
+	// Metadata is opaque context from the producer (user, problem or contest IDs, ...)
+	// that the executor never interprets and echoes back in the result.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Repetitions runs each test case this many times, up to MaxRepetitions, and
+	// reports a statistic of the times for steadier timing on performance-graded
+	// problems. The program is executed again in the container it first ran in, without
+	// compiling it again. Only the time changes: the verdict is that of the first run.
+	// 0 or 1 runs once.
+	Repetitions int `json:"repetitions,omitempty"`
+	// Timing is the statistic reported for repeated runs: TimingMin (the default, also
+	// used for unknown values) or TimingMedian.
+	Timing string `json:"timing,omitempty"`
+	// Function, if set, selects function mode: Code only defines a function of this
+	// name, and the executor's per-language harness calls it with each test case's
+	// input as the arguments and prints its return value to be judged.
+	Function string `json:"function,omitempty"`
+}
+
+// MaxRepetitions caps SubmissionMessage.Repetitions.
+const MaxRepetitions = 20
+
+// Statistics of repeated runs' times for SubmissionMessage.Timing.
+const (
+	TimingMin    = "MIN"
+	TimingMedian = "MEDIAN"
+)
+
+// ResourceProfile bundles the resource limits of a problem's runs. An omitted (zero)
+// field gets its default: the executor's run time limit, the submission's MemoryLimit
+// and MaxOutputLines, and the executor's configuration for the rest. The executor's
+// resource caps apply on top, whatever the profile asks for.
+type ResourceProfile struct {
+	// TimeLimit is the wall time limit of each run, in seconds.
+	TimeLimit float64 `json:"timeLimit,omitempty"`
+	// MemoryLimit is in MB, like SubmissionMessage.MemoryLimit.
+	MemoryLimit int64 `json:"memoryLimit,omitempty"`
+	// CPUs is how many cores a run may use.
+	CPUs float64 `json:"cpus,omitempty"`
+	// MaxProcesses caps the processes and threads alive at once.
+	MaxProcesses int64 `json:"maxProcesses,omitempty"`
+	// StackLimit is the stack size limit, in MB.
+	StackLimit int64 `json:"stackLimit,omitempty"`
+	// MaxOutputLines stops a program that prints more lines than this.
+	MaxOutputLines int `json:"maxOutputLines,omitempty"`
+	// MaxFileSize is the largest file a run may write, its output included, in MB.
+	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+}
+
+// Validate rejects negative limits.
+func (p ResourceProfile) Validate() error {
+	if p.TimeLimit < 0 || p.MemoryLimit < 0 || p.CPUs < 0 || p.MaxProcesses < 0 ||
+		p.StackLimit < 0 || p.MaxOutputLines < 0 || p.MaxFileSize < 0 {
+		return fmt.Errorf("resource limits must not be negative, got %+v", p)
+	}
+	return nil
+}
+
+// ProgramMessage is a judge-provided program, such as a test input generator.
+type ProgramMessage struct {
+	Language string `json:"language"`
+	Code     string `json:"code"` // base64-encoded
+}
+
+// CheckerConfig describes how a program's output is judged against the expected output.
+// Its zero value is the default: trimmed, case-sensitive comparison of raw bytes.
+type CheckerConfig struct {
+	// Mode selects the comparison; empty means the default trimmed comparison.
+	Mode string `json:"mode,omitempty"`
+	// IgnoreCase compares outputs case-insensitively, under any mode.
+	IgnoreCase bool `json:"ignoreCase,omitempty"`
+	// RequireUTF8 marks problems whose output must be valid UTF-8; otherwise output is compared as raw bytes.
+	RequireUTF8 bool `json:"requireUtf8,omitempty"`
+	// RuntimeErrorAsWrongAnswer judges a crash on a hidden test case as WRONG_ANSWER,
+	// without its error output, so that the verdict does not reveal which hidden input
+	// made the program crash. Sample test cases still report RUNTIME_ERROR.
+	RuntimeErrorAsWrongAnswer bool `json:"runtimeErrorAsWrongAnswer,omitempty"`
+	// Epsilon lets the NUMERIC_VALUE and TOKENS modes accept numbers within this
+	// absolute or relative error of the expected value (e.g. 1e-6). Zero requires
+	// exact values under NUMERIC_VALUE and means the default tolerance under TOKENS.
+	Epsilon float64 `json:"epsilon,omitempty"`
+	// Keywords are the answer words the KEYWORD_CASE mode matches in any case; when
+	// absent, the executor's default set (YES, NO, TRUE, FALSE, ...) is used.
+	Keywords []string `json:"keywords,omitempty"`
+	// IgnoreTrailingPattern is a regular expression for debug lines a program may leave
+	// at the end of its output (e.g. "^DEBUG"). Trailing output lines matching it are
+	// dropped before comparing, but never so many that the output gets fewer lines than
+	// the expected output. Empty, the default, ignores nothing.
+	IgnoreTrailingPattern string `json:"ignoreTrailingPattern,omitempty"`
+	// ExitCode is how a program's exit code affects its verdict: ExitCodeStrict (the
+	// default, also used for unknown values) or ExitCodeIgnore.
+	ExitCode string `json:"exitCode,omitempty"`
+}
+
+// Exit code policies for CheckerConfig.ExitCode.
+const (
+	// ExitCodeStrict fails a test case with RUNTIME_ERROR when the program exits
+	// non-zero, whatever it printed.
+	ExitCodeStrict = "STRICT"
+	// ExitCodeIgnore judges the output of a program that exits non-zero like that of
+	// one that exits cleanly.
+	ExitCodeIgnore = "IGNORE"
+)
+
+// identifier matches the function names allowed in function mode.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks that a deserialized submission carries everything needed to judge it.
+func (s SubmissionMessage) Validate() error {
+	if s.SubmissionID == 0 {
+		return errors.New("submission id is missing")
+	}
+	if s.Language == "" {
+		return errors.New("language is missing")
+	}
+	if s.TestCases == nil {
+		return errors.New("test cases are missing")
+	}
+	if s.Code == "" {
+		return errors.New("code is empty")
+	}
+	seen := make(map[string]bool, len(s.TestCases))
+	for _, testCase := range s.TestCases {
+		if seen[testCase.TestCaseID] {
+			return fmt.Errorf("duplicate test case id %q", testCase.TestCaseID)
+		}
+		seen[testCase.TestCaseID] = true
+		if testCase.Weight < 0 {
+			return fmt.Errorf("test case %q has a negative weight %v", testCase.TestCaseID, testCase.Weight)
+		}
+		if testCase.ExitCodeOnly && testCase.ExpectedExitCode == nil {
+			return fmt.Errorf("test case %q is graded on its exit code only but has no expected exit code", testCase.TestCaseID)
+		}
+		if testCase.Seed != nil && (s.Generator == nil || s.Generator.Language == "" || s.Generator.Code == "") {
+			return fmt.Errorf("test case %q has a seed but the submission has no generator", testCase.TestCaseID)
+		}
+	}
+	if s.Checker != nil && (s.Checker.Language == "" || s.Checker.Code == "") {
+		return errors.New("checker language or code is missing")
+	}
+	if s.Resources != nil {
+		if err := s.Resources.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.TimeLimit <= 0 {
+		return fmt.Errorf("time limit must be positive, got %v", s.TimeLimit)
+	}
+	if s.MemoryLimit <= 0 {
+		return fmt.Errorf("memory limit must be positive, got %d", s.MemoryLimit)
+	}
+	if s.MaxThreads < 0 {
+		return fmt.Errorf("max threads must not be negative, got %d", s.MaxThreads)
+	}
+	if s.MaxOutputLines < 0 {
+		return fmt.Errorf("max output lines must not be negative, got %d", s.MaxOutputLines)
+	}
+	if s.Repetitions < 0 || s.Repetitions > MaxRepetitions {
+		return fmt.Errorf("repetitions must be between 0 and %d, got %d", MaxRepetitions, s.Repetitions)
+	}
+	if s.Function != "" && !identifier.MatchString(s.Function) {
+		return fmt.Errorf("function %q is not a valid identifier", s.Function)
+	}
+	if epsilon := s.CheckerConfig.Epsilon; epsilon < 0 || epsilon >= 1 || math.IsNaN(epsilon) {
+		return fmt.Errorf("checker epsilon must be at least 0 and below 1, got %v", epsilon)
+	}
+	if pattern := s.CheckerConfig.IgnoreTrailingPattern; pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("checker ignore trailing pattern is invalid: %w", err)
+		}
+	}
+	return nil
+}
+
+// DisambiguateTestCaseIDs renames test cases whose ID repeats an earlier one by adding a
+// "#n" suffix (tc1, tc1#2, tc1#3), and reports whether any ID was changed.
+func (s *SubmissionMessage) DisambiguateTestCaseIDs() bool {
+	used := make(map[string]bool, len(s.TestCases))
+	for _, testCase := range s.TestCases {
+		used[testCase.TestCaseID] = true
+	}
+	seen := make(map[string]bool, len(s.TestCases))
+	changed := false
+	for i := range s.TestCases {
+		id := s.TestCases[i].TestCaseID
+		if seen[id] {
+			n := 2
+			for used[fmt.Sprintf("%s#%d", id, n)] {
+				n++
+			}
+			id = fmt.Sprintf("%s#%d", id, n)
+			s.TestCases[i].TestCaseID = id
+			used[id] = true
+			changed = true
+		}
+		seen[id] = true
+	}
+	return changed
 }
 
 // TestCaseMessage represents a single test case for a problem.
@@ -15,6 +259,24 @@ type TestCaseMessage struct {
 	TestCaseID     string `json:"testCaseId"`
 	Input          string `json:"input"`
 	ExpectedOutput string `json:"output"`
+	// IsSample marks a public sample test case, whose expected output may be shown to the user.
+	IsSample bool `json:"isSample,omitempty"`
+	// Seed makes this a generated test case: Input is ignored and the submission's
+	// generator is run with this seed to produce it at judge time instead.
+	Seed *int64 `json:"seed,omitempty"`
+	// Weight is the test case's share of the score; zero means a weight of 1.
+	Weight float64 `json:"weight,omitempty"`
+	// Subtask groups test cases that are scored together: a subtask earns the summed
+	// weight of its test cases only if all of them pass. Empty means no subtask.
+	Subtask string `json:"subtask,omitempty"`
+	// Mode, if set, replaces the submission's CheckerConfig.Mode for this test case,
+	// e.g. to check one test case's output against a pattern.
+	Mode string `json:"mode,omitempty"`
+	// ExpectedExitCode, if set, is the exit code the program must exit with to pass,
+	// on top of producing the expected output; a non-zero exit is then no runtime
+	// error. ExitCodeOnly grades on the exit code alone and ignores the output.
+	ExpectedExitCode *int `json:"expectedExitCode,omitempty"`
+	ExitCodeOnly     bool `json:"exitCodeOnly,omitempty"`
 }
 
 // StatusUpdateMessage is sent to the status queue.
@@ -30,8 +292,78 @@ type ResultNotificationMessage struct {
 	TimeTaken    float64                 `json:"timeTaken"`
 	MemoryUsed   int64                   `json:"memoryUsed"`
 	Results      []TestCaseResultMessage `json:"testCaseResults"`
+	// Score is the weighted share of the test cases passed, from 0 to 100 (see TestCaseMessage.Weight).
+	Score float64 `json:"score"`
+	// Subtasks breaks the score down by subtask, when the test cases have subtasks.
+	Subtasks []SubtaskResultMessage `json:"subtasks,omitempty"`
+	// SchemaVersion, Compression and CompressedResults are only set when the
+	// results were gzip-compressed (see CompressResults).
+	SchemaVersion     int    `json:"schemaVersion,omitempty"`
+	Compression       string `json:"compression,omitempty"`
+	CompressedResults string `json:"compressedResults,omitempty"`
+	// CompileOutput carries base64-encoded compiler diagnostics that did not fail the
+	// build; CompileOutputType labels them (CompileOutputWarning) so consumers can tell
+	// them apart from compilation errors, which are reported per test case.
+	CompileOutput     string `json:"compileOutput,omitempty"`
+	CompileOutputType string `json:"compileOutputType,omitempty"`
+	// CompileMillis is how long compiling the submission took, separate from the
+	// run times of the test cases. It is zero for interpreted languages.
+	CompileMillis int64 `json:"compileMillis,omitempty"`
+	// WorkerID, ExecutorHost and ExecutorVersion identify where and by which build the
+	// verdict was produced, for tracing host- or release-specific problems. They never
+	// affect judging.
+	WorkerID        int    `json:"workerId,omitempty"`
+	ExecutorHost    string `json:"executorHost,omitempty"`
+	ExecutorVersion string `json:"executorVersion,omitempty"`
+	// Attempts is how many times the submission was processed, when it took more than one.
+	Attempts int `json:"attempts,omitempty"`
+	// CompileCommand and ExecuteCommand are the exact command lines the submission
+	// was judged with. They are only reported when the executor runs in debug mode.
+	CompileCommand string `json:"compileCommand,omitempty"`
+	ExecuteCommand string `json:"executeCommand,omitempty"`
+	// Warnings are human-readable hints about the submission that did not affect the
+	// verdict, such as code that looks like another language than the one selected.
+	Warnings []string `json:"warnings,omitempty"`
+	// Message explains a verdict given without judging, such as INVALID.
+	Message string `json:"message,omitempty"`
+	// Metadata is the submission's Metadata, unchanged.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// PreviousStatus is the submission's PreviousStatus, and VerdictChanged reports
+	// whether Status differs from it. Both are unset when no previous verdict was given.
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	VerdictChanged bool   `json:"verdictChanged,omitempty"`
 }
 
+// ResultBatchMessage groups the result notifications of several rejudged submissions.
+// It is published with the result batch routing key instead of the result one.
+type ResultBatchMessage struct {
+	Results []ResultNotificationMessage `json:"results"`
+}
+
+// SubtaskResultMessage is the outcome of one subtask: the points it earned out of its
+// maximum (the summed weights of its test cases) and a representative verdict, PASSED
+// or that of its first failed test case.
+type SubtaskResultMessage struct {
+	Subtask   string  `json:"subtask"`
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"maxPoints"`
+	Status    string  `json:"status,omitempty"`
+}
+
+// HeartbeatMessage is published periodically by an executor so that a coordinator can
+// tell which executors are alive and how much capacity they have.
+type HeartbeatMessage struct {
+	ExecutorID string    `json:"executorId"`
+	Languages  []string  `json:"languages"`
+	Workers    int       `json:"workers"`
+	Busy       int       `json:"busy"`
+	Paused     bool      `json:"paused"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// CompileOutputWarning labels CompileOutput holding warnings of a successful compile.
+const CompileOutputWarning = "WARNING"
+
 // TestCaseResultMessage contains the outcome of a single test case execution.
 type TestCaseResultMessage struct {
 	TestCaseID string  `json:"testCaseId"`
@@ -39,4 +371,32 @@ type TestCaseResultMessage struct {
 	Status     string  `json:"status"`
 	TimeTaken  float64 `json:"timeTaken"`
 	MemoryUsed int64   `json:"memoryUsed"`
+	// Overran is set for runs that went past the time limit. Overrun is by how many
+	// seconds, and KilledAt is when the run was killed (unset if it exited by itself).
+	Overran  bool    `json:"overran,omitempty"`
+	Overrun  float64 `json:"overrun,omitempty"`
+	KilledAt float64 `json:"killedAt,omitempty"`
+	// DiskUsed is the size in KB of the files in the working directory after the run.
+	DiskUsed int64 `json:"diskUsed,omitempty"`
+	// Diff is the base64-encoded diff between the expected and actual output of a
+	// failed sample test case. It is never set for hidden test cases.
+	Diff string `json:"diff,omitempty"`
+	// Timeline is the base64-encoded, timestamped interleaving of the program's stdout
+	// and stderr. It is only reported when the executor runs in debug mode.
+	Timeline string `json:"timeline,omitempty"`
+	// ResourceUsage details what the run used, for analytics. Its wall time and peak
+	// memory are TimeTaken and MemoryUsed, which stay for existing consumers.
+	ResourceUsage *ResourceUsage `json:"resourceUsage,omitempty"`
+}
+
+// ResourceUsage is the resource usage of one run of a test case.
+type ResourceUsage struct {
+	// PeakMemoryKB is the peak resident memory of the program.
+	PeakMemoryKB int64 `json:"peakMemoryKb"`
+	// CPUTime and WallTime are in seconds; CPU time adds up all of the program's threads.
+	CPUTime  float64 `json:"cpuTime"`
+	WallTime float64 `json:"wallTime"`
+	// ExitCode is the program's exit code, and Signal the signal that ended it, if any.
+	ExitCode int `json:"exitCode"`
+	Signal   int `json:"signal,omitempty"`
 }
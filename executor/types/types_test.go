@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
 )
 
@@ -230,3 +231,112 @@ func TestEmptyTestCases(t *testing.T) {
 		t.Errorf("TestCases length = %d, want 0", len(unmarshaled.TestCases))
 	}
 }
+
+func TestSubmissionMessage_Validate(t *testing.T) {
+	valid := SubmissionMessage{
+		SubmissionID: 1,
+		Language:     "PYTHON",
+		Code:         "cHJpbnQoMSk=",
+		TimeLimit:    1.0,
+		MemoryLimit:  128,
+		TestCases:    []TestCaseMessage{{TestCaseID: "tc1"}},
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*SubmissionMessage)
+		wantErr bool
+	}{
+		{"valid", func(s *SubmissionMessage) {}, false},
+		{"missing submission id", func(s *SubmissionMessage) { s.SubmissionID = 0 }, true},
+		{"missing language", func(s *SubmissionMessage) { s.Language = "" }, true},
+		{"missing test cases", func(s *SubmissionMessage) { s.TestCases = nil }, true},
+		{"empty test cases", func(s *SubmissionMessage) { s.TestCases = []TestCaseMessage{} }, false},
+		{"seed without generator", func(s *SubmissionMessage) {
+			seed := int64(1)
+			s.TestCases = []TestCaseMessage{{TestCaseID: "gen", Seed: &seed}}
+		}, true},
+		{"seed with generator", func(s *SubmissionMessage) {
+			seed := int64(1)
+			s.TestCases = []TestCaseMessage{{TestCaseID: "gen", Seed: &seed}}
+			s.Generator = &ProgramMessage{Language: "PYTHON", Code: "cHJpbnQoMSk="}
+		}, false},
+		{"checker", func(s *SubmissionMessage) {
+			s.Checker = &ProgramMessage{Language: "PYTHON", Code: "cHJpbnQoJ09LJyk="}
+		}, false},
+		{"checker without code", func(s *SubmissionMessage) { s.Checker = &ProgramMessage{Language: "PYTHON"} }, true},
+		{"resource profile", func(s *SubmissionMessage) { s.Resources = &ResourceProfile{CPUs: 0.5, MaxProcesses: 8} }, false},
+		{"negative resource limit", func(s *SubmissionMessage) { s.Resources = &ResourceProfile{StackLimit: -1} }, true},
+		{"duplicate test case ids", func(s *SubmissionMessage) {
+			s.TestCases = []TestCaseMessage{{TestCaseID: "tc1"}, {TestCaseID: "tc2"}, {TestCaseID: "tc1"}}
+		}, true},
+		{"empty code", func(s *SubmissionMessage) { s.Code = "" }, true},
+		{"expected exit code only", func(s *SubmissionMessage) {
+			exitCode := 3
+			s.TestCases = []TestCaseMessage{{TestCaseID: "exit", ExpectedExitCode: &exitCode, ExitCodeOnly: true}}
+		}, false},
+		{"exit code only without an expected exit code", func(s *SubmissionMessage) {
+			s.TestCases = []TestCaseMessage{{TestCaseID: "exit", ExitCodeOnly: true}}
+		}, true},
+		{"empty expected output", func(s *SubmissionMessage) {
+			s.TestCases = []TestCaseMessage{{TestCaseID: "silent", Input: "", ExpectedOutput: ""}}
+		}, false},
+		{"zero time limit", func(s *SubmissionMessage) { s.TimeLimit = 0 }, true},
+		{"negative memory limit", func(s *SubmissionMessage) { s.MemoryLimit = -1 }, true},
+		{"negative max threads", func(s *SubmissionMessage) { s.MaxThreads = -1 }, true},
+		{"negative max output lines", func(s *SubmissionMessage) { s.MaxOutputLines = -1 }, true},
+		{"repetitions", func(s *SubmissionMessage) { s.Repetitions = MaxRepetitions }, false},
+		{"negative repetitions", func(s *SubmissionMessage) { s.Repetitions = -1 }, true},
+		{"too many repetitions", func(s *SubmissionMessage) { s.Repetitions = MaxRepetitions + 1 }, true},
+		{"function", func(s *SubmissionMessage) { s.Function = "solve_2" }, false},
+		{"function that is not an identifier", func(s *SubmissionMessage) { s.Function = "solve(); evil" }, true},
+		{"checker epsilon", func(s *SubmissionMessage) { s.CheckerConfig.Epsilon = 1e-6 }, false},
+		{"negative checker epsilon", func(s *SubmissionMessage) { s.CheckerConfig.Epsilon = -1e-6 }, true},
+		{"checker epsilon of one", func(s *SubmissionMessage) { s.CheckerConfig.Epsilon = 1 }, true},
+		{"NaN checker epsilon", func(s *SubmissionMessage) { s.CheckerConfig.Epsilon = math.NaN() }, true},
+		{"ignore trailing pattern", func(s *SubmissionMessage) { s.CheckerConfig.IgnoreTrailingPattern = "^DEBUG" }, false},
+		{"invalid ignore trailing pattern", func(s *SubmissionMessage) { s.CheckerConfig.IgnoreTrailingPattern = "(DEBUG" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := valid
+			tt.mutate(&msg)
+			err := msg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubmissionMessage_DisambiguateTestCaseIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		ids         []string
+		want        []string
+		wantChanged bool
+	}{
+		{"unique", []string{"a", "b"}, []string{"a", "b"}, false},
+		{"repeated", []string{"a", "a", "a"}, []string{"a", "a#2", "a#3"}, true},
+		{"suffix already taken", []string{"a", "a#2", "a"}, []string{"a", "a#2", "a#3"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SubmissionMessage{}
+			for _, id := range tt.ids {
+				s.TestCases = append(s.TestCases, TestCaseMessage{TestCaseID: id})
+			}
+			changed := s.DisambiguateTestCaseIDs()
+			if changed != tt.wantChanged {
+				t.Errorf("DisambiguateTestCaseIDs() = %v, want %v", changed, tt.wantChanged)
+			}
+			for i, testCase := range s.TestCases {
+				if testCase.TestCaseID != tt.want[i] {
+					t.Errorf("test case %d ID = %q, want %q", i, testCase.TestCaseID, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Package version reports which build of the executor is running. The build injects
+// the values with -ldflags, e.g.
+//
+//	go build -ldflags "-X online-judge/executor/version.Version=v1.4.0 -X online-judge/executor/version.Commit=$(git rev-parse HEAD)"
+package version
+
+import "runtime/debug"
+
+// DefaultVersion is the version of a build that did not inject one.
+const DefaultVersion = "dev"
+
+// Version and Commit are set at build time. Empty means not injected.
+var (
+	Version string
+	Commit  string
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion,omitempty"`
+}
+
+// BuildInfo returns the running build's version and commit. Without an injected
+// version it reports DefaultVersion, and without an injected commit the VCS revision
+// the Go toolchain recorded, if any.
+func BuildInfo() Info {
+	info := Info{Version: Version, Commit: Commit}
+	if info.Version == "" {
+		info.Version = DefaultVersion
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = build.GoVersion
+		if info.Commit == "" {
+			for _, setting := range build.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Commit = setting.Value
+				}
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,17 @@
+package version
+
+import "testing"
+
+func TestBuildInfo(t *testing.T) {
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+
+	Version, Commit = "", ""
+	if got := BuildInfo().Version; got != DefaultVersion {
+		t.Errorf("Version = %q without an injected version, want %q", got, DefaultVersion)
+	}
+
+	Version, Commit = "v1.4.0", "0123abc"
+	if got := BuildInfo(); got.Version != "v1.4.0" || got.Commit != "0123abc" {
+		t.Errorf("BuildInfo() = %+v, want the injected version and commit", got)
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"online-judge/executor/rabbitmq"
+	"online-judge/executor/types"
+	"sync"
+	"time"
+)
+
+// ResultBatcher groups the result notifications of rejudge submissions into
+// types.ResultBatchMessage messages, so that a large rejudge does not publish one small
+// message per submission. A batch is published once it holds size results or its
+// oldest result has waited delay, whichever comes first. It is shared by all workers.
+type ResultBatcher struct {
+	mqClient rabbitmq.ClientInterface
+	size     int
+	delay    time.Duration
+
+	mu      sync.Mutex
+	pending []batchedResult
+	timer   *time.Timer
+}
+
+type batchedResult struct {
+	result types.ResultNotificationMessage
+	// done is called with the outcome of publishing the batch holding result.
+	done func(error)
+}
+
+// NewResultBatcher returns a batcher publishing batches of up to size results, waiting
+// at most delay for a batch to fill.
+func NewResultBatcher(mqClient rabbitmq.ClientInterface, size int, delay time.Duration) *ResultBatcher {
+	return &ResultBatcher{mqClient: mqClient, size: size, delay: delay}
+}
+
+// Add queues a result for the next batch. done is called, from whichever goroutine
+// publishes the batch, once the batch has been published or has failed to.
+func (b *ResultBatcher) Add(result types.ResultNotificationMessage, done func(error)) {
+	b.mu.Lock()
+	b.pending = append(b.pending, batchedResult{result: result, done: done})
+	if len(b.pending) < b.size {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.delay, b.Flush)
+		}
+		b.mu.Unlock()
+		return
+	}
+	batch := b.takeLocked()
+	b.mu.Unlock()
+	b.publish(batch)
+}
+
+// Flush publishes the pending results right away, e.g. on shutdown.
+func (b *ResultBatcher) Flush() {
+	b.mu.Lock()
+	batch := b.takeLocked()
+	b.mu.Unlock()
+	b.publish(batch)
+}
+
+func (b *ResultBatcher) takeLocked() []batchedResult {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+func (b *ResultBatcher) publish(batch []batchedResult) {
+	if len(batch) == 0 {
+		return
+	}
+	message := types.ResultBatchMessage{Results: make([]types.ResultNotificationMessage, len(batch))}
+	for i, queued := range batch {
+		message.Results[i] = queued.result
+	}
+	err := b.mqClient.Publish(rabbitmq.ResultExchange, rabbitmq.ResultBatchRoutingKey, message)
+	for _, queued := range batch {
+		queued.done(err)
+	}
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/rabbitmq"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func batchTestDelivery(id int64, rejudge bool, acker amqp091.Acknowledger) amqp091.Delivery {
+	submission := testutil.CreateTestSubmission(id, "PYTHON", "print('hi')", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", "hi"),
+	})
+	submission.Rejudge = rejudge
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.DeliveryTag = uint64(id)
+	delivery.Acknowledger = acker
+	return delivery
+}
+
+func TestProcessBatchesRejudgeResults(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultBatchSize = 2
+	config.ResultBatchDelay = time.Hour
+	config.Batcher = NewResultBatcher(client, config.ResultBatchSize, config.ResultBatchDelay)
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "hi"}, nil
+	}
+
+	// An interactive submission is published on its own, right away.
+	w.handle(batchTestDelivery(1, false, acker))
+	published := client.Published()
+	if len(published) == 0 || published[len(published)-1].RoutingKey != rabbitmq.ResultRoutingKey {
+		t.Fatalf("published %+v, want the interactive result published immediately", published)
+	}
+	if s, ok := acker.Settlement(1); !ok || !s.Acked {
+		t.Errorf("interactive submission settlement = %+v, want acked", s)
+	}
+
+	// The first rejudge result waits for the batch to fill, unacknowledged.
+	w.handle(batchTestDelivery(2, true, acker))
+	if n := len(client.Published()); n != len(published)+1 {
+		t.Fatalf("published %d messages after a rejudge, want only its RUNNING status", n-len(published))
+	}
+	if _, ok := acker.Settlement(2); ok {
+		t.Error("rejudge submission settled before its batch was published")
+	}
+
+	w.handle(batchTestDelivery(3, true, acker))
+	last := client.Published()[len(client.Published())-1]
+	if last.Exchange != rabbitmq.ResultExchange || last.RoutingKey != rabbitmq.ResultBatchRoutingKey {
+		t.Fatalf("last published to %s/%s, want the result batch routing key", last.Exchange, last.RoutingKey)
+	}
+	batch, ok := last.Body.(types.ResultBatchMessage)
+	if !ok || len(batch.Results) != 2 {
+		t.Fatalf("published %+v, want a batch of 2 results", last.Body)
+	}
+	for i, result := range batch.Results {
+		if result.SubmissionID != int64(i+2) || result.Status != "PASSED" || result.WorkerID != 1 {
+			t.Errorf("batch result %d = %+v, want submission %d PASSED by worker 1", i, result, i+2)
+		}
+	}
+	for _, tag := range []uint64{2, 3} {
+		if s, ok := acker.Settlement(tag); !ok || !s.Acked {
+			t.Errorf("rejudge submission %d settlement = %+v, want acked after the batch", tag, s)
+		}
+	}
+}
+
+func TestResultBatcherFlushesAfterDelay(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	batcher := NewResultBatcher(client, 10, 20*time.Millisecond)
+	done := make(chan error, 1)
+
+	batcher.Add(types.ResultNotificationMessage{SubmissionID: 1}, func(err error) { done <- err })
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("batch publish failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a partial batch was not published after the delay")
+	}
+	published := client.Published()
+	if len(published) != 1 || len(published[0].Body.(types.ResultBatchMessage).Results) != 1 {
+		t.Errorf("published %+v, want one batch holding the result", published)
+	}
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"encoding/json"
+	"online-judge/executor/types"
+	"strings"
+)
+
+// checkerInput is what a submission's checker reads from stdin.
+type checkerInput struct {
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expectedOutput"`
+	Output         string `json:"output"`
+}
+
+// runChecker judges a test case's output with the submission's checker, which runs
+// in a container of its own under the checker limits of the worker's configuration.
+// It returns PASSED or WRONG_ANSWER, or an error when the checker itself failed.
+func (w *Worker) runChecker(submission types.SubmissionMessage, input, expectedOutput, output string) (string, error) {
+	stdin, err := json.Marshal(checkerInput{Input: input, ExpectedOutput: expectedOutput, Output: output})
+	if err != nil {
+		return "", err
+	}
+	memoryLimitBytes := w.config.CheckerMemoryLimitMB * 1024 * 1024
+	verdict, err := w.runProgram(submission.SubmissionID, "checker", *submission.Checker, string(stdin), w.config.CheckerTimeLimitSeconds, memoryLimitBytes)
+	if err != nil {
+		return "", err
+	}
+	if firstLine, _, _ := strings.Cut(verdict, "\n"); strings.TrimSpace(firstLine) == "OK" {
+		return "PASSED", nil
+	}
+	return "WRONG_ANSWER", nil
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"testing"
+)
+
+func TestProcessCustomChecker(t *testing.T) {
+	tests := []struct {
+		name       string
+		checker    *docker.ExecutionResult
+		wantStatus string
+	}{
+		{"accepts", &docker.ExecutionResult{Status: "ACCEPTED", Output: "OK\nclose enough"}, "PASSED"},
+		{"rejects", &docker.ExecutionResult{Status: "ACCEPTED", Output: "WRONG\nexpected 7"}, "WRONG_ANSWER"},
+		{"times out", &docker.ExecutionResult{Status: "TIME_LIMIT_EXCEEDED"}, "INTERNAL_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := testutil.CreateTestSubmission(1, "PYTHON", "submission", 1.0, 64, []testutil.TestCase{
+				testutil.CreateSimpleTestCase("tc1", "3 4", "7"),
+			})
+			submission.Checker = &types.ProgramMessage{Language: "PYTHON", Code: base64.StdEncoding.EncodeToString([]byte("checker"))}
+			delivery := testutil.CreateTestDelivery(submission)
+
+			config := DefaultConfig()
+			config.CheckerTimeLimitSeconds, config.CheckerMemoryLimitMB = 3, 32
+			config.MaxAttempts = 1 // A failing checker's INTERNAL_ERROR is final
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, config)
+			var checkerReq docker.RunRequest
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				if req.Code == "checker" {
+					checkerReq = req
+					return tt.checker, nil
+				}
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: "7.0000001"}, nil
+			}
+
+			w.handle(delivery)
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 || results[0].Results[0].Status != tt.wantStatus {
+				t.Fatalf("results = %+v, want a single %s", results, tt.wantStatus)
+			}
+			if checkerReq.TimeLimitSeconds != 3 || checkerReq.MemoryLimitBytes != 32*1024*1024 || !checkerReq.NoNetwork {
+				t.Errorf("checker ran with %vs, %d bytes, no network %v; want its own limits without a network",
+					checkerReq.TimeLimitSeconds, checkerReq.MemoryLimitBytes, checkerReq.NoNetwork)
+			}
+			var input checkerInput
+			if err := json.Unmarshal([]byte(checkerReq.Input), &input); err != nil {
+				t.Fatalf("checker input %q is not JSON: %v", checkerReq.Input, err)
+			}
+			if input != (checkerInput{Input: "3 4", ExpectedOutput: "7", Output: "7.0000001"}) {
+				t.Errorf("checker input = %+v, want the test case and the program's output", input)
+			}
+		})
+	}
+}
+
+func TestProcessCustomCheckerSkipsFailedRuns(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "submission", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", ""),
+	})
+	submission.Checker = &types.ProgramMessage{Language: "PYTHON", Code: base64.StdEncoding.EncodeToString([]byte("checker"))}
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		if req.Code == "checker" {
+			t.Error("checker ran for a program that crashed")
+		}
+		return &docker.ExecutionResult{Status: "RUNTIME_ERROR", Output: "Traceback"}, nil
+	}
+
+	w.handle(testutil.CreateTestDelivery(submission))
+
+	if results := resultsFor(client, 1); len(results) != 1 || results[0].Status != "RUNTIME_ERROR" {
+		t.Fatalf("results = %+v, want RUNTIME_ERROR", results)
+	}
+}
@@ -0,0 +1,338 @@
+package worker
+
+import (
+	"math/big"
+	"online-judge/executor/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Comparison modes selectable per submission through CheckerConfig.Mode.
+const (
+	// CompareTrimmed requires the outputs to match exactly after trimming leading
+	// and trailing whitespace. It is the default for an empty or unknown mode.
+	CompareTrimmed = "TRIMMED"
+	// CompareSortedTokens sorts the whitespace-separated tokens of each line before
+	// comparing, for answers that are a set of values printed in any order on a line.
+	// Line order and the number of lines still have to match.
+	CompareSortedTokens = "SORTED_TOKENS"
+	// CompareNumericValue compares numeric tokens by exact value regardless of how
+	// they are written (5, 5.0 and 5.00 are equal, 5.0001 is not); other tokens must
+	// match exactly. Lines and tokens are compared in order. With a CheckerConfig.Epsilon,
+	// numbers within that absolute or relative error of the expected value are equal.
+	CompareNumericValue = "NUMERIC_VALUE"
+	// CompareKeywordCase compares tokens exactly, except that a token whose expected
+	// value is an answer keyword (YES, NO, ...) matches it in any case. Lines and
+	// tokens are compared in order. CheckerConfig.Keywords replaces DefaultKeywords.
+	CompareKeywordCase = "KEYWORD_CASE"
+	// CompareTokens is the classic token checker. Both outputs are split into
+	// whitespace-separated tokens, ignoring line structure, and must have the same
+	// number of tokens. Tokens at the same position are equal when they are the same
+	// string, or when both are decimal numbers within CheckerConfig.Epsilon (default
+	// DefaultTokenEpsilon) of each other. A number never equals a word, so a numeric
+	// token opposite a non-numeric one is a mismatch.
+	CompareTokens = "TOKENS"
+	// CompareTrailingZeros compares tokens exactly after stripping the insignificant
+	// trailing zeros of decimals, and then a bare trailing decimal point, so that 1.50
+	// equals 1.5 and 2.0 equals 2. Unlike NUMERIC_VALUE it allows no other difference
+	// in notation (1.05 still differs from 1.5, and 1e2 from 100). Lines and tokens are
+	// compared in order.
+	CompareTrailingZeros = "TRAILING_ZEROS"
+	// CompareExact requires the actual output to be exactly the expected one, byte for
+	// byte, optionally followed by a single extra "\n". Nothing else is forgiven: not
+	// a second trailing newline, a trailing space, a "\r\n", or any internal difference.
+	CompareExact = "EXACT"
+	// CompareRegex treats the expected output as a regular expression (RE2 syntax) that
+	// the whole actual output must match, both trimmed of surrounding whitespace, for
+	// problems accepting any output of a given shape. IgnoreCase makes the match
+	// case-insensitive. A match taking longer than regexMatchTimeout is rejected.
+	CompareRegex = "REGEX"
+	// CompareNormalizedPaths compares like TRIMMED after normalizing the separators of
+	// path tokens, so that a\b\c.txt equals a/b/c.txt. A path token is any
+	// whitespace-separated token holding a "/" or "\\"; its backslashes become slashes.
+	// Nothing else about a path is normalized: case, "./" and "..", and repeated or
+	// trailing separators must still match.
+	CompareNormalizedPaths = "NORMALIZED_PATHS"
+	// CompareBlankLines ignores blank lines (empty or whitespace-only) at the start and
+	// end of the outputs, and a final newline, but requires everything in between to
+	// match exactly: interior blank lines, indentation and trailing spaces included.
+	CompareBlankLines = "BLANK_LINES"
+	// CompareCollapsedSpaces compares line by line after collapsing every run of spaces
+	// and tabs to a single space and trimming each line, so that differently aligned
+	// columns match. Unlike TOKENS it keeps the line structure: the outputs, trimmed
+	// like TRIMMED, must have the same lines, interior blank lines included.
+	CompareCollapsedSpaces = "COLLAPSED_SPACES"
+)
+
+// CompareModes lists the built-in comparison modes. RegisterCompareMode adds more.
+var CompareModes = []string{CompareTrimmed, CompareSortedTokens, CompareNumericValue, CompareKeywordCase, CompareTokens, CompareTrailingZeros, CompareExact, CompareRegex, CompareNormalizedPaths, CompareBlankLines, CompareCollapsedSpaces}
+
+// DefaultTokenEpsilon is the numeric tolerance of CompareTokens when the checker
+// configuration does not set an epsilon.
+const DefaultTokenEpsilon = 1e-6
+
+// DefaultKeywords are the answer words CompareKeywordCase matches case-insensitively
+// when the checker configuration does not list its own.
+var DefaultKeywords = []string{"YES", "NO", "TRUE", "FALSE", "POSSIBLE", "IMPOSSIBLE"}
+
+// compareOutputs reports whether the actual output is accepted for the expected one
+// under the checker configuration. An empty (or blank) expected output accepts only
+// an output that is blank too, except under CompareExact, which takes it literally.
+func compareOutputs(expected, actual string, checker types.CheckerConfig) bool {
+	if checker.IgnoreTrailingPattern != "" {
+		actual = dropTrailingLines(expected, actual, checker.IgnoreTrailingPattern)
+	}
+	if checker.IgnoreCase && checker.Mode != CompareRegex {
+		// Lower-casing a pattern would change its escapes (\D into \d), so REGEX
+		// matches case-insensitively instead
+		expected, actual = strings.ToLower(expected), strings.ToLower(actual)
+	}
+	if checker.Mode != CompareExact && strings.TrimSpace(expected) == "" {
+		// The program must print nothing. Every mode agrees on that, but spelling it
+		// out keeps a mode from reading an empty expected output as a wildcard.
+		return strings.TrimSpace(actual) == ""
+	}
+	return comparatorFor(checker.Mode)(expected, actual, checker)
+}
+
+// trailingPatterns caches the compiled CheckerConfig.IgnoreTrailingPattern regexps.
+var trailingPatterns = newPatternCache(maxCachedPatterns)
+
+// dropTrailingLines removes the lines at the end of actual that match pattern, while
+// actual has more lines than expected. An invalid pattern drops nothing.
+func dropTrailingLines(expected, actual, pattern string) string {
+	re, err := trailingPatterns.compile(pattern)
+	if err != nil {
+		return actual
+	}
+
+	want := 0 // An empty expected output has no lines, not one empty line
+	if trimmed := strings.TrimSpace(expected); trimmed != "" {
+		want = len(strings.Split(trimmed, "\n"))
+	}
+	lines := strings.Split(strings.TrimRight(actual, " \t\r\n"), "\n")
+	for len(lines) > want && re.MatchString(strings.TrimRight(lines[len(lines)-1], "\r")) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func compareSortedTokens(expected, actual string) bool {
+	expectedLines := strings.Split(strings.TrimSpace(expected), "\n")
+	actualLines := strings.Split(strings.TrimSpace(actual), "\n")
+	if len(expectedLines) != len(actualLines) {
+		return false
+	}
+	for i := range expectedLines {
+		expectedTokens := strings.Fields(expectedLines[i])
+		actualTokens := strings.Fields(actualLines[i])
+		if len(expectedTokens) != len(actualTokens) {
+			return false
+		}
+		sort.Strings(expectedTokens)
+		sort.Strings(actualTokens)
+		for j := range expectedTokens {
+			if expectedTokens[j] != actualTokens[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func compareNumericValue(expected, actual string, epsilon float64) bool {
+	expectedLines := strings.Split(strings.TrimSpace(expected), "\n")
+	actualLines := strings.Split(strings.TrimSpace(actual), "\n")
+	if len(expectedLines) != len(actualLines) {
+		return false
+	}
+	for i := range expectedLines {
+		expectedTokens := strings.Fields(expectedLines[i])
+		actualTokens := strings.Fields(actualLines[i])
+		if len(expectedTokens) != len(actualTokens) {
+			return false
+		}
+		for j := range expectedTokens {
+			if !sameNumericValue(expectedTokens[j], actualTokens[j], epsilon) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func compareTokens(expected, actual string, epsilon float64) bool {
+	expectedTokens := strings.Fields(expected)
+	actualTokens := strings.Fields(actual)
+	if len(expectedTokens) != len(actualTokens) {
+		return false
+	}
+	for i := range expectedTokens {
+		// Identical strings match; otherwise both must be numbers within epsilon
+		if !sameNumericValue(expectedTokens[i], actualTokens[i], epsilon) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareKeywordCase(expected, actual string, keywords []string) bool {
+	if keywords == nil {
+		keywords = DefaultKeywords
+	}
+	expectedLines := strings.Split(strings.TrimSpace(expected), "\n")
+	actualLines := strings.Split(strings.TrimSpace(actual), "\n")
+	if len(expectedLines) != len(actualLines) {
+		return false
+	}
+	for i := range expectedLines {
+		expectedTokens := strings.Fields(expectedLines[i])
+		actualTokens := strings.Fields(actualLines[i])
+		if len(expectedTokens) != len(actualTokens) {
+			return false
+		}
+		for j := range expectedTokens {
+			if expectedTokens[j] != actualTokens[j] &&
+				!(isKeyword(expectedTokens[j], keywords) && strings.EqualFold(expectedTokens[j], actualTokens[j])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func compareTrailingZeros(expected, actual string) bool {
+	expectedLines := strings.Split(strings.TrimSpace(expected), "\n")
+	actualLines := strings.Split(strings.TrimSpace(actual), "\n")
+	if len(expectedLines) != len(actualLines) {
+		return false
+	}
+	for i := range expectedLines {
+		expectedTokens := strings.Fields(expectedLines[i])
+		actualTokens := strings.Fields(actualLines[i])
+		if len(expectedTokens) != len(actualTokens) {
+			return false
+		}
+		for j := range expectedTokens {
+			if stripTrailingZeros(expectedTokens[j]) != stripTrailingZeros(actualTokens[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareExact reports whether actual is expected, possibly followed by one "\n".
+func compareExact(expected, actual string) bool {
+	return actual == expected || actual == expected+"\n"
+}
+
+// normalizePathSeparators turns the backslashes of every path token into slashes. A
+// backslash makes its token a path token, so every backslash in s is replaced.
+func normalizePathSeparators(s string) string {
+	return strings.ReplaceAll(s, "\\", "/")
+}
+
+// trimBlankLines removes the blank lines at the start and end of s, along with their
+// line breaks. A final line is blank when only whitespace follows the last newline.
+func trimBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	start, end := 0, len(lines)
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return strings.Join(lines[start:end], "\n")
+}
+
+// collapseSpaces collapses the runs of spaces and tabs within each line of s to a
+// single space, and trims each line and s as a whole.
+func collapseSpaces(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '\r'
+		}), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripTrailingZeros removes the zeros after the last significant fractional digit of
+// a plain decimal (digits, a point and digits, with an optional sign), then the point
+// if nothing follows it. Other tokens are returned unchanged.
+func stripTrailingZeros(token string) string {
+	integer, fraction, ok := strings.Cut(strings.TrimLeft(token, "+-"), ".")
+	if !ok || integer == "" && fraction == "" || strings.Trim(integer+fraction, "0123456789") != "" ||
+		len(token)-len(integer)-len(fraction) > 2 {
+		return token
+	}
+	return strings.TrimSuffix(strings.TrimRight(token, "0"), ".")
+}
+
+// isKeyword reports whether a token is one of the keywords, in any case.
+func isKeyword(token string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.EqualFold(token, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameNumericValue reports whether two tokens are equal, or are both decimal numbers
+// whose values differ by at most epsilon times the larger of 1 and the expected value's
+// magnitude, i.e. by an absolute error of epsilon for small values and a relative one
+// for large values. A zero epsilon requires the exact same value.
+func sameNumericValue(expected, actual string, epsilon float64) bool {
+	if expected == actual {
+		return true
+	}
+	expectedValue, ok := parseDecimal(expected)
+	if !ok {
+		return false
+	}
+	actualValue, ok := parseDecimal(actual)
+	if !ok {
+		return false
+	}
+	if epsilon <= 0 {
+		return expectedValue.Cmp(actualValue) == 0
+	}
+	one := big.NewRat(1, 1)
+	scale := new(big.Rat).Abs(expectedValue)
+	if scale.Cmp(one) < 0 {
+		scale = one
+	}
+	tolerance, _ := new(big.Rat).SetString(strconv.FormatFloat(epsilon, 'g', -1, 64))
+	tolerance.Mul(tolerance, scale)
+	difference := new(big.Rat).Sub(expectedValue, actualValue)
+	return difference.Abs(difference).Cmp(tolerance) <= 0
+}
+
+// Limits on the decimals parseDecimal parses exactly. big.Rat expands the exponent into
+// an integer with that many digits, so a token like 1e999999999 from a submission would
+// take minutes and gigabytes to parse.
+const (
+	maxDecimalLength   = 1000
+	maxDecimalExponent = 1000
+)
+
+// parseDecimal parses a decimal number (optionally with an exponent) exactly. The other
+// notations big.Rat accepts, such as fractions (1/2), hex (0x10) and digit separators
+// (1_000), are not numbers here, and neither are tokens longer than maxDecimalLength or
+// with an exponent beyond maxDecimalExponent; those only match themselves.
+func parseDecimal(token string) (*big.Rat, bool) {
+	if len(token) > maxDecimalLength || strings.Trim(token, "0123456789+-.eE") != "" {
+		return nil, false
+	}
+	if i := strings.IndexAny(token, "eE"); i >= 0 {
+		exponent, err := strconv.Atoi(token[i+1:])
+		if err != nil || exponent > maxDecimalExponent || exponent < -maxDecimalExponent {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(token)
+}
@@ -0,0 +1,444 @@
+package worker
+
+import (
+	"encoding/json"
+	"online-judge/executor/types"
+	"strings"
+	"testing"
+)
+
+func TestCompareOutputsTrimmed(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		mode     string
+		want     bool
+	}{
+		{"exact", "1 2 3", "1 2 3", CompareTrimmed, true},
+		{"surrounding whitespace", "1 2 3", "\n1 2 3  \n", CompareTrimmed, true},
+		{"token order matters", "1 2 3", "3 2 1", CompareTrimmed, false},
+		{"empty mode is trimmed", "1 2 3", "1 2 3\n", "", true},
+		{"unknown mode is trimmed", "1 2 3", "3 2 1", "NO_SUCH_MODE", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareOutputs(tt.expected, tt.actual, types.CheckerConfig{Mode: tt.mode}); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, %q) = %v, want %v", tt.expected, tt.actual, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsSortedTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"same order", "1 2 3", "1 2 3", true},
+		{"different order", "1 2 3", "3 1 2", true},
+		{"extra spacing", "1 2 3", "  3\t1   2 \n", true},
+		{"duplicates preserved", "1 1 2", "2 1 1", true},
+		{"different multiset", "1 1 2", "1 2 2", false},
+		{"missing token", "1 2 3", "1 2", false},
+		{"extra token", "1 2 3", "1 2 3 4", false},
+		{"per line sorting", "1 2\n3 4", "2 1\n4 3", true},
+		{"tokens do not move across lines", "1 2\n3 4", "1 3\n2 4", false},
+		{"line count differs", "1 2\n3 4", "1 2 3 4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareOutputs(tt.expected, tt.actual, types.CheckerConfig{Mode: CompareSortedTokens}); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, SORTED_TOKENS) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsNumericValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"identical", "5", "5", true},
+		{"integer as float", "5", "5.0", true},
+		{"extra trailing zeros", "5.0", "5.00", true},
+		{"leading zeros", "5", "005", true},
+		{"explicit plus sign", "5", "+5", true},
+		{"exponent notation", "1500", "1.5e3", true},
+		{"negative zero", "0", "-0.0", true},
+		{"several tokens and lines", "1 2.5\n3", "1.0 2.50\n3.000", true},
+		{"different value", "5", "5.0001", false},
+		{"no float tolerance", "0.3", "0.30000000000000004", false},
+		{"different sign", "5", "-5", false},
+		{"words must match exactly", "YES 5", "yes 5.0", false},
+		{"fractions are not numbers", "0.5", "1/2", false},
+		{"hex is not decimal", "16", "0x10", false},
+		{"digit separators are not decimal", "1000", "1_000", false},
+		{"missing token", "1 2", "1", false},
+		{"line count differs", "1\n2", "1 2", false},
+		{"huge exponents are not numbers", "1e999999999", "10e999999998", false},
+		{"huge exponents still match themselves", "1e999999999", "1e999999999", true},
+		{"huge negative exponents are not numbers", "0", "1e-999999999", false},
+		{"exponents within the limit", "1e1000", "10e999", true},
+		{"overlong numbers are not numbers", "1", "1." + strings.Repeat("0", maxDecimalLength), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareOutputs(tt.expected, tt.actual, types.CheckerConfig{Mode: CompareNumericValue}); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, NUMERIC_VALUE) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsNumericValueEpsilon(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		epsilon  float64
+		want     bool
+	}{
+		{"within a loose epsilon", "3.14159", "3.14", 1e-2, true},
+		{"outside a strict epsilon", "3.14159", "3.14", 1e-6, false},
+		{"within a strict epsilon", "3.1415926", "3.1415921", 1e-6, true},
+		{"float error within epsilon", "0.3", "0.30000000000000004", 1e-9, true},
+		{"exactly at the absolute bound", "0", "0.01", 1e-2, true},
+		{"just past the absolute bound", "0", "0.0101", 1e-2, false},
+		{"relative for large values", "1000000", "1000000.5", 1e-6, true},
+		{"relative bound still applies", "1000000", "1000002", 1e-6, false},
+		{"words still match exactly", "YES 1", "yes 1", 1e-2, false},
+		{"zero epsilon is exact", "0.3", "0.30000000000000004", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareNumericValue, Epsilon: tt.epsilon}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, epsilon %g) = %v, want %v", tt.expected, tt.actual, tt.epsilon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsKeywordCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		keywords []string
+		want     bool
+	}{
+		{"keyword in lower case", "YES", "yes", nil, true},
+		{"keyword in mixed case", "Impossible", "iMPOSSIBLE", nil, true},
+		{"keywords among other tokens", "YES 3\nNO", "yes 3\nno", nil, true},
+		{"identifier stays case-sensitive", "YES\nabc", "yes\nABC", nil, false},
+		{"variable name stays case-sensitive", "Alice", "alice", nil, false},
+		{"keyword must still be the right word", "YES", "no", nil, false},
+		{"only the expected token makes it a keyword", "yesterday", "YESTERDAY", nil, false},
+		{"custom keywords", "Draw", "DRAW", []string{"WIN", "DRAW"}, true},
+		{"custom keywords replace the defaults", "YES", "yes", []string{"WIN", "DRAW"}, false},
+		{"token count differs", "YES", "yes yes", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareKeywordCase, Keywords: tt.keywords}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, KEYWORD_CASE %v) = %v, want %v", tt.expected, tt.actual, tt.keywords, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		epsilon  float64
+		want     bool
+	}{
+		{"identical", "1 2 3", "1 2 3", 0, true},
+		{"line structure is ignored", "1 2\n3", "1\n2 3\n", 0, true},
+		{"extra whitespace", "a  b", "\ta b  ", 0, true},
+		{"float error within the default tolerance", "0.3", "0.30000000000000004", 0, true},
+		{"rounded within the default tolerance", "3.1415926", "3.141593", 0, true},
+		{"outside the default tolerance", "3.14159", "3.14", 0, false},
+		{"within a configured tolerance", "3.14159", "3.14", 1e-2, true},
+		{"integer written as float", "5", "5.000", 0, true},
+		{"words match exactly", "YES 5", "YES 5.0", 0, true},
+		{"words are case-sensitive", "YES", "yes", 0, false},
+		{"number opposite a word", "5", "five", 0, false},
+		{"word opposite a number", "none", "0", 1e-2, false},
+		{"special float words are not numbers", "1", "inf", 0, false},
+		{"too few tokens", "1 2 3", "1 2", 0, false},
+		{"too many tokens", "1 2", "1 2 3", 0, false},
+		{"both empty", "", "\n", 0, true},
+		{"empty against a token", "", "0", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareTokens, Epsilon: tt.epsilon}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, TOKENS epsilon %g) = %v, want %v", tt.expected, tt.actual, tt.epsilon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsTrailingZeros(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"trailing zero", "1.5", "1.50", true},
+		{"expected has the trailing zero", "1.50", "1.5", true},
+		{"bare decimal point", "2", "2.0", true},
+		{"point without digits", "2.", "2", true},
+		{"negative", "-3.250", "-3.25", true},
+		{"several tokens and lines", "1.5 2\n0.10", "1.50 2.000\n0.1", true},
+		{"inner zero is significant", "1.05", "1.5", false},
+		{"integer zeros are significant", "100", "1", false},
+		{"integer zeros stay without a point", "10", "1.0", false},
+		{"different values", "1.5", "1.6", false},
+		{"exponents are not rewritten", "100", "1e2", false},
+		{"words are compared exactly", "1.50a", "1.5a", false},
+		{"token order matters", "1.5 2", "2 1.5", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareTrailingZeros}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, TRAILING_ZEROS) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsExact(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"identical", "1 2\n3", "1 2\n3", true},
+		{"one trailing newline", "1 2\n3", "1 2\n3\n", true},
+		{"expected ends in a newline", "1 2\n3\n", "1 2\n3\n\n", true},
+		{"two trailing newlines", "1 2\n3", "1 2\n3\n\n", false},
+		{"missing trailing newline", "1 2\n3\n", "1 2\n3", false},
+		{"trailing space", "1 2\n3", "1 2\n3 ", false},
+		{"carriage return", "1 2\n3", "1 2\n3\r\n", false},
+		{"internal whitespace", "1 2\n3", "1  2\n3", false},
+		{"leading newline", "1 2\n3", "\n1 2\n3", false},
+		{"different values", "1 2\n3", "1 2\n4", false},
+		{"empty", "", "\n", true},
+		{"empty against a blank line", "", " \n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareExact}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, EXACT) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsNormalizedPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"backslashes", "src/main.go\nsrc/util/io.go", `src\main.go` + "\n" + `src\util\io.go`, true},
+		{"mixed separators", "a/b/c.txt", `a\b/c.txt`, true},
+		{"drive letter", `C:\Users\judge`, "C:/Users/judge", true},
+		{"UNC path", `\\server\share`, "//server/share", true},
+		{"surrounding whitespace", "a/b", `  a\b` + "\n", true},
+		{"different segment", "a/b/c.txt", `a\b\d.txt`, false},
+		{"repeated separator", "a/b", `a\\b`, false},
+		{"trailing separator", "a/b", `a\b\`, false},
+		{"case still matters", "a/B", `a\b`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareNormalizedPaths}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, NORMALIZED_PATHS) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+			if tt.want && tt.expected != tt.actual && compareOutputs(tt.expected, tt.actual, types.CheckerConfig{}) {
+				t.Errorf("compareOutputs(%q, %q) accepted differing separators by default", tt.expected, tt.actual)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsBlankLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"identical", "a\n\n  b", "a\n\n  b", true},
+		{"trailing newline", "a\nb", "a\nb\n", true},
+		{"leading blank lines", "a\nb", "\n\na\nb", true},
+		{"trailing blank lines", "a\nb", "a\nb\n\n\n", true},
+		{"whitespace-only edge lines", "a\nb", "  \n\t\na\nb\n \n", true},
+		{"carriage returns on edge lines", "a\nb", "\r\na\nb\n\r\n", true},
+		{"missing interior blank line", "a\n\nb", "a\nb", false},
+		{"extra interior blank line", "a\nb", "a\n\nb", false},
+		{"indentation", "a\n  b", "a\nb", false},
+		{"trailing space", "a\nb", "a\nb ", false},
+		{"leading space", "a\nb", " a\nb", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareBlankLines}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, BLANK_LINES) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsCollapsedSpaces(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"identical", "1 2\n3 4", "1 2\n3 4", true},
+		{"aligned columns", "1 10\n100 2", "  1   10\n100    2", true},
+		{"tabs", "a b\nc d", "a\tb\nc \t d", true},
+		{"trailing spaces and CRLF", "a b\nc", "a b  \r\nc\r\n", true},
+		{"surrounding blank lines", "a b", "\n\na  b\n\n", true},
+		{"line break instead of a space", "a b", "a\nb", false},
+		{"extra line", "a\nb", "a\nb\nc", false},
+		{"missing interior blank line", "a\n\nb", "a\nb", false},
+		{"spaces within a token", "ab", "a b", false},
+		{"different values", "1 2", "1  3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareCollapsedSpaces}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, COLLAPSED_SPACES) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsEmptyExpected(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"no output", "", "", true},
+		{"blank output", "", " \n\n", true},
+		{"blank expected output", "\n", "", true},
+		{"output", "", "0", false},
+		{"output after a blank line", "", "\n.", false},
+	}
+
+	for _, mode := range CompareModes {
+		if mode == CompareExact {
+			continue // Covered by TestCompareOutputsExact
+		}
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				checker := types.CheckerConfig{Mode: mode}
+				if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+					t.Errorf("compareOutputs(%q, %q, %s) = %v, want %v", tt.expected, tt.actual, mode, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCompareOutputsIgnoreTrailingPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		mode     string
+		pattern  string
+		want     bool
+	}{
+		{"trailing debug line", "42", "42\nDEBUG n=5", "", "^DEBUG", true},
+		{"several trailing debug lines", "1\n2", "1\n2\nDEBUG a\nDEBUG b\n", "", "^DEBUG", true},
+		{"trailing debug line with CRLF", "42", "42\r\nDEBUG\r\n", "", "^DEBUG$", true},
+		{"meaningful extra line", "42", "42\n43", "", "^DEBUG", false},
+		{"debug line before a meaningful one", "42", "42\nDEBUG\n43", "", "^DEBUG", false},
+		{"debug line in the middle", "1\n2", "1\nDEBUG\n2", "", "^DEBUG", false},
+		{"answer lines are never dropped", "DEBUG", "DEBUG", "", ".*", true},
+		{"a wrong answer stays wrong", "DEBUG", "DEBUG x", "", "^DEBUG", false},
+		{"no pattern keeps debug lines", "42", "42\nDEBUG", "", "", false},
+		{"invalid pattern keeps debug lines", "42", "42\nDEBUG", "", "(DEBUG", false},
+		{"under another mode", "1 2", "2 1\n# took 3ms", CompareSortedTokens, "^#", true},
+		{"only debug lines for an empty answer", "", "DEBUG a\nDEBUG b\n", "", "^DEBUG", true},
+		{"output besides debug lines for an empty answer", "", "0\nDEBUG a\n", "", "^DEBUG", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: tt.mode, IgnoreTrailingPattern: tt.pattern}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, pattern %q) = %v, want %v", tt.expected, tt.actual, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputsCheckerConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"absent config is trimmed", `{}`, "YES", "YES\n", true},
+		{"absent config is case-sensitive", `{}`, "YES", "yes", false},
+		{"ignore case", `{"checkerConfig":{"ignoreCase":true}}`, "YES", "yes", true},
+		{"sorted tokens", `{"checkerConfig":{"mode":"SORTED_TOKENS"}}`, "a b c", "c b a", true},
+		{"sorted tokens ignoring case", `{"checkerConfig":{"mode":"SORTED_TOKENS","ignoreCase":true}}`, "a B c", "C b A", true},
+		{"unknown mode is trimmed", `{"checkerConfig":{"mode":"NO_SUCH_MODE"}}`, "a b", "b a", false},
+		{"numeric epsilon", `{"checkerConfig":{"mode":"NUMERIC_VALUE","epsilon":1e-2}}`, "2.718", "2.72", true},
+		{"keyword case", `{"checkerConfig":{"mode":"KEYWORD_CASE","keywords":["ALICE"]}}`, "ALICE Bob", "alice Bob", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var submission types.SubmissionMessage
+			if err := json.Unmarshal([]byte(tt.config), &submission); err != nil {
+				t.Fatalf("Unmarshal(%s) failed: %v", tt.config, err)
+			}
+			if got := compareOutputs(tt.expected, tt.actual, submission.CheckerConfig); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, %+v) = %v, want %v", tt.expected, tt.actual, submission.CheckerConfig, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"online-judge/executor/types"
+	"sync"
+)
+
+// compareCache memoizes compareOutputs for recurring (expected, actual, checker)
+// triples, as in a rejudge where many submissions print the same output. Entries are
+// keyed by a SHA-256 of the inputs, so the outputs themselves are not retained, and
+// the least recently used entry is evicted once size entries are cached.
+// A nil *compareCache compares without caching.
+type compareCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of compareEntry, most recently used first
+	entries map[compareKey]*list.Element
+}
+
+type compareKey [sha256.Size]byte
+
+type compareEntry struct {
+	key    compareKey
+	result bool
+}
+
+func newCompareCache(size int) *compareCache {
+	if size <= 0 {
+		return nil
+	}
+	return &compareCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[compareKey]*list.Element, size),
+	}
+}
+
+// compare reports whether actual is accepted for expected under checker, like compareOutputs.
+func (c *compareCache) compare(expected, actual string, checker types.CheckerConfig) bool {
+	if c == nil {
+		return compareOutputs(expected, actual, checker)
+	}
+	key := newCompareKey(expected, actual, checker)
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(compareEntry).result
+	}
+	c.mu.Unlock()
+
+	result := compareOutputs(expected, actual, checker)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(compareEntry{key: key, result: result})
+		if c.order.Len() > c.size {
+			oldest := c.order.Remove(c.order.Back()).(compareEntry)
+			delete(c.entries, oldest.key)
+		}
+	}
+	return result
+}
+
+func newCompareKey(expected, actual string, checker types.CheckerConfig) compareKey {
+	h := sha256.New()
+	// Length-prefix every variable-length part so that different inputs cannot
+	// concatenate to the same bytes.
+	for _, part := range []string{checker.Mode, expected, actual, checker.IgnoreTrailingPattern} {
+		binary.Write(h, binary.BigEndian, uint64(len(part)))
+		h.Write([]byte(part))
+	}
+	binary.Write(h, binary.BigEndian, checker.IgnoreCase)
+	binary.Write(h, binary.BigEndian, checker.Epsilon)
+	// A nil keyword list (the defaults) differs from an empty one (no keywords)
+	binary.Write(h, binary.BigEndian, checker.Keywords == nil)
+	binary.Write(h, binary.BigEndian, uint64(len(checker.Keywords)))
+	for _, keyword := range checker.Keywords {
+		binary.Write(h, binary.BigEndian, uint64(len(keyword)))
+		h.Write([]byte(keyword))
+	}
+	var key compareKey
+	copy(key[:], h.Sum(nil))
+	return key
+}
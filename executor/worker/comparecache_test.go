@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"fmt"
+	"online-judge/executor/types"
+	"strings"
+	"testing"
+)
+
+func TestCompareCacheConsistent(t *testing.T) {
+	cache := newCompareCache(2)
+	tests := []struct {
+		expected string
+		actual   string
+		checker  types.CheckerConfig
+	}{
+		{"1 2 3", "3 2 1", types.CheckerConfig{}},
+		{"1 2 3", "3 2 1", types.CheckerConfig{Mode: CompareSortedTokens}},
+		{"YES", "yes", types.CheckerConfig{}},
+		{"YES", "yes", types.CheckerConfig{IgnoreCase: true}},
+		{"5", "5.0", types.CheckerConfig{Mode: CompareNumericValue}},
+		{"0.3", "0.31", types.CheckerConfig{Mode: CompareNumericValue}},
+		{"0.3", "0.31", types.CheckerConfig{Mode: CompareNumericValue, Epsilon: 1e-1}},
+		{"YES", "yes", types.CheckerConfig{Mode: CompareKeywordCase}},
+		{"YES", "yes", types.CheckerConfig{Mode: CompareKeywordCase, Keywords: []string{}}},
+		{"1", "1\nDEBUG", types.CheckerConfig{}},
+		{"1", "1\nDEBUG", types.CheckerConfig{IgnoreTrailingPattern: "^DEBUG"}},
+		{"ab", "c", types.CheckerConfig{}},
+		{"a", "bc", types.CheckerConfig{}},
+	}
+
+	// Twice over, so that later lookups hit and earlier entries get evicted.
+	for round := 0; round < 2; round++ {
+		for _, tt := range tests {
+			want := compareOutputs(tt.expected, tt.actual, tt.checker)
+			if got := cache.compare(tt.expected, tt.actual, tt.checker); got != want {
+				t.Errorf("round %d: cached compare(%q, %q, %+v) = %v, want %v", round, tt.expected, tt.actual, tt.checker, got, want)
+			}
+		}
+	}
+	if n := cache.order.Len(); n != 2 || len(cache.entries) != 2 {
+		t.Errorf("cache holds %d entries (%d indexed), want it bounded at 2", n, len(cache.entries))
+	}
+}
+
+func TestCompareCacheDisabled(t *testing.T) {
+	cache := newCompareCache(0)
+	if cache != nil {
+		t.Fatal("newCompareCache(0) should disable caching")
+	}
+	if !cache.compare("1", "1", types.CheckerConfig{}) {
+		t.Error("nil cache should still compare outputs")
+	}
+}
+
+func largeNumericOutput() string {
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, fmt.Sprintf("%d.000 %d.50 %d", i, i*3, i*7))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func BenchmarkCompareNumericValue(b *testing.B) {
+	output := largeNumericOutput()
+	checker := types.CheckerConfig{Mode: CompareNumericValue}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			compareOutputs(output, output+" ", checker)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		cache := newCompareCache(16)
+		for i := 0; i < b.N; i++ {
+			cache.compare(output, output+" ", checker)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/types"
+	"regexp"
+	"time"
+)
+
+// ResultRoute is the exchange and routing key a result notification is published to.
+type ResultRoute struct {
+	Exchange   string
+	RoutingKey string
+}
+
+// Policies for a submission with zero test cases, which leaves nothing to judge.
+const (
+	// ZeroTestCasesCompilationError fails it with COMPILATION_ERROR, as if its code did
+	// not compile. It is the default for an empty or unknown policy.
+	ZeroTestCasesCompilationError = "COMPILATION_ERROR"
+	// ZeroTestCasesInvalid rejects it with an INVALID verdict saying why.
+	ZeroTestCasesInvalid = "INVALID"
+	// ZeroTestCasesPassed accepts it as trivially PASSED.
+	ZeroTestCasesPassed = "PASSED"
+)
+
+// Config holds the judging and publishing settings shared by all workers.
+type Config struct {
+	// CompressResults enables gzip compression of per-test-case results in the
+	// published result message once they reach CompressionThreshold bytes.
+	CompressResults      bool
+	CompressionThreshold int
+
+	// ProcessTimeout is the hard deadline for processing one submission end to end.
+	// A worker stuck past it (e.g. on a hung Docker call) abandons the submission,
+	// publishes INTERNAL_ERROR and requeues it. Zero disables the watchdog.
+	ProcessTimeout time.Duration
+
+	// ResultRoutes overrides where results are published, keyed by overall verdict
+	// (e.g. INTERNAL_ERROR to an ops exchange). Verdicts without a route go to the
+	// default result exchange.
+	ResultRoutes map[string]ResultRoute
+
+	// MaxAttempts caps how many times a submission failing with INTERNAL_ERROR (a
+	// verdict, a watchdog timeout or a result that failed to publish) is processed.
+	// Retries are republished to SubmissionQueue with an incremented attempt counter;
+	// the last attempt publishes INTERNAL_ERROR and dead-letters the message. Zero or
+	// one makes the first failure final.
+	MaxAttempts int
+
+	// SubmissionQueue is the queue retries are republished to. The master sets it.
+	SubmissionQueue string
+
+	// RetryQueue, if set, is a separate lane retries are republished to instead of
+	// SubmissionQueue. The master dispatches from it ahead of new submissions, so a
+	// retried submission cannot be deferred indefinitely by a flood of new ones (or by
+	// higher-priority ones on a priority queue).
+	RetryQueue string
+
+	// CompareCacheSize is how many output comparisons each worker memoizes, which pays
+	// off in large rejudges where the same outputs recur. Zero disables the cache.
+	CompareCacheSize int
+
+	// LanguageCheck warns in the result when a submission's code obviously belongs to
+	// another language than the one selected (e.g. Python submitted as CPP). The
+	// warning is a hint for the contestant and never changes the verdict.
+	LanguageCheck bool
+
+	// ResultBatchSize groups the results of rejudge submissions into batch messages of
+	// up to this many results, waiting at most ResultBatchDelay for a batch to fill.
+	// Results of other submissions are always published right away. A submission is
+	// only acknowledged once its batch is published. Zero disables batching.
+	ResultBatchSize  int
+	ResultBatchDelay time.Duration
+
+	// Batcher is the batcher shared by all workers when batching is enabled. The master sets it.
+	Batcher *ResultBatcher
+
+	// QuarantineAfter dead-letters a submission with a final INTERNAL_ERROR once
+	// processing it crashed the worker this many times, instead of requeueing it again.
+	// Zero requeues a crashed submission forever.
+	QuarantineAfter int
+
+	// Crashes counts the crashes per submission across all workers. The master sets it.
+	Crashes *CrashTracker
+
+	// ResultDedupWindow skips publishing a result for a submission that already had
+	// one published within this window, e.g. after a redelivery. It is a safety net
+	// against double results, so it should be shorter than the time before a submission
+	// is deliberately judged again. Rejudges are always published. Zero disables it.
+	ResultDedupWindow time.Duration
+
+	// PublishedResults records the results published by all workers for
+	// ResultDedupWindow. The master sets it.
+	PublishedResults *PublishedResults
+
+	// JobDone is called whenever a worker is done with a job. The master sets it to
+	// track the jobs in flight.
+	JobDone func()
+
+	// ResultHook is called with every result after it was published. Nil does nothing.
+	ResultHook ResultHook
+
+	// Progress, if set, is called with each test case result as soon as the test case
+	// is judged, before the submission's final result, e.g. to stream live feedback.
+	Progress func(submissionID int64, result types.TestCaseResultMessage, judged, total int)
+
+	// ReportCompiling publishes a COMPILING status, instead of RUNNING, when judging of
+	// a compiled language's submission starts, and RUNNING once its first run compiled.
+	// The backend knows no COMPILING status, so only the run stream turns it on.
+	ReportCompiling bool
+
+	// Runner runs a test case; nil runs it with docker.Run.
+	Runner func(docker.RunRequest) (*docker.ExecutionResult, error)
+
+	// CheckerTimeLimitSeconds and CheckerMemoryLimitMB are the limits a submission's
+	// checker runs under, apart from the submission's own. A checker exceeding them
+	// fails the test case with INTERNAL_ERROR.
+	CheckerTimeLimitSeconds float64
+	CheckerMemoryLimitMB    int64
+
+	// ResourceCaps are the operator's limits on what submissions may ask for: a run
+	// never gets more than a non-zero cap, even when its profile leaves the limit
+	// unset. Zero fields cap nothing.
+	ResourceCaps types.ResourceProfile
+
+	// TestCaseParallelism runs up to this many test cases of a submission at once.
+	// It is lowered to the number of the submission's runs that fit in the executor's
+	// memory budget, so that parallel runs cannot take the host out of memory. Zero or
+	// one runs them one after another.
+	TestCaseParallelism int
+
+	// ZeroTestCases is the policy for submissions with zero test cases:
+	// ZeroTestCasesCompilationError, ZeroTestCasesInvalid or ZeroTestCasesPassed.
+	ZeroTestCases string
+
+	// OutputFilters drop the output lines matching any of a language's patterns before
+	// the output is compared, keyed by language. They remove noise the runtime prints
+	// on its own; DefaultOutputFilters covers the known noisy runtimes.
+	OutputFilters map[string][]*regexp.Regexp
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		CompressResults:      false,
+		CompressionThreshold: 64 * 1024,
+		ProcessTimeout:       15 * time.Minute,
+		MaxAttempts:          3,
+		CompareCacheSize:     0,
+		LanguageCheck:        false,
+		ReportCompiling:      false,
+		ResultBatchSize:      0,
+		ResultBatchDelay:     time.Second,
+		ResultHook:           NopResultHook{},
+		OutputFilters:        DefaultOutputFilters(),
+		ZeroTestCases:        ZeroTestCasesCompilationError,
+
+		CheckerTimeLimitSeconds: 10,
+		CheckerMemoryLimitMB:    256,
+	}
+}
@@ -0,0 +1,114 @@
+package worker
+
+import (
+	"online-judge/executor/types"
+	"sync"
+	"time"
+)
+
+// PublishedResults remembers which submissions had a result published within the
+// last window, so that a redelivered or retried submission is not answered twice. A
+// submission being judged is reserved, so a concurrent delivery of it is not judged.
+type PublishedResults struct {
+	mu        sync.Mutex
+	window    time.Duration
+	published map[int64]time.Time
+	now       func() time.Time
+}
+
+// NewPublishedResults returns a record remembering published results for window.
+func NewPublishedResults(window time.Duration) *PublishedResults {
+	return &PublishedResults{window: window, published: make(map[int64]time.Time), now: time.Now}
+}
+
+// recent reports whether a result of the submission was published within the window.
+func (p *PublishedResults) recent(submissionID int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	at, ok := p.published[submissionID]
+	return ok && p.now().Sub(at) < p.window
+}
+
+// record notes that a result of the submission was just published, and forgets the
+// submissions whose window has passed.
+func (p *PublishedResults) record(submissionID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordLocked(submissionID)
+}
+
+// reserve records the submission as if its result was just published, unless one was
+// published or reserved within the window, and reports whether it did. Checking and
+// recording under one lock keeps two deliveries of a submission from both judging it.
+// A reservation lapses with the window, so one that is never released does not block
+// the submission forever.
+func (p *PublishedResults) reserve(submissionID int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if at, ok := p.published[submissionID]; ok && p.now().Sub(at) < p.window {
+		return false
+	}
+	p.recordLocked(submissionID)
+	return true
+}
+
+// release forgets a reservation of the submission.
+func (p *PublishedResults) release(submissionID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.published, submissionID)
+}
+
+func (p *PublishedResults) recordLocked(submissionID int64) {
+	now := p.now()
+	for id, at := range p.published {
+		if now.Sub(at) >= p.window {
+			delete(p.published, id)
+		}
+	}
+	p.published[submissionID] = now
+}
+
+// publishedResults returns the record of published results shared by the workers, or
+// one of the worker's own when the master did not set one. Nil disables deduplication.
+func publishedResults(config Config) *PublishedResults {
+	if config.ResultDedupWindow <= 0 {
+		return nil
+	}
+	if config.PublishedResults != nil {
+		return config.PublishedResults
+	}
+	return NewPublishedResults(config.ResultDedupWindow)
+}
+
+// duplicateResult reports whether a result of the submission was already published
+// within the dedup window, in which case it must not be published again. A rejudge is
+// never a duplicate: it is judged again deliberately, e.g. after its test cases were
+// fixed, and its new verdict is due however recent the last one.
+func (w *Worker) duplicateResult(submission types.SubmissionMessage) bool {
+	return w.published != nil && !submission.Rejudge && w.published.recent(submission.SubmissionID)
+}
+
+// reserveResult reserves the result of a submission before it is judged. It reports
+// false when a result was already published within the dedup window, or another
+// delivery of the submission is being judged, in which case it must not be judged.
+// Rejudges are never reserved, as they are never duplicates.
+func (w *Worker) reserveResult(submission types.SubmissionMessage) bool {
+	return w.published == nil || submission.Rejudge || w.published.reserve(submission.SubmissionID)
+}
+
+// releaseResult drops the reservation of a submission that ends without a final
+// verdict, e.g. because it is retried, so that its next delivery is judged.
+func (w *Worker) releaseResult(submission types.SubmissionMessage) {
+	if w.published != nil && !submission.Rejudge {
+		w.published.release(submission.SubmissionID)
+	}
+}
+
+// resultSent records a published result for deduplication. INTERNAL_ERROR is not
+// recorded: unless it is final, the submission is retried and its verdict still due.
+func (w *Worker) resultSent(submissionID int64, status string) {
+	if w.published != nil && status != "INTERNAL_ERROR" {
+		w.published.record(submissionID)
+	}
+}
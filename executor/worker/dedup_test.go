@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"testing"
+	"time"
+)
+
+func TestProcessSkipsDuplicateResultWithinWindow(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultDedupWindow = time.Minute
+	w := NewWorker(1, nil, client, config)
+	now := time.Now()
+	w.published.now = func() time.Time { return now }
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	for tag := uint64(1); tag <= 2; tag++ {
+		delivery.Acknowledger, delivery.DeliveryTag = acker, tag
+		w.handle(delivery)
+		if s, _ := acker.Settlement(tag); !s.Acked {
+			t.Errorf("delivery %d settlement = %+v, want acked", tag, s)
+		}
+	}
+	if results := resultsFor(client, 1); len(results) != 1 {
+		t.Fatalf("published %d results within the window, want 1", len(results))
+	}
+
+	now = now.Add(time.Minute)
+	delivery.DeliveryTag = 3
+	w.handle(delivery)
+	if results := resultsFor(client, 1); len(results) != 2 {
+		t.Errorf("published %d results after the window, want 2", len(results))
+	}
+}
+
+func TestPublishedResultsIgnoresInternalErrors(t *testing.T) {
+	config := DefaultConfig()
+	config.ResultDedupWindow = time.Minute
+	w := NewWorker(1, nil, &testutil.RecordingClient{}, config)
+
+	submission := types.SubmissionMessage{SubmissionID: 1}
+	w.resultSent(1, "INTERNAL_ERROR")
+	if w.duplicateResult(submission) {
+		t.Error("an INTERNAL_ERROR result made the retried verdict a duplicate")
+	}
+	w.resultSent(1, "PASSED")
+	if !w.duplicateResult(submission) {
+		t.Error("a second result within the window is not a duplicate")
+	}
+}
+
+func TestProcessPublishesRejudgeWithinWindow(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultDedupWindow = time.Minute
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	submission := testutil.CreatePythonHelloWorldSubmission()
+	w.handle(testutil.CreateTestDelivery(submission))
+	submission.Rejudge = true
+	w.handle(testutil.CreateTestDelivery(submission))
+
+	if results := resultsFor(client, 1); len(results) != 2 {
+		t.Errorf("published %d results, want the rejudge's result too", len(results))
+	}
+}
+
+func TestProcessSkipsSubmissionBeingJudged(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultDedupWindow = time.Minute
+	config.PublishedResults = NewPublishedResults(config.ResultDedupWindow)
+	first, second := NewWorker(1, nil, client, config), NewWorker(2, nil, client, config)
+
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	delivery.Acknowledger = acker
+	runs := 0
+	first.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		runs++
+		// A redelivery reaches another worker while the first is still judging.
+		redelivery := delivery
+		redelivery.DeliveryTag = 2
+		second.handle(redelivery)
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+	second.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		t.Error("judged a submission another worker is judging")
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	first.handle(delivery)
+	if runs != 1 {
+		t.Errorf("first worker ran %d times, want 1", runs)
+	}
+	if results := resultsFor(client, 1); len(results) != 1 {
+		t.Errorf("published %d results, want 1", len(results))
+	}
+	if s, _ := acker.Settlement(2); !s.Acked {
+		t.Errorf("redelivery settlement = %+v, want acked", s)
+	}
+}
+
+func TestRetryReleasesReservation(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultDedupWindow = time.Minute
+	w := NewWorker(1, nil, client, config)
+	runs := 0
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		if req.Code == "checker" {
+			return &docker.ExecutionResult{Status: "TIME_LIMIT_EXCEEDED"}, nil // The checker fails
+		}
+		runs++
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	w.handle(testutil.CreateTestDelivery(checkedSubmission()))
+	judged := runs
+	w.handle(testutil.CreateTestDelivery(checkedSubmission()))
+	if runs == judged {
+		t.Error("the retried submission was not judged again after an INTERNAL_ERROR")
+	}
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxDiffLines is how many differing lines a sample diff shows at most.
+	maxDiffLines = 10
+	// maxDiffLineLength truncates each line shown in a sample diff, in bytes.
+	maxDiffLineLength = 200
+)
+
+// sampleDiff renders the first differing lines of the expected and actual outputs in
+// a unified-diff style, comparing line by line:
+//
+//	@@ line 3 @@
+//	-expected line
+//	+actual line
+//
+// It must only be used for sample test cases, whose expected output is public.
+func sampleDiff(expected, actual string) string {
+	expectedLines := strings.Split(strings.TrimSpace(expected), "\n")
+	actualLines := strings.Split(strings.TrimSpace(actual), "\n")
+	lineCount := len(expectedLines)
+	if len(actualLines) > lineCount {
+		lineCount = len(actualLines)
+	}
+
+	var diff strings.Builder
+	shown := 0
+	for i := 0; i < lineCount; i++ {
+		expectedLine, hasExpected := lineAt(expectedLines, i)
+		actualLine, hasActual := lineAt(actualLines, i)
+		if hasExpected && hasActual && expectedLine == actualLine {
+			continue
+		}
+		if shown == maxDiffLines {
+			fmt.Fprintf(&diff, "@@ more differences from line %d omitted @@\n", i+1)
+			break
+		}
+		shown++
+		fmt.Fprintf(&diff, "@@ line %d @@\n", i+1)
+		if hasExpected {
+			fmt.Fprintf(&diff, "-%s\n", truncateDiffLine(expectedLine))
+		}
+		if hasActual {
+			fmt.Fprintf(&diff, "+%s\n", truncateDiffLine(actualLine))
+		}
+	}
+	return diff.String()
+}
+
+func lineAt(lines []string, i int) (string, bool) {
+	if i >= len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[i], " \t\r"), true
+}
+
+func truncateDiffLine(line string) string {
+	if len(line) <= maxDiffLineLength {
+		return line
+	}
+	return line[:maxDiffLineLength] + "..."
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"strings"
+	"testing"
+)
+
+func TestSampleDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     string
+	}{
+		{"identical", "1\n2\n3", "1\n2\n3\n", ""},
+		{"changed line", "1\n2\n3", "1\n5\n3", "@@ line 2 @@\n-2\n+5\n"},
+		{"missing line", "1\n2\n3", "1\n2", "@@ line 3 @@\n-3\n"},
+		{"extra line", "1\n2", "1\n2\n3", "@@ line 3 @@\n+3\n"},
+		{"trailing spaces ignored", "1\n2", "1  \n2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampleDiff(tt.expected, tt.actual); got != tt.want {
+				t.Errorf("sampleDiff(%q, %q) = %q, want %q", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleDiffIsBounded(t *testing.T) {
+	var expected, actual []string
+	for i := 0; i < 50; i++ {
+		expected = append(expected, fmt.Sprint(i))
+		actual = append(actual, strings.Repeat("x", 1000))
+	}
+
+	diff := sampleDiff(strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	if n := strings.Count(diff, "@@ line "); n != maxDiffLines {
+		t.Errorf("diff shows %d differing lines, want %d", n, maxDiffLines)
+	}
+	if !strings.Contains(diff, "@@ more differences from line 11 omitted @@") {
+		t.Errorf("diff does not note omitted lines:\n%s", diff)
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		if len(line) > maxDiffLineLength+4 {
+			t.Errorf("diff line of %d bytes exceeds the limit", len(line))
+		}
+	}
+}
+
+func TestProcessDiffOnlyForSamples(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print('no')", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("sample", "", "yes"),
+		testutil.CreateSimpleTestCase("hidden", "", "yes"),
+	})
+	submission.TestCases[0].IsSample = true
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "no"}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || len(results[0].Results) != 2 {
+		t.Fatalf("published results = %+v, want one result with two test cases", results)
+	}
+	sample, hidden := results[0].Results[0], results[0].Results[1]
+	diff, _ := base64.StdEncoding.DecodeString(sample.Diff)
+	if string(diff) != "@@ line 1 @@\n-yes\n+no\n" {
+		t.Errorf("sample diff = %q, want the changed line", diff)
+	}
+	if hidden.Diff != "" {
+		t.Errorf("hidden test case diff = %q, want none", hidden.Diff)
+	}
+}
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"online-judge/executor/docker"
+	"online-judge/executor/types"
+	"strconv"
+	"strings"
+)
+
+// generateTestCase fills in the input of a generated test case, and its expected output
+// when the submission carries a reference solution; otherwise the test case's own
+// expected output is kept. The generator contract: the generator reads one line holding
+// the decimal seed from stdin and writes the test input to stdout, and must produce the
+// same input for the same seed. The reference solution is run like a submission on the
+// generated input.
+func (w *Worker) generateTestCase(submission types.SubmissionMessage, testCase *types.TestCaseMessage, memoryLimitBytes int64) error {
+	seed := strconv.FormatInt(*testCase.Seed, 10) + "\n"
+	input, err := w.runProgram(submission.SubmissionID, "generator", *submission.Generator, seed, RunTimeLimitSeconds, memoryLimitBytes)
+	if err != nil {
+		return err
+	}
+	testCase.Input = base64.StdEncoding.EncodeToString([]byte(input))
+
+	if submission.Reference != nil {
+		expected, err := w.runProgram(submission.SubmissionID, "reference solution", *submission.Reference, input, RunTimeLimitSeconds, memoryLimitBytes)
+		if err != nil {
+			return err
+		}
+		testCase.ExpectedOutput = base64.StdEncoding.EncodeToString([]byte(expected))
+	}
+	return nil
+}
+
+// runProgram runs a judge-provided program without a network and returns its output,
+// which it must produce by exiting normally within the given limits.
+func (w *Worker) runProgram(submissionID int64, name string, program types.ProgramMessage, input string, timeLimitSeconds float64, memoryLimitBytes int64) (string, error) {
+	code, err := base64.StdEncoding.DecodeString(program.Code)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 for %s code: %w", name, err)
+	}
+	result, err := w.runner(docker.RunRequest{
+		SubmissionID:     submissionID,
+		Language:         program.Language,
+		Code:             string(code),
+		Input:            input,
+		TimeLimitSeconds: timeLimitSeconds,
+		MemoryLimitBytes: memoryLimitBytes,
+		NoNetwork:        true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s failed to run: %w", name, err)
+	}
+	if result.Status != "ACCEPTED" {
+		return "", fmt.Errorf("%s failed with %s: %s", name, result.Status, strings.TrimSpace(result.Output))
+	}
+	return result.Output, nil
+}
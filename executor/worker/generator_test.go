@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"encoding/base64"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func generatedSubmission(seeds ...int64) types.SubmissionMessage {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "submission", 1.0, 64, nil)
+	for i := range seeds {
+		submission.TestCases = append(submission.TestCases, types.TestCaseMessage{TestCaseID: "gen", Seed: &seeds[i]})
+	}
+	submission.Generator = &types.ProgramMessage{Language: "PYTHON", Code: base64.StdEncoding.EncodeToString([]byte("generator"))}
+	submission.Reference = &types.ProgramMessage{Language: "PYTHON", Code: base64.StdEncoding.EncodeToString([]byte("reference"))}
+	return submission
+}
+
+func TestProcessGeneratedTestCases(t *testing.T) {
+	tests := []struct {
+		name       string
+		submission string // "echo" prints its input like the reference does, "wrong" does not
+		generator  string // "ok" prints 42 for any seed, "crash" fails
+		wantStatus string
+	}{
+		{"matches reference", "echo", "ok", "PASSED"},
+		{"differs from reference", "wrong", "ok", "WRONG_ANSWER"},
+		{"generator failure", "echo", "crash", "INTERNAL_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery := testutil.CreateTestDelivery(generatedSubmission(21))
+			delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+			var mu sync.Mutex
+			var inputs []string
+			client := &testutil.RecordingClient{}
+			config := DefaultConfig()
+			config.MaxAttempts = 1 // A failing generator's INTERNAL_ERROR is final
+			w := NewWorker(1, nil, client, config)
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				mu.Lock()
+				inputs = append(inputs, req.Code+":"+strings.TrimSpace(req.Input))
+				mu.Unlock()
+				switch {
+				case req.Code == "generator" && tt.generator == "crash":
+					return &docker.ExecutionResult{Status: "RUNTIME_ERROR", Output: "boom"}, nil
+				case req.Code == "generator":
+					return &docker.ExecutionResult{Status: "ACCEPTED", Output: "42"}, nil
+				case req.Code == "submission" && tt.submission == "wrong":
+					return &docker.ExecutionResult{Status: "ACCEPTED", Output: "0"}, nil
+				default: // the reference and a correct submission both echo the input
+					return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+				}
+			}
+
+			w.handle(delivery)
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 || results[0].Status != tt.wantStatus {
+				t.Fatalf("results = %+v, want a single %s", results, tt.wantStatus)
+			}
+			if inputs[0] != "generator:21" {
+				t.Errorf("first run = %q, want the generator fed the seed", inputs[0])
+			}
+			if tt.generator == "ok" {
+				want := "generator:21,reference:42,submission:42"
+				if got := strings.Join(inputs, ","); got != want {
+					t.Errorf("runs = %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
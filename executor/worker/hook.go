@@ -0,0 +1,26 @@
+package worker
+
+import "online-judge/executor/types"
+
+// ResultHook lets operators act on every final result the workers publish, e.g. to
+// record metrics in an external system or to validate results. It is called from the
+// worker's goroutine (or the result batcher's), so it should return quickly.
+type ResultHook interface {
+	// ResultPublished is called once with each result notification after it was
+	// published, with its per-test-case results uncompressed even when they were
+	// published compressed. Results that failed to publish are not passed to it.
+	ResultPublished(result types.ResultNotificationMessage)
+}
+
+// NopResultHook is a ResultHook that does nothing, the default.
+type NopResultHook struct{}
+
+// ResultPublished implements ResultHook.
+func (NopResultHook) ResultPublished(types.ResultNotificationMessage) {}
+
+// resultPublished passes a published result to the configured hook, if any.
+func (w *Worker) resultPublished(result types.ResultNotificationMessage) {
+	if w.config.ResultHook != nil {
+		w.config.ResultHook.ResultPublished(result)
+	}
+}
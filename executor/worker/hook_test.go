@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingHook is a ResultHook that records the results it is called with.
+type recordingHook struct {
+	mu      sync.Mutex
+	results []types.ResultNotificationMessage
+}
+
+func (h *recordingHook) ResultPublished(result types.ResultNotificationMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = append(h.results, result)
+}
+
+func (h *recordingHook) calls(submissionID int64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, result := range h.results {
+		if result.SubmissionID == submissionID {
+			n++
+		}
+	}
+	return n
+}
+
+func TestResultHookSeesEachResultOnce(t *testing.T) {
+	hook := &recordingHook{}
+	acker := testutil.NewRecordingAcknowledger()
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultHook = hook
+	config.ResultBatchSize = 2
+	config.Batcher = NewResultBatcher(client, config.ResultBatchSize, time.Hour)
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "hi"}, nil
+	}
+
+	w.handle(batchTestDelivery(1, false, acker))
+	w.handle(batchTestDelivery(2, true, acker))
+	if n := hook.calls(2); n != 0 {
+		t.Errorf("hook called %d times for a result still waiting in its batch, want 0", n)
+	}
+	w.handle(batchTestDelivery(3, true, acker))
+
+	for _, id := range []int64{1, 2, 3} {
+		if n := hook.calls(id); n != 1 {
+			t.Errorf("hook called %d times for submission %d, want once", n, id)
+		}
+	}
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.results) != 3 || hook.results[0].Status != "PASSED" || hook.results[0].WorkerID != 1 {
+		t.Errorf("hook results = %+v, want the 3 final results as published", hook.results)
+	}
+}
+
+func TestDefaultResultHookIsNop(t *testing.T) {
+	if _, ok := DefaultConfig().ResultHook.(NopResultHook); !ok {
+		t.Errorf("default ResultHook = %T, want NopResultHook", DefaultConfig().ResultHook)
+	}
+}
+
+func TestResultHookSeesUncompressedResults(t *testing.T) {
+	hook := &recordingHook{}
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ResultHook = hook
+	config.CompressResults = true
+	config.CompressionThreshold = 1
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	w.handle(testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission()))
+
+	published := resultsFor(client, 1)
+	if len(published) != 1 || published[0].CompressedResults == "" || published[0].Results != nil {
+		t.Fatalf("published %+v, want a single result with compressed results", published)
+	}
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.results) != 1 || len(hook.results[0].Results) != 1 || hook.results[0].CompressedResults != "" {
+		t.Errorf("hook results = %+v, want the result with its test case results uncompressed", hook.results)
+	}
+}
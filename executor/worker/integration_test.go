@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"encoding/base64"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// requireDocker skips integration tests in short mode or when no Docker daemon is reachable.
+func requireDocker(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping Docker integration test in short mode")
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Skipf("Docker client unavailable: %v", err)
+	}
+	defer cli.Close()
+	if _, err := cli.Ping(context.Background()); err != nil {
+		t.Skipf("Docker daemon unavailable: %v", err)
+	}
+}
+
+func TestIntegrationSeededGenerator(t *testing.T) {
+	requireDocker(t)
+
+	encode := func(code string) string { return base64.StdEncoding.EncodeToString([]byte(code)) }
+	// Prints n numbers from a seeded generator; the problem asks for their sum.
+	generator := "import random\nseed = int(input())\nrng = random.Random(seed)\nn = 5\nprint(n)\nprint(' '.join(str(rng.randint(1, 100)) for _ in range(n)))"
+	reference := "input()\nprint(sum(map(int, input().split())))"
+
+	seeds := []int64{1, 2, 1}
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "input()\nprint(sum(int(x) for x in input().split()))", 2.0, 64, nil)
+	for i := range seeds {
+		submission.TestCases = append(submission.TestCases, types.TestCaseMessage{TestCaseID: string(rune('a' + i)), Seed: &seeds[i]})
+	}
+	submission.Generator = &types.ProgramMessage{Language: "PYTHON", Code: encode(generator)}
+	submission.Reference = &types.ProgramMessage{Language: "PYTHON", Code: encode(reference)}
+
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+	client := &testutil.RecordingClient{}
+	NewWorker(1, nil, client, DefaultConfig()).handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "PASSED" {
+		t.Fatalf("results = %+v, want PASSED", results)
+	}
+	// The same seed generates the same test, so the submission prints the same answer.
+	if first, third := results[0].Results[0].Output, results[0].Results[2].Output; first != third {
+		t.Errorf("outputs for seed 1 differ: %q and %q", first, third)
+	}
+}
+
+func TestIntegrationLoopingCheckerIsKilled(t *testing.T) {
+	requireDocker(t)
+
+	encode := func(code string) string { return base64.StdEncoding.EncodeToString([]byte(code)) }
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 2.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "7", "7"),
+	})
+	submission.Checker = &types.ProgramMessage{Language: "PYTHON", Code: encode("while True:\n    pass")}
+
+	config := DefaultConfig()
+	config.CheckerTimeLimitSeconds = 1
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+	client := &testutil.RecordingClient{}
+	start := time.Now()
+	NewWorker(1, nil, client, config).handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "INTERNAL_ERROR" {
+		t.Fatalf("results = %+v, want INTERNAL_ERROR", results)
+	}
+	output, _ := base64.StdEncoding.DecodeString(results[0].Results[0].Output)
+	if !strings.Contains(string(output), "checker failed with TIME_LIMIT_EXCEEDED") {
+		t.Errorf("Output = %q, want the checker's time limit reported", output)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("judging took %v, want the checker stopped by its own time limit", elapsed)
+	}
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"fmt"
+	"online-judge/executor/docker"
+	"regexp"
+)
+
+// languageMarkers are constructs that are valid in one language and would be a
+// syntax error (or, for #include in Python, a most unlikely comment) in the others.
+var languageMarkers = map[string][]*regexp.Regexp{
+	"PYTHON": {
+		regexp.MustCompile(`(?m)^def \w+\(.*\)\s*:\s*$`),
+		regexp.MustCompile(`(?m)^print\(.*\)\s*$`),
+		regexp.MustCompile(`(?m)^if __name__ == ['"]__main__['"]\s*:`),
+		regexp.MustCompile(`(?m)^(import [\w.]+|from [\w.]+ import [\w*, ]+)\s*$`),
+	},
+	"CPP": {
+		regexp.MustCompile(`(?m)^\s*#include\s*[<"][\w./+-]+[>"]`),
+		regexp.MustCompile(`(?m)^\s*using namespace std\s*;`),
+	},
+	"JAVA": {
+		regexp.MustCompile(`public\s+static\s+void\s+main\s*\(\s*(final\s+)?String`),
+		regexp.MustCompile(`(?m)^import java\.[\w.*]+\s*;`),
+	},
+}
+
+// detectLanguage returns the one language whose markers appear in the code, or ""
+// when none or several do.
+func detectLanguage(code string) string {
+	detected := ""
+	for language, markers := range languageMarkers {
+		for _, marker := range markers {
+			if marker.MatchString(code) {
+				if detected != "" {
+					return ""
+				}
+				detected = language
+				break
+			}
+		}
+	}
+	return detected
+}
+
+// languageMismatchWarning returns a warning when the code is clearly written in a
+// different language than the one it was submitted as, and "" otherwise. It is a
+// hint for the contestant only and never affects the verdict.
+func languageMismatchWarning(language, code string) string {
+	submitted, ok := docker.ResolveLanguage(language)
+	if !ok {
+		return ""
+	}
+	detected := detectLanguage(code)
+	if detected == "" || detected == submitted || submitted == "C" && detected == "CPP" {
+		// C shares the #include marker with C++
+		return ""
+	}
+	return fmt.Sprintf("the code looks like %s but was submitted as %s", detected, submitted)
+}
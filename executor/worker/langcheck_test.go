@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"encoding/base64"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"testing"
+)
+
+func TestLanguageMismatchWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		code     string
+		want     string
+	}{
+		{"python as cpp", "CPP", "def solve(n):\n    return n * 2\n\nprint(solve(int(input())))\n",
+			"the code looks like PYTHON but was submitted as CPP"},
+		{"python script as cpp", "CPP", "import sys\nprint(sum(map(int, sys.stdin.read().split())))\n",
+			"the code looks like PYTHON but was submitted as CPP"},
+		{"cpp as python", "PYTHON", "#include <iostream>\nint main() { std::cout << 1; }\n",
+			"the code looks like CPP but was submitted as PYTHON"},
+		{"java as cpp via alias", "c++", "public class Main {\n    public static void main(String[] args) {}\n}\n",
+			"the code looks like JAVA but was submitted as CPP"},
+		{"cpp as java", "JAVA", "#include <bits/stdc++.h>\nusing namespace std;\nint main() {}\n",
+			"the code looks like CPP but was submitted as JAVA"},
+		{"cpp with a print function", "CPP", "#include <cstdio>\nvoid print(int x) { printf(\"%d\", x); }\nint main() { print(1); }\n", ""},
+		{"python mentioning include in a string", "PYTHON", "print('#include <iostream>')\n", ""},
+		{"java with a print helper", "JAVA", "import java.util.*;\npublic class Main {\n    public static void main(String[] args) {\n        print(1);\n    }\n    static void print(int x) { System.out.println(x); }\n}\n", ""},
+		{"c with an include", "C", "#include <stdio.h>\nint main() { printf(\"1\"); }\n", ""},
+		{"no markers", "CPP", "int main() { return 0; }\n", ""},
+		{"markers of several languages", "JAVA", "#include <cstdio>\ndef f():\n", ""},
+		{"unknown language", "COBOL", "print(1)\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := languageMismatchWarning(tt.language, tt.code); got != tt.want {
+				t.Errorf("languageMismatchWarning() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageMismatchWarningIgnoresValidPrograms(t *testing.T) {
+	submissions := []types.SubmissionMessage{
+		testutil.CreatePythonHelloWorldSubmission(),
+		testutil.CreateJavaHelloWorldSubmission(),
+		testutil.CreateCppHelloWorldSubmission(),
+		testutil.CreateAdditionSubmission(),
+		testutil.CreateInfiniteLoopSubmission(),
+		testutil.CreateRuntimeErrorSubmission(),
+		testutil.CreateWrongAnswerSubmission(),
+		testutil.CreateMultipleTestCasesSubmission(),
+		testutil.CreateFibonacciSubmission(),
+		testutil.CreateMixedResultsSubmission(),
+		testutil.CreateLargeInputSubmission(),
+	}
+	for _, submission := range submissions {
+		code, err := base64.StdEncoding.DecodeString(submission.Code)
+		if err != nil {
+			t.Fatalf("submission %d has invalid code: %v", submission.SubmissionID, err)
+		}
+		if warning := languageMismatchWarning(submission.Language, string(code)); warning != "" {
+			t.Errorf("submission %d (%s) warned %q, want no warning", submission.SubmissionID, submission.Language, warning)
+		}
+	}
+}
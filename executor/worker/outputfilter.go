@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"regexp"
+	"strings"
+)
+
+// DefaultOutputFilters drop the noise known runtimes print on their own, whatever the
+// program does: the JVM announcing the options it picked up from the environment or
+// warning about its own settings, and Python deprecation warnings.
+func DefaultOutputFilters() map[string][]*regexp.Regexp {
+	return map[string][]*regexp.Regexp{
+		"JAVA": {
+			regexp.MustCompile(`^Picked up (_JAVA_OPTIONS|JAVA_TOOL_OPTIONS|JDK_JAVA_OPTIONS): `),
+			regexp.MustCompile(`^OpenJDK 64-Bit Server VM warning: `),
+		},
+		"PYTHON": {
+			regexp.MustCompile(`^\S+:\d+: (Pending)?DeprecationWarning: `),
+		},
+	}
+}
+
+// outputFilters returns the filters of a submission's language, resolving aliases.
+func (w *Worker) outputFilters(language string) []*regexp.Regexp {
+	if resolved, ok := docker.ResolveLanguage(language); ok {
+		language = resolved
+	}
+	return w.config.OutputFilters[language]
+}
+
+// filterOutput drops the lines of output that match any of the filters. The lines
+// kept are unchanged, line breaks included.
+func filterOutput(output string, filters []*regexp.Regexp) string {
+	if len(filters) == 0 || output == "" {
+		return output
+	}
+	lines := strings.SplitAfter(output, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !matchesAny(strings.TrimRight(line, "\r\n"), filters) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+func matchesAny(line string, filters []*regexp.Regexp) bool {
+	for _, filter := range filters {
+		if filter.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
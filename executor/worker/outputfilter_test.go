@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"regexp"
+	"testing"
+)
+
+func TestFilterOutput(t *testing.T) {
+	filters := []*regexp.Regexp{regexp.MustCompile(`^NOISE`)}
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"no noise", "1\n2\n", "1\n2\n"},
+		{"leading noise", "NOISE a\n1\n", "1\n"},
+		{"noise between lines", "1\nNOISE\n2", "1\n2"},
+		{"noise with CRLF", "NOISE\r\n1\r\n", "1\r\n"},
+		{"last line without a newline", "1\nNOISE", "1\n"},
+		{"only noise", "NOISE\nNOISE\n", ""},
+		{"noise later in a line is kept", "1 NOISE\n", "1 NOISE\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterOutput(tt.output, filters); got != tt.want {
+				t.Errorf("filterOutput(%q) = %q, want %q", tt.output, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessFiltersJVMWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		config   func(*Config)
+		want     string
+	}{
+		{"default filters", "JAVA", func(*Config) {}, "PASSED"},
+		{"language alias", "java", func(*Config) {}, "PASSED"},
+		{"filters disabled", "JAVA", func(c *Config) { c.OutputFilters = nil }, "WRONG_ANSWER"},
+		{"another language", "CPP", func(*Config) {}, "WRONG_ANSWER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, tt.language, "class Main {}", 1.0, 256, []testutil.TestCase{
+				testutil.CreateSimpleTestCase("tc1", "", "42"),
+			}))
+			config := DefaultConfig()
+			tt.config(&config)
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, config)
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Picked up JAVA_TOOL_OPTIONS: -Xss64m\n42\n"}, nil
+			}
+
+			w.handle(delivery)
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 || results[0].Status != tt.want {
+				t.Fatalf("results = %+v, want %s", results, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"sync"
+)
+
+// pendingRun is a test case run started ahead of the judging loop.
+type pendingRun struct {
+	done   chan struct{}
+	result *docker.ExecutionResult
+	err    error
+	panic  interface{} // A crash of the run, raised again where its result is waited for
+}
+
+// runAhead starts the requests' runs in order, at most parallelism at a time, so that
+// the judging loop finds them finished or under way; nil requests are left to the
+// loop. Since runs start in order, waiting for one never waits on a later one. stop
+// keeps the runs not started yet from starting, once judging no longer needs them.
+func (w *Worker) runAhead(reqs []*docker.RunRequest, parallelism int) (runs []*pendingRun, stop func()) {
+	runs = make([]*pendingRun, len(reqs))
+	for i, req := range reqs {
+		if req != nil {
+			runs[i] = &pendingRun{done: make(chan struct{})}
+		}
+	}
+	stopped := make(chan struct{})
+	var once sync.Once
+	stop = func() { once.Do(func() { close(stopped) }) }
+
+	go func() {
+		running := make(chan struct{}, parallelism)
+		for i, req := range reqs {
+			if req == nil {
+				continue
+			}
+			select {
+			case running <- struct{}{}:
+			case <-stopped:
+				return
+			}
+			go func(run *pendingRun, req docker.RunRequest) {
+				defer func() { <-running }()
+				defer close(run.done)
+				defer func() { run.panic = recover() }()
+				run.result, run.err = w.runner(req)
+			}(runs[i], *req)
+		}
+	}()
+	return runs, stop
+}
+
+// run returns the result of the i-th test case's run, waiting for it when it was
+// started ahead, or running req now when it was not.
+func (w *Worker) run(runs []*pendingRun, i int, req docker.RunRequest) (*docker.ExecutionResult, error) {
+	if i < len(runs) && runs[i] != nil {
+		<-runs[i].done
+		if runs[i].panic != nil {
+			panic(runs[i].panic)
+		}
+		return runs[i].result, runs[i].err
+	}
+	return w.runner(req)
+}
+
+// testCaseParallelism returns how many test cases of a submission with the given
+// memory limit run at once: the configured parallelism, lowered to the number of
+// such runs that fit in the executor's memory budget.
+func testCaseParallelism(configured int, memoryLimitBytes int64) int {
+	if slots := docker.MemorySlots(memoryLimitBytes); slots > 0 && slots < configured {
+		return slots
+	}
+	return configured
+}
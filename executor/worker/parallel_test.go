@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"fmt"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessTestCaseParallelismFollowsMemoryBudget(t *testing.T) {
+	defer docker.Configure(docker.DefaultConfig())
+
+	tests := []struct {
+		name        string
+		budgetBytes int64
+		wantPeak    int
+	}{
+		{"unconstrained", 0, 4},
+		{"two runs fit", 1 << 30, 2},
+		{"one run fits", 768 << 20, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dockerConfig := docker.DefaultConfig()
+			dockerConfig.MemoryBudgetBytes = tt.budgetBytes
+			docker.Configure(dockerConfig)
+
+			var testCases []testutil.TestCase
+			for i := 0; i < 8; i++ {
+				value := fmt.Sprint(i)
+				testCases = append(testCases, testutil.CreateSimpleTestCase("tc"+value, value, value))
+			}
+			// 512MB a run, so a 1GB budget holds two at once
+			delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 512, testCases))
+
+			config := DefaultConfig()
+			config.TestCaseParallelism = 4
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, config)
+			var mu sync.Mutex
+			var running, peak int
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				mu.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+			}
+
+			w.handle(delivery)
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 || results[0].Status != "PASSED" || len(results[0].Results) != 8 {
+				t.Fatalf("results = %+v, want all 8 test cases PASSED", results)
+			}
+			for i, result := range results[0].Results {
+				if want := fmt.Sprint("tc", i); result.TestCaseID != want {
+					t.Errorf("result %d is for %s, want %s", i, result.TestCaseID, want)
+				}
+			}
+			if peak != tt.wantPeak {
+				t.Errorf("peak concurrent runs = %d, want %d", peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestProcessParallelCompilationErrorStopsRunningAhead(t *testing.T) {
+	var testCases []testutil.TestCase
+	for i := 0; i < 20; i++ {
+		testCases = append(testCases, testutil.CreateSimpleTestCase(fmt.Sprint("tc", i), "", ""))
+	}
+	delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "CPP", "int main() {", 1.0, 64, testCases))
+
+	config := DefaultConfig()
+	config.TestCaseParallelism = 2
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, config)
+	var mu sync.Mutex
+	calls := 0
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return &docker.ExecutionResult{Status: "COMPILATION_ERROR", Output: "expected '}'"}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "COMPILATION_ERROR" || len(results[0].Results) != 20 {
+		t.Fatalf("results = %+v, want 20 test cases with COMPILATION_ERROR", results)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls > 4 {
+		t.Errorf("ran %d test cases, want the runs ahead stopped after the compilation error", calls)
+	}
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"container/list"
+	"regexp"
+	"sync"
+)
+
+// maxCachedPatterns bounds how many compiled patterns a patternCache keeps. Patterns
+// come from problem data, so a long-running executor would otherwise keep every
+// pattern it ever saw.
+const maxCachedPatterns = 1000
+
+// patternCache memoizes compiled regexps by their source, evicting the least recently
+// used pattern once size patterns are cached. Invalid patterns are not cached.
+type patternCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of patternEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type patternEntry struct {
+	source string
+	re     *regexp.Regexp
+}
+
+func newPatternCache(size int) *patternCache {
+	return &patternCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// compile returns the compiled source, like regexp.Compile.
+func (c *patternCache) compile(source string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	if element, ok := c.entries[source]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(patternEntry).re, nil
+	}
+	c.mu.Unlock()
+
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[source]; !ok {
+		c.entries[source] = c.order.PushFront(patternEntry{source: source, re: re})
+		if c.order.Len() > c.size {
+			oldest := c.order.Remove(c.order.Back()).(patternEntry)
+			delete(c.entries, oldest.source)
+		}
+	}
+	return re, nil
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPatternCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newPatternCache(2)
+
+	first, err := cache.compile("a+")
+	if err != nil {
+		t.Fatalf("compile(a+) failed: %v", err)
+	}
+	if again, _ := cache.compile("a+"); again != first {
+		t.Error("compile(a+) compiled a cached pattern again")
+	}
+	cache.compile("b+")
+	cache.compile("a+") // b+ is now the least recently used
+	cache.compile("c+")
+
+	if _, ok := cache.entries["b+"]; ok {
+		t.Error("the least recently used pattern b+ was kept")
+	}
+	if again, _ := cache.compile("a+"); again != first {
+		t.Error("the recently used pattern a+ was evicted")
+	}
+	if len(cache.entries) != 2 || cache.order.Len() != 2 {
+		t.Errorf("cached %d patterns, want at most 2", len(cache.entries))
+	}
+}
+
+func TestPatternCacheBounded(t *testing.T) {
+	cache := newPatternCache(maxCachedPatterns)
+	for i := 0; i < 2*maxCachedPatterns; i++ {
+		cache.compile(fmt.Sprintf("x%d", i))
+	}
+	if len(cache.entries) != maxCachedPatterns {
+		t.Errorf("cached %d patterns, want %d", len(cache.entries), maxCachedPatterns)
+	}
+	if _, err := cache.compile("[a-"); err == nil {
+		t.Error("compile([a-) succeeded, want an error")
+	}
+	if _, ok := cache.entries["[a-"]; ok {
+		t.Error("an invalid pattern was cached")
+	}
+}
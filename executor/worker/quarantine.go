@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"online-judge/executor/types"
+	"runtime/debug"
+	"sync"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// maxTrackedCrashes bounds how many submissions a CrashTracker remembers; past it the
+// tracker starts over, so that crashes that never repeat cannot grow it forever.
+const maxTrackedCrashes = 10000
+
+// CrashTracker counts how often processing each submission crashed the worker, keyed
+// by submission ID. A crash requeues the message as it was, so unlike
+// SubmissionMessage.Attempts the count has to live with the executor.
+type CrashTracker struct {
+	mu      sync.Mutex
+	crashes map[int64]int
+}
+
+func NewCrashTracker() *CrashTracker {
+	return &CrashTracker{crashes: make(map[int64]int)}
+}
+
+// record counts a crash of the submission and returns its crashes so far.
+func (t *CrashTracker) record(submissionID int64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.crashes[submissionID]; !ok && len(t.crashes) >= maxTrackedCrashes {
+		t.crashes = make(map[int64]int)
+	}
+	t.crashes[submissionID]++
+	return t.crashes[submissionID]
+}
+
+// forget drops the crash count of a submission that is done with.
+func (t *CrashTracker) forget(submissionID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.crashes, submissionID)
+}
+
+// processRecovering processes a job, recovering the worker from a crash while doing
+// so. A crashed submission is requeued until it crashed QuarantineAfter times; then it
+// is quarantined: INTERNAL_ERROR is final and the message is dead-lettered, so that a
+// poison pill cannot keep taking down workers.
+func (w *Worker) processRecovering(job amqp091.Delivery, claim *jobClaim) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Worker %d] Recovered from a crash while processing a submission: %v\n%s", w.id, r, debug.Stack())
+			w.crashed(job, claim, fmt.Sprint(r))
+		}
+	}()
+	w.process(job, claim)
+}
+
+// crashed settles a job whose processing crashed, unless the watchdog already did.
+func (w *Worker) crashed(job amqp091.Delivery, claim *jobClaim, reason string) {
+	if !claim.claim() {
+		log.Printf("[Worker %d] The crashed submission was already abandoned by the watchdog.", w.id)
+		return
+	}
+	var submission types.SubmissionMessage
+	if err := json.Unmarshal(job.Body, &submission); err != nil {
+		log.Printf("[Worker %d] Crashed on an undecodable submission: %v. Rejecting message.", w.id, err)
+		job.Nack(false, false)
+		return
+	}
+	w.releaseResult(submission)
+	crashes := w.crashes.record(submission.SubmissionID)
+	if w.config.QuarantineAfter <= 0 || crashes < w.config.QuarantineAfter {
+		log.Printf("[Submission %d] [Worker %d] Processing crashed (%s), %d time(s) so far. Requeueing.", submission.SubmissionID, w.id, reason, crashes)
+		job.Nack(false, true)
+		return
+	}
+	log.Printf("[Submission %d] [Worker %d] Processing crashed %d times. Quarantining it in the DLQ.", submission.SubmissionID, w.id, crashes)
+	w.crashes.forget(submission.SubmissionID)
+	w.publishInternalError(submission, crashes)
+	job.Nack(false, false)
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"testing"
+)
+
+func TestProcessQuarantinesCrashingSubmission(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.QuarantineAfter = 3
+	config.Crashes = NewCrashTracker()
+	// Crashes on two workers count together
+	workers := []*Worker{NewWorker(1, nil, client, config), NewWorker(2, nil, client, config)}
+	for _, w := range workers {
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			panic("poison pill")
+		}
+	}
+
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	for attempt := 1; attempt <= config.QuarantineAfter; attempt++ {
+		delivery.Acknowledger, delivery.DeliveryTag = acker, uint64(attempt)
+		workers[attempt%2].handle(delivery)
+
+		s, _ := acker.Settlement(uint64(attempt))
+		if attempt < config.QuarantineAfter {
+			if !s.Nacked || !s.Requeued {
+				t.Fatalf("attempt %d settlement = %+v, want requeued", attempt, s)
+			}
+			if results := resultsFor(client, 1); len(results) != 0 {
+				t.Fatalf("attempt %d published %+v, want no result before quarantine", attempt, results)
+			}
+			continue
+		}
+		if !s.Nacked || s.Requeued {
+			t.Errorf("final attempt settlement = %+v, want nacked to the DLQ", s)
+		}
+	}
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "INTERNAL_ERROR" || results[0].Attempts != config.QuarantineAfter {
+		t.Errorf("results = %+v, want a single final INTERNAL_ERROR after %d crashes", results, config.QuarantineAfter)
+	}
+}
+
+func TestProcessRecoversFromCrashInParallelRun(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.TestCaseParallelism = 2
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		if req.Input == "2" {
+			panic("poison pill")
+		}
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+	}
+
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "1", "1"),
+		testutil.CreateSimpleTestCase("tc2", "2", "2"),
+		testutil.CreateSimpleTestCase("tc3", "3", "3"),
+	}))
+	delivery.Acknowledger, delivery.DeliveryTag = acker, 1
+	w.handle(delivery)
+
+	if s, _ := acker.Settlement(1); !s.Nacked || !s.Requeued {
+		t.Errorf("settlement = %+v, want requeued after the crash", s)
+	}
+}
+
+func TestCrashTracker(t *testing.T) {
+	tracker := NewCrashTracker()
+	if got := tracker.record(1); got != 1 {
+		t.Errorf("first crash = %d, want 1", got)
+	}
+	tracker.record(2)
+	if got := tracker.record(1); got != 2 {
+		t.Errorf("second crash = %d, want 2", got)
+	}
+	tracker.forget(1)
+	if got := tracker.record(1); got != 1 {
+		t.Errorf("crash after forget = %d, want 1", got)
+	}
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// regexMatchTimeout bounds how long CompareRegex spends matching one output. RE2 runs
+// in time linear in the output, so this only guards against huge outputs meeting
+// expensive patterns.
+var regexMatchTimeout = 2 * time.Second
+
+// expectedPatterns caches the compiled CompareRegex patterns, keyed by the pattern
+// source and whether it ignores case.
+var expectedPatterns = newPatternCache(maxCachedPatterns)
+
+// expectedPattern compiles an expected output into the pattern the whole actual output
+// must match under CompareRegex.
+func expectedPattern(expected string, ignoreCase bool) (*regexp.Regexp, error) {
+	source := "^(?:" + strings.TrimSpace(expected) + ")$"
+	if ignoreCase {
+		source = "(?i)" + source
+	}
+	re, err := expectedPatterns.compile(source)
+	if err != nil {
+		return nil, fmt.Errorf("expected output is not a valid regular expression: %w", err)
+	}
+	return re, nil
+}
+
+// compareRegex reports whether actual fully matches the pattern in expected. An
+// invalid pattern matches nothing; the worker reports it before comparing.
+func compareRegex(expected, actual string, ignoreCase bool) bool {
+	re, err := expectedPattern(expected, ignoreCase)
+	if err != nil {
+		return false
+	}
+	matched := make(chan bool, 1)
+	go func() {
+		matched <- re.MatchString(strings.TrimSpace(actual))
+	}()
+	timer := time.NewTimer(regexMatchTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-matched:
+		return ok
+	case <-timer.C:
+		log.Printf("Matching %d bytes of output against %q took over %v. Rejecting it.", len(actual), re, regexMatchTimeout)
+		return false
+	}
+}
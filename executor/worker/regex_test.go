@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"encoding/base64"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareOutputsRegex(t *testing.T) {
+	tests := []struct {
+		name       string
+		expected   string
+		actual     string
+		ignoreCase bool
+		want       bool
+	}{
+		{"timestamp", `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z` + "\n", "2026-10-18T09:30:00Z\n", false, true},
+		{"not a timestamp", `\d{4}-\d{2}-\d{2}`, "2026-10-1", false, false},
+		{"must match fully", `\d+`, "42 apples", false, false},
+		{"alternation is anchored as a whole", `yes|no`, "yes and no", false, false},
+		{"across lines", `(\d+\n)*done`, "1\n2\ndone", false, true},
+		{"case matters", `YES`, "yes", false, false},
+		{"ignoring case keeps escapes", `YES \D+`, "yes ABC", true, true},
+		{"ignoring case keeps negated classes", `YES \D+`, "yes 123", true, false},
+		{"invalid pattern matches nothing", `(unclosed`, "(unclosed", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := types.CheckerConfig{Mode: CompareRegex, IgnoreCase: tt.ignoreCase}
+			if got := compareOutputs(tt.expected, tt.actual, checker); got != tt.want {
+				t.Errorf("compareOutputs(%q, %q, REGEX) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectedPatternInvalid(t *testing.T) {
+	_, err := expectedPattern("[a-", false)
+	if err == nil || !strings.Contains(err.Error(), "not a valid regular expression") || !strings.Contains(err.Error(), "invalid character class range") {
+		t.Errorf("expectedPattern error = %v, want one naming the invalid expression", err)
+	}
+}
+
+func TestCompareRegexTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { regexMatchTimeout = timeout }(regexMatchTimeout)
+	regexMatchTimeout = time.Nanosecond
+
+	actual := strings.Repeat("ab", 1<<22)
+	if compareRegex(`(a|b|ab)*c?`, actual, false) {
+		t.Error("compareRegex accepted a match that ran past the timeout")
+	}
+}
+
+func TestProcessRegexTestCases(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "2026-10-18", `\d{4}-\d{2}-\d{2}`),
+		testutil.CreateSimpleTestCase("tc2", "18/10/2026", `\d{4}-\d{2}-\d{2}`),
+		testutil.CreateSimpleTestCase("tc3", "[a-", "[a-"),
+		testutil.CreateSimpleTestCase("tc4", "exact", "exact"),
+	})
+	for i := 0; i < 3; i++ {
+		submission.TestCases[i].Mode = CompareRegex
+	}
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.MaxAttempts = 1 // The invalid pattern's INTERNAL_ERROR is final
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || len(results[0].Results) != 4 {
+		t.Fatalf("published %+v, want one result with four test cases", results)
+	}
+	want := []string{"PASSED", "WRONG_ANSWER", "INTERNAL_ERROR", "PASSED"}
+	for i, result := range results[0].Results {
+		if result.Status != want[i] {
+			t.Errorf("test case %s = %s, want %s", result.TestCaseID, result.Status, want[i])
+		}
+	}
+	output, _ := base64.StdEncoding.DecodeString(results[0].Results[2].Output)
+	if !strings.Contains(string(output), "not a valid regular expression") {
+		t.Errorf("invalid pattern output = %q, want the regular expression error", output)
+	}
+}
+
+func TestExpectedPatternCacheBounded(t *testing.T) {
+	defer func(cache *patternCache) { expectedPatterns = cache }(expectedPatterns)
+	expectedPatterns = newPatternCache(2)
+
+	for _, expected := range []string{"a", "b", "c"} {
+		if _, err := expectedPattern(expected, false); err != nil {
+			t.Fatalf("expectedPattern(%q) failed: %v", expected, err)
+		}
+	}
+	if n := len(expectedPatterns.entries); n != 2 {
+		t.Errorf("cached %d expected patterns, want 2", n)
+	}
+}
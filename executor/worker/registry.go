@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"fmt"
+	"online-judge/executor/types"
+	"strings"
+	"sync"
+)
+
+// Comparator reports whether the actual output is accepted for the expected one. It
+// receives the outputs after the checker's IgnoreTrailingPattern and IgnoreCase have
+// been applied, along with the whole checker configuration for mode-specific settings.
+// Comparators are called concurrently by the workers and must be safe for that.
+type Comparator func(expected, actual string, checker types.CheckerConfig) bool
+
+// comparators maps every comparison mode to its comparator. customModes lists the
+// modes registered with RegisterCompareMode, in registration order.
+var (
+	comparatorsMu sync.RWMutex
+	comparators   = map[string]Comparator{
+		CompareTrimmed: compareTrimmed,
+		CompareSortedTokens: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareSortedTokens(expected, actual)
+		},
+		CompareNumericValue: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareNumericValue(expected, actual, checker.Epsilon)
+		},
+		CompareKeywordCase: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareKeywordCase(expected, actual, checker.Keywords)
+		},
+		CompareTokens: func(expected, actual string, checker types.CheckerConfig) bool {
+			epsilon := checker.Epsilon
+			if epsilon == 0 {
+				epsilon = DefaultTokenEpsilon
+			}
+			return compareTokens(expected, actual, epsilon)
+		},
+		CompareTrailingZeros: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareTrailingZeros(expected, actual)
+		},
+		CompareExact: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareExact(expected, actual)
+		},
+		CompareRegex: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareRegex(expected, actual, checker.IgnoreCase)
+		},
+		CompareBlankLines: func(expected, actual string, checker types.CheckerConfig) bool {
+			return trimBlankLines(actual) == trimBlankLines(expected)
+		},
+		CompareCollapsedSpaces: func(expected, actual string, checker types.CheckerConfig) bool {
+			return collapseSpaces(actual) == collapseSpaces(expected)
+		},
+		CompareNormalizedPaths: func(expected, actual string, checker types.CheckerConfig) bool {
+			return compareTrimmed(normalizePathSeparators(expected), normalizePathSeparators(actual), checker)
+		},
+	}
+	customModes []string
+)
+
+// RegisterCompareMode makes a comparison mode available to submissions under name,
+// e.g. a problem-specific checker provided by the operator. It must be called before
+// the workers start, and fails if the name is empty or already taken.
+func RegisterCompareMode(name string, comparator Comparator) error {
+	if name == "" || comparator == nil {
+		return fmt.Errorf("compare mode needs a name and a comparator")
+	}
+	comparatorsMu.Lock()
+	defer comparatorsMu.Unlock()
+	if _, ok := comparators[name]; ok {
+		return fmt.Errorf("compare mode %s is already registered", name)
+	}
+	comparators[name] = comparator
+	customModes = append(customModes, name)
+	return nil
+}
+
+// RegisteredCompareModes returns the built-in CompareModes followed by the modes added
+// with RegisterCompareMode.
+func RegisteredCompareModes() []string {
+	comparatorsMu.RLock()
+	defer comparatorsMu.RUnlock()
+	return append(append([]string(nil), CompareModes...), customModes...)
+}
+
+// comparatorFor returns the comparator of a mode, or the trimmed comparison for an
+// empty or unknown mode.
+func comparatorFor(mode string) Comparator {
+	comparatorsMu.RLock()
+	defer comparatorsMu.RUnlock()
+	if comparator, ok := comparators[mode]; ok {
+		return comparator
+	}
+	return compareTrimmed
+}
+
+func compareTrimmed(expected, actual string, checker types.CheckerConfig) bool {
+	return strings.TrimSpace(actual) == strings.TrimSpace(expected)
+}
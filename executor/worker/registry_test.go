@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// registerTestMode registers a compare mode for the duration of a test.
+func registerTestMode(t *testing.T, name string, comparator Comparator) {
+	t.Helper()
+	if err := RegisterCompareMode(name, comparator); err != nil {
+		t.Fatalf("RegisterCompareMode(%s) failed: %v", name, err)
+	}
+	t.Cleanup(func() {
+		comparatorsMu.Lock()
+		defer comparatorsMu.Unlock()
+		delete(comparators, name)
+		customModes = customModes[:len(customModes)-1]
+	})
+}
+
+func TestRegisterCompareMode(t *testing.T) {
+	// Accepts any permutation of the expected characters
+	registerTestMode(t, "ANAGRAM", func(expected, actual string, checker types.CheckerConfig) bool {
+		return sortedChars(strings.TrimSpace(expected)) == sortedChars(strings.TrimSpace(actual))
+	})
+
+	checker := types.CheckerConfig{Mode: "ANAGRAM"}
+	if !compareOutputs("listen", "silent\n", checker) {
+		t.Error("compareOutputs(listen, silent) = false under ANAGRAM, want true")
+	}
+	if compareOutputs("listen", "lister", checker) {
+		t.Error("compareOutputs(listen, lister) = true under ANAGRAM, want false")
+	}
+	if !compareOutputs("Listen", "SILENT", types.CheckerConfig{Mode: "ANAGRAM", IgnoreCase: true}) {
+		t.Error("IgnoreCase is not applied before a custom comparator")
+	}
+
+	modes := RegisteredCompareModes()
+	if modes[len(modes)-1] != "ANAGRAM" || len(modes) != len(CompareModes)+1 {
+		t.Errorf("RegisteredCompareModes() = %v, want the built-in modes and ANAGRAM", modes)
+	}
+	if err := RegisterCompareMode("ANAGRAM", checkerAlwaysAccepts); err == nil {
+		t.Error("registering ANAGRAM twice succeeded, want an error")
+	}
+	if err := RegisterCompareMode(CompareTokens, checkerAlwaysAccepts); err == nil {
+		t.Error("registering over a built-in mode succeeded, want an error")
+	}
+}
+
+func TestProcessUsesRegisteredCompareMode(t *testing.T) {
+	registerTestMode(t, "ALWAYS", checkerAlwaysAccepts)
+
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print('anything')", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", "42"),
+	})
+	submission.CheckerConfig.Mode = "ALWAYS"
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "anything"}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "PASSED" {
+		t.Fatalf("published %+v, want PASSED by the registered comparator", results)
+	}
+}
+
+func checkerAlwaysAccepts(expected, actual string, checker types.CheckerConfig) bool {
+	return true
+}
+
+func sortedChars(s string) string {
+	chars := strings.Split(s, "")
+	sort.Strings(chars)
+	return strings.Join(chars, "")
+}
@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"log"
+	"online-judge/executor/docker"
+	"online-judge/executor/types"
+	"sort"
+)
+
+// repeatedTime returns the timing statistic of an accepted run that the runner
+// repeated in its container (see docker.RunRequest.Repetitions): the run's own time and
+// those of the repetitions that exited cleanly. The others are left out of it, since
+// the first run already decided the verdict.
+func (w *Worker) repeatedTime(result *docker.ExecutionResult, repetitions int, timing string) int64 {
+	times := append([]int64{result.TimeMillis}, result.RepeatMillis...)
+	if len(times) < repetitions {
+		log.Printf("[Worker %d] Only %d of %d repetitions ran cleanly. Timing those.", w.id, len(times), repetitions)
+	}
+	return timingStatistic(times, timing)
+}
+
+// timingStatistic returns the minimum of times, or their median for TimingMedian (the
+// lower middle value of an even number of times, so that it is a measured time).
+func timingStatistic(times []int64, timing string) int64 {
+	sorted := append([]int64(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if timing == types.TimingMedian {
+		return sorted[(len(sorted)-1)/2]
+	}
+	return sorted[0]
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"testing"
+)
+
+func TestTimingStatistic(t *testing.T) {
+	tests := []struct {
+		times  []int64
+		timing string
+		want   int64
+	}{
+		{[]int64{120}, types.TimingMin, 120},
+		{[]int64{130, 90, 110}, types.TimingMin, 90},
+		{[]int64{130, 90, 110}, "", 90},
+		{[]int64{130, 90, 110}, types.TimingMedian, 110},
+		{[]int64{130, 90, 110, 100}, types.TimingMedian, 100},
+	}
+	for _, tt := range tests {
+		if got := timingStatistic(tt.times, tt.timing); got != tt.want {
+			t.Errorf("timingStatistic(%v, %q) = %d, want %d", tt.times, tt.timing, got, tt.want)
+		}
+	}
+}
+
+func TestProcessRepetitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		timing   string
+		wantTime float64
+	}{
+		{"minimum", "", 0.08},
+		{"median", types.TimingMedian, 0.09},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+				testutil.CreateSimpleTestCase("tc1", "1", "1"),
+				testutil.CreateSimpleTestCase("tc2", "2", "oops"),
+			})
+			submission.Repetitions = 5
+			submission.Timing = tt.timing
+			delivery := testutil.CreateTestDelivery(submission)
+			delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, DefaultConfig())
+			runs := map[string]int{}
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				runs[req.Input]++
+				if req.Repetitions != 5 {
+					t.Errorf("run asked for %d repetitions, want 5 in its container", req.Repetitions)
+				}
+				// The repetition of 5ms timed out, so the runner left it out
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input, TimeMillis: 120, RepeatMillis: []int64{100, 80, 90}}, nil
+			}
+
+			w.handle(delivery)
+
+			if runs["1"] != 1 || runs["2"] != 1 {
+				t.Errorf("runs = %v, want each test case run once, repeated by the runner", runs)
+			}
+			results := resultsFor(client, 1)
+			if len(results) != 1 || len(results[0].Results) != 2 {
+				t.Fatalf("published %+v, want one result with two test cases", results)
+			}
+			first, second := results[0].Results[0], results[0].Results[1]
+			if first.Status != "PASSED" || first.TimeTaken != tt.wantTime {
+				t.Errorf("tc1 = %s in %vs, want PASSED in %vs without the failed repetition", first.Status, first.TimeTaken, tt.wantTime)
+			}
+			if second.Status != "WRONG_ANSWER" {
+				t.Errorf("tc2 = %s, want WRONG_ANSWER from the output, whatever the timing", second.Status)
+			}
+		})
+	}
+}
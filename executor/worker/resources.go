@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"online-judge/executor/docker"
+	"online-judge/executor/types"
+)
+
+// resourceProfile returns the limits the submission's test cases run under: its
+// ResourceProfile with the defaults filled in, then held to the caps.
+func resourceProfile(submission types.SubmissionMessage, caps types.ResourceProfile) types.ResourceProfile {
+	var profile types.ResourceProfile
+	if submission.Resources != nil {
+		profile = *submission.Resources
+	}
+	if profile.TimeLimit == 0 {
+		profile.TimeLimit = RunTimeLimitSeconds
+	}
+	if profile.MemoryLimit == 0 {
+		profile.MemoryLimit = submission.MemoryLimit
+	}
+	if profile.MaxOutputLines == 0 {
+		profile.MaxOutputLines = submission.MaxOutputLines
+	}
+
+	if caps.TimeLimit > 0 && profile.TimeLimit > caps.TimeLimit {
+		profile.TimeLimit = caps.TimeLimit
+	}
+	if caps.CPUs > 0 && (profile.CPUs == 0 || profile.CPUs > caps.CPUs) {
+		profile.CPUs = caps.CPUs
+	}
+	profile.MemoryLimit = capped(profile.MemoryLimit, caps.MemoryLimit)
+	profile.MaxProcesses = capped(profile.MaxProcesses, caps.MaxProcesses)
+	profile.StackLimit = capped(profile.StackLimit, caps.StackLimit)
+	profile.MaxOutputLines = int(capped(int64(profile.MaxOutputLines), int64(caps.MaxOutputLines)))
+	profile.MaxFileSize = capped(profile.MaxFileSize, caps.MaxFileSize)
+	return profile
+}
+
+// capped holds a limit, where zero means unlimited, to a cap, where zero means none.
+func capped(limit, cap int64) int64 {
+	if cap > 0 && (limit == 0 || limit > cap) {
+		return cap
+	}
+	return limit
+}
+
+// runLimits converts the container limits of a profile for the runner.
+func runLimits(profile types.ResourceProfile) docker.ResourceLimits {
+	return docker.ResourceLimits{
+		CPUs:          profile.CPUs,
+		MaxProcesses:  profile.MaxProcesses,
+		StackBytes:    profile.StackLimit * 1024 * 1024,
+		FileSizeBytes: profile.MaxFileSize * 1024 * 1024,
+	}
+}
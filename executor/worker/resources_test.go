@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"encoding/json"
+	"online-judge/executor/docker"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"testing"
+)
+
+func TestProcessAppliesResourceProfile(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(1)", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", "1"),
+	})
+	profile := `{"timeLimit": 5, "memoryLimit": 128, "cpus": 1.5, "maxProcesses": 32, "stackLimit": 16, "maxOutputLines": 1000, "maxFileSize": 4}`
+	if err := json.Unmarshal([]byte(profile), &submission.Resources); err != nil {
+		t.Fatalf("failed to deserialize the profile: %v", err)
+	}
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	var got docker.RunRequest
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		got = req
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "1"}, nil
+	}
+
+	w.handle(testutil.CreateTestDelivery(submission))
+
+	if results := resultsFor(client, 1); len(results) != 1 || results[0].Status != "PASSED" {
+		t.Fatalf("results = %+v, want PASSED", results)
+	}
+	if got.TimeLimitSeconds != 5 || got.MemoryLimitBytes != 128*1024*1024 || got.MaxOutputLines != 1000 {
+		t.Errorf("run limits = %vs, %d bytes, %d lines; want 5s, 128MB, 1000 lines", got.TimeLimitSeconds, got.MemoryLimitBytes, got.MaxOutputLines)
+	}
+	want := docker.ResourceLimits{CPUs: 1.5, MaxProcesses: 32, StackBytes: 16 * 1024 * 1024, FileSizeBytes: 4 * 1024 * 1024}
+	if got.Limits != want {
+		t.Errorf("Limits = %+v, want %+v", got.Limits, want)
+	}
+}
+
+func TestResourceProfile(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(1)", 1.0, 64, nil)
+	submission.MaxOutputLines = 500
+
+	tests := []struct {
+		name    string
+		profile *types.ResourceProfile
+		caps    types.ResourceProfile
+		want    types.ResourceProfile
+	}{
+		{"defaults", nil, types.ResourceProfile{},
+			types.ResourceProfile{TimeLimit: RunTimeLimitSeconds, MemoryLimit: 64, MaxOutputLines: 500}},
+		{"profile overrides the flat fields", &types.ResourceProfile{MemoryLimit: 256, MaxOutputLines: 10}, types.ResourceProfile{},
+			types.ResourceProfile{TimeLimit: RunTimeLimitSeconds, MemoryLimit: 256, MaxOutputLines: 10}},
+		{"caps lower what is asked for",
+			&types.ResourceProfile{TimeLimit: 60, MemoryLimit: 4096, CPUs: 8, MaxProcesses: 1000, StackLimit: 1024, MaxOutputLines: 1e6, MaxFileSize: 1024},
+			types.ResourceProfile{TimeLimit: 10, MemoryLimit: 512, CPUs: 2, MaxProcesses: 64, StackLimit: 64, MaxOutputLines: 1e5, MaxFileSize: 16},
+			types.ResourceProfile{TimeLimit: 10, MemoryLimit: 512, CPUs: 2, MaxProcesses: 64, StackLimit: 64, MaxOutputLines: 1e5, MaxFileSize: 16}},
+		{"caps apply to unset limits", nil,
+			types.ResourceProfile{CPUs: 2, MaxProcesses: 64, StackLimit: 64, MaxFileSize: 16},
+			types.ResourceProfile{TimeLimit: RunTimeLimitSeconds, MemoryLimit: 64, CPUs: 2, MaxProcesses: 64, StackLimit: 64, MaxOutputLines: 500, MaxFileSize: 16}},
+		{"limits within the caps are kept", &types.ResourceProfile{TimeLimit: 2, CPUs: 1, MaxProcesses: 8},
+			types.ResourceProfile{TimeLimit: 10, CPUs: 2, MaxProcesses: 64},
+			types.ResourceProfile{TimeLimit: 2, MemoryLimit: 64, CPUs: 1, MaxProcesses: 8, MaxOutputLines: 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission.Resources = tt.profile
+			if got := resourceProfile(submission, tt.caps); got != tt.want {
+				t.Errorf("resourceProfile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"math"
+	"online-judge/executor/types"
+)
+
+// computeScore returns the normalized 0-100 score of a submission. Each test case is
+// worth its Weight (1 if unset); a test case outside any subtask earns its weight when
+// it passes, and a subtask earns the summed weight of its test cases only when all of
+// them pass. results holds one result per test case, in the same order.
+//
+// The score is rounded down to two decimals, so 100 is reported only when everything
+// passed, and 0 is reported when there is nothing to score.
+func computeScore(testCases []types.TestCaseMessage, results []types.TestCaseResultMessage) float64 {
+	var total, earned float64
+	for i, testCase := range testCases {
+		if testCase.Subtask != "" {
+			continue
+		}
+		weight := testCaseWeight(testCase)
+		total += weight
+		if i < len(results) && results[i].Status == "PASSED" {
+			earned += weight
+		}
+	}
+	for _, subtask := range computeSubtasks(testCases, results) {
+		total += subtask.MaxPoints
+		earned += subtask.Points
+	}
+
+	if total == 0 {
+		return 0
+	}
+	if earned == total {
+		return 100
+	}
+	// The epsilon keeps representation error (e.g. 28.999999 for 29) from rounding down a whole hundredth.
+	return math.Floor(earned/total*100*100+1e-6) / 100
+}
+
+// computeSubtasks breaks the score down by subtask, in the order the subtasks first
+// appear. A subtask's points are the summed weight of its test cases if all of them
+// passed, and 0 otherwise. Its verdict is PASSED, or the verdict of its first failed
+// test case; test cases that were not run (see SubmissionMessage.StopOn) fail it
+// without a verdict of their own, leaving it empty if no other test case failed.
+// It returns nil when the submission has no subtasks.
+func computeSubtasks(testCases []types.TestCaseMessage, results []types.TestCaseResultMessage) []types.SubtaskResultMessage {
+	var subtasks []types.SubtaskResultMessage
+	index := make(map[string]int)
+	failed := make(map[string]bool)
+	for i, testCase := range testCases {
+		if testCase.Subtask == "" {
+			continue
+		}
+		n, ok := index[testCase.Subtask]
+		if !ok {
+			n = len(subtasks)
+			index[testCase.Subtask] = n
+			subtasks = append(subtasks, types.SubtaskResultMessage{Subtask: testCase.Subtask, Status: "PASSED"})
+		}
+		subtask := &subtasks[n]
+		subtask.MaxPoints += testCaseWeight(testCase)
+
+		status := ""
+		if i < len(results) {
+			status = results[i].Status
+		}
+		if status == "PASSED" {
+			continue
+		}
+		if !failed[testCase.Subtask] || subtask.Status == "" {
+			subtask.Status = status
+		}
+		failed[testCase.Subtask] = true
+	}
+	for i := range subtasks {
+		if !failed[subtasks[i].Subtask] {
+			subtasks[i].Points = subtasks[i].MaxPoints
+		}
+	}
+	return subtasks
+}
+
+// testCaseWeight returns a test case's weight, 1 if unset.
+func testCaseWeight(testCase types.TestCaseMessage) float64 {
+	if testCase.Weight == 0 {
+		return 1
+	}
+	return testCase.Weight
+}
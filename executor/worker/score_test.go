@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"online-judge/executor/types"
+	"testing"
+)
+
+func TestComputeScore(t *testing.T) {
+	type tc struct {
+		weight  float64
+		subtask string
+		status  string
+	}
+	tests := []struct {
+		name      string
+		testCases []tc
+		want      float64
+	}{
+		{"no test cases", nil, 0},
+		{"all pass", []tc{{0, "", "PASSED"}, {0, "", "PASSED"}, {0, "", "PASSED"}}, 100},
+		{"all fail", []tc{{0, "", "WRONG_ANSWER"}, {0, "", "TIME_LIMIT_EXCEEDED"}}, 0},
+		{"unweighted half", []tc{{0, "", "PASSED"}, {0, "", "WRONG_ANSWER"}}, 50},
+		{"weighted", []tc{{3, "", "PASSED"}, {1, "", "WRONG_ANSWER"}}, 75},
+		{"thirds round down", []tc{{0, "", "PASSED"}, {0, "", "PASSED"}, {0, "", "WRONG_ANSWER"}}, 66.66},
+		{"exact hundredths survive float error", []tc{{29, "", "PASSED"}, {71, "", "WRONG_ANSWER"}}, 29},
+		{"almost everything is not 100", []tc{{99999, "", "PASSED"}, {1, "", "WRONG_ANSWER"}}, 99.99},
+		{"passed subtask", []tc{{10, "a", "PASSED"}, {10, "a", "PASSED"}, {20, "b", "WRONG_ANSWER"}}, 50},
+		{"subtask needs every test case", []tc{{10, "a", "PASSED"}, {10, "a", "WRONG_ANSWER"}, {20, "", "PASSED"}}, 50},
+		{"skipped test cases fail", []tc{{0, "", "PASSED"}, {0, "", "DEADLINE_EXCEEDED"}}, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var testCases []types.TestCaseMessage
+			var results []types.TestCaseResultMessage
+			for _, c := range tt.testCases {
+				testCases = append(testCases, types.TestCaseMessage{Weight: c.weight, Subtask: c.subtask})
+				results = append(results, types.TestCaseResultMessage{Status: c.status})
+			}
+			if got := computeScore(testCases, results); got != tt.want {
+				t.Errorf("computeScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeSubtasks(t *testing.T) {
+	type tc struct {
+		weight  float64
+		subtask string
+		status  string
+	}
+	tests := []struct {
+		name      string
+		testCases []tc
+		want      []types.SubtaskResultMessage
+	}{
+		{"no subtasks", []tc{{0, "", "PASSED"}, {0, "", "WRONG_ANSWER"}}, nil},
+		{"mixed verdicts", []tc{
+			{10, "1", "PASSED"}, {10, "1", "PASSED"},
+			{15, "2", "PASSED"}, {15, "2", "TIME_LIMIT_EXCEEDED"}, {15, "2", "WRONG_ANSWER"},
+			{5, "", "WRONG_ANSWER"},
+			{0, "3", "RUNTIME_ERROR"}, {0, "3", "PASSED"},
+		}, []types.SubtaskResultMessage{
+			{Subtask: "1", Points: 20, MaxPoints: 20, Status: "PASSED"},
+			{Subtask: "2", Points: 0, MaxPoints: 45, Status: "TIME_LIMIT_EXCEEDED"},
+			{Subtask: "3", Points: 0, MaxPoints: 2, Status: "RUNTIME_ERROR"},
+		}},
+		{"interleaved subtasks keep first-appearance order", []tc{
+			{1, "b", "PASSED"}, {1, "a", "WRONG_ANSWER"}, {1, "b", "MEMORY_LIMIT_EXCEEDED"}, {1, "a", "PASSED"},
+		}, []types.SubtaskResultMessage{
+			{Subtask: "b", Points: 0, MaxPoints: 2, Status: "MEMORY_LIMIT_EXCEEDED"},
+			{Subtask: "a", Points: 0, MaxPoints: 2, Status: "WRONG_ANSWER"},
+		}},
+		{"test cases that were not run", []tc{
+			{1, "a", "PASSED"}, {1, "a", "RUNTIME_ERROR"}, {1, "b", ""}, {1, "c", ""}, {1, "c", ""},
+		}, []types.SubtaskResultMessage{
+			{Subtask: "a", Points: 0, MaxPoints: 2, Status: "RUNTIME_ERROR"},
+			{Subtask: "b", Points: 0, MaxPoints: 1, Status: ""},
+			{Subtask: "c", Points: 0, MaxPoints: 2, Status: ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var testCases []types.TestCaseMessage
+			var results []types.TestCaseResultMessage
+			for _, c := range tt.testCases {
+				testCases = append(testCases, types.TestCaseMessage{Weight: c.weight, Subtask: c.subtask})
+				if c.status != "" {
+					results = append(results, types.TestCaseResultMessage{Status: c.status})
+				}
+			}
+			got := computeSubtasks(testCases, results)
+			if len(got) != len(tt.want) {
+				t.Fatalf("computeSubtasks() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("subtask %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
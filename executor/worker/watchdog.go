@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"encoding/json"
+	"log"
+	"online-judge/executor/types"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// jobClaim decides who finishes a job: the worker's own processing or the watchdog
+// giving up on it. Only the first to claim may publish the final result and settle
+// the delivery, so an abandoned run that eventually returns cannot double-settle.
+type jobClaim struct {
+	mu      sync.Mutex
+	claimed bool
+}
+
+func (c *jobClaim) claim() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.claimed {
+		return false
+	}
+	c.claimed = true
+	return true
+}
+
+// handle processes a job under the ProcessTimeout watchdog. When the deadline passes the
+// worker stops waiting and moves on; the stuck processing keeps running in the background
+// until its blocked call returns, but its result is discarded.
+func (w *Worker) handle(job amqp091.Delivery) {
+	claim := &jobClaim{}
+	if w.config.ProcessTimeout <= 0 {
+		w.processRecovering(job, claim)
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.processRecovering(job, claim)
+	}()
+
+	timer := time.NewTimer(w.config.ProcessTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		if !claim.claim() {
+			// Processing finished just in time and is publishing its own result.
+			<-done
+			return
+		}
+		w.abandon(job)
+	}
+}
+
+// abandon gives up on a submission that exceeded the watchdog deadline and retries it.
+func (w *Worker) abandon(job amqp091.Delivery) {
+	var submission types.SubmissionMessage
+	if err := json.Unmarshal(job.Body, &submission); err != nil {
+		log.Printf("[Worker %d] Watchdog abandoned an undecodable submission: %v. Rejecting message.", w.id, err)
+		job.Nack(false, false)
+		return
+	}
+	log.Printf("[Submission %d] [Worker %d] Processing exceeded the %v watchdog deadline on attempt %d. Abandoning.", submission.SubmissionID, w.id, w.config.ProcessTimeout, submission.Attempts+1)
+	w.retry(job, submission, func(attempts int) {
+		w.publishInternalError(submission, attempts)
+	})
+}
+
+// retry settles a job whose processing failed with INTERNAL_ERROR. The submission is
+// republished with an incremented attempt counter until MaxAttempts is reached, after
+// which giveUp publishes the final INTERNAL_ERROR and the message is dead-lettered, so
+// that a deterministic failure cannot loop forever. Either way the submission's result
+// reservation is released, for the retry to be judged and the final error published.
+func (w *Worker) retry(job amqp091.Delivery, submission types.SubmissionMessage, giveUp func(attempts int)) {
+	w.releaseResult(submission)
+	attempts := submission.Attempts + 1
+	if attempts >= w.config.MaxAttempts {
+		log.Printf("[Submission %d] [Worker %d] Giving up after %d attempts. Sending to DLQ.", submission.SubmissionID, w.id, attempts)
+		giveUp(attempts)
+		job.Nack(false, false)
+		return
+	}
+
+	submission.Attempts = attempts
+	queue := w.config.SubmissionQueue
+	if w.config.RetryQueue != "" {
+		queue = w.config.RetryQueue
+	}
+	if err := w.republish(queue, submission, job.Priority); err != nil {
+		log.Printf("[Submission %d] [Worker %d] Failed to republish for retry: %v. Requeueing unchanged.", submission.SubmissionID, w.id, err)
+		job.Nack(false, true)
+		return
+	}
+	if err := updateStatus(submission.SubmissionID, "RETRYING", w); err != nil {
+		log.Printf("[Submission %d] [Worker %d] Failed to publish retrying status: %v", submission.SubmissionID, w.id, err)
+	}
+	job.Ack(false)
+}
+
+// priorityPublisher is implemented by clients that can publish with an AMQP priority.
+type priorityPublisher interface {
+	PublishWithPriority(exchange, routingKey string, body interface{}, priority uint8) error
+}
+
+// republish publishes a submission to be retried with the priority it was delivered
+// with, so that a high-priority submission is not retried at the default priority.
+func (w *Worker) republish(queue string, submission types.SubmissionMessage, priority uint8) error {
+	if publisher, ok := w.mqClient.(priorityPublisher); ok {
+		return publisher.PublishWithPriority("", queue, submission, priority)
+	}
+	return w.mqClient.Publish("", queue, submission)
+}
+
+func (w *Worker) publishInternalError(submission types.SubmissionMessage, attempts int) {
+	if w.duplicateResult(submission) {
+		log.Printf("[Submission %d] [Worker %d] A result was already published within the last %v. Not publishing the internal error.", submission.SubmissionID, w.id, w.config.ResultDedupWindow)
+		return
+	}
+	result := types.ResultNotificationMessage{
+		SubmissionID: submission.SubmissionID,
+		Status:       "INTERNAL_ERROR",
+		Attempts:     attempts,
+		Metadata:     submission.Metadata,
+	}
+	if err := w.publishResult(result); err != nil {
+		log.Printf("[Submission %d] [Worker %d] Failed to publish internal error result: %v", submission.SubmissionID, w.id, err)
+	}
+}
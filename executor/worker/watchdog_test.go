@@ -0,0 +1,346 @@
+package worker
+
+import (
+	"encoding/base64"
+	"errors"
+	"online-judge/executor/docker"
+	"online-judge/executor/rabbitmq"
+	"online-judge/executor/testutil"
+	"online-judge/executor/types"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func resultsFor(client *testutil.RecordingClient, submissionID int64) []types.ResultNotificationMessage {
+	var results []types.ResultNotificationMessage
+	for _, p := range client.Published() {
+		if p.Exchange != rabbitmq.ResultExchange {
+			continue
+		}
+		var messages []types.ResultNotificationMessage
+		if batch, ok := p.Body.(types.ResultBatchMessage); ok {
+			messages = batch.Results
+		} else {
+			messages = append(messages, p.Body.(types.ResultNotificationMessage))
+		}
+		for _, msg := range messages {
+			if msg.SubmissionID == submissionID {
+				results = append(results, msg)
+			}
+		}
+	}
+	return results
+}
+
+func TestWatchdogRecoversHungWorker(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	hung := testutil.CreateTestSubmission(1, "PYTHON", "print('hi')", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", "hi"),
+	})
+	healthy := testutil.CreateTestSubmission(2, "PYTHON", "print('hi')", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", "hi"),
+	})
+
+	jobQueue := make(chan amqp091.Delivery, 2)
+	hungDelivery := testutil.CreateTestDelivery(hung)
+	hungDelivery.Acknowledger, hungDelivery.DeliveryTag = acker, 1
+	healthyDelivery := testutil.CreateTestDelivery(healthy)
+	healthyDelivery.Acknowledger, healthyDelivery.DeliveryTag = acker, 2
+	jobQueue <- hungDelivery
+	jobQueue <- healthyDelivery
+	close(jobQueue)
+
+	release := make(chan struct{})
+	hungReturned := make(chan struct{})
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ProcessTimeout = 100 * time.Millisecond
+	config.MaxAttempts = 1
+	w := NewWorker(1, jobQueue, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		if req.SubmissionID == 1 {
+			<-release
+			defer close(hungReturned)
+		}
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "hi", TimeMillis: 10, MemoryKB: 1024}, nil
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		w.Start()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("worker did not recover from the hung submission")
+	}
+
+	if s, _ := acker.Settlement(1); !s.Nacked || s.Requeued || s.Acked {
+		t.Errorf("hung delivery settlement = %+v, want nacked to the DLQ", s)
+	}
+	if s, _ := acker.Settlement(2); !s.Acked {
+		t.Errorf("healthy delivery settlement = %+v, want acked", s)
+	}
+	if results := resultsFor(client, 1); len(results) != 1 || results[0].Status != "INTERNAL_ERROR" {
+		t.Errorf("hung submission results = %+v, want a single INTERNAL_ERROR", results)
+	}
+	if results := resultsFor(client, 2); len(results) != 1 || results[0].Status != "PASSED" {
+		t.Errorf("healthy submission results = %+v, want a single PASSED", results)
+	}
+
+	// Let the abandoned run finish; its late result must be dropped.
+	close(release)
+	<-hungReturned
+	time.Sleep(50 * time.Millisecond)
+
+	if results := resultsFor(client, 1); len(results) != 1 {
+		t.Errorf("hung submission published %d results after recovery, want 1", len(results))
+	}
+	if s, _ := acker.Settlement(1); s.Acked {
+		t.Error("abandoned run should not ack the dead-lettered delivery")
+	}
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	delivery.Acknowledger, delivery.DeliveryTag = acker, 1
+
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ProcessTimeout = 0
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	w.handle(delivery)
+
+	if s, _ := acker.Settlement(1); !s.Acked {
+		t.Errorf("settlement = %+v, want acked", s)
+	}
+}
+
+func TestJobClaim(t *testing.T) {
+	claim := &jobClaim{}
+	if !claim.claim() {
+		t.Error("first claim should succeed")
+	}
+	if claim.claim() {
+		t.Error("second claim should fail")
+	}
+}
+
+func TestWatchdogStopsRetryingAfterMaxAttempts(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ProcessTimeout = 20 * time.Millisecond
+	config.MaxAttempts = 3
+	config.SubmissionQueue = "oj.q.submissions"
+	w := NewWorker(1, nil, client, config)
+	var runs int32
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		atomic.AddInt32(&runs, 1)
+		<-release // Fails deterministically: every attempt hangs
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
+		delivery.Acknowledger, delivery.DeliveryTag = acker, uint64(attempt)
+		w.handle(delivery)
+
+		s, _ := acker.Settlement(uint64(attempt))
+		if attempt < config.MaxAttempts {
+			if !s.Acked {
+				t.Fatalf("attempt %d settlement = %+v, want acked after republishing", attempt, s)
+			}
+			published := client.Published()
+			retry := published[len(published)-2] // followed by the RETRYING status update
+			if retry.Exchange != "" || retry.RoutingKey != config.SubmissionQueue {
+				t.Fatalf("attempt %d republished to %q/%q, want the submission queue", attempt, retry.Exchange, retry.RoutingKey)
+			}
+			submission := retry.Body.(types.SubmissionMessage)
+			if submission.Attempts != attempt {
+				t.Fatalf("attempt %d republished with Attempts = %d, want %d", attempt, submission.Attempts, attempt)
+			}
+			delivery = testutil.CreateTestDelivery(submission)
+			continue
+		}
+		if !s.Nacked || s.Requeued {
+			t.Errorf("final attempt settlement = %+v, want nacked to the DLQ", s)
+		}
+	}
+
+	if n := atomic.LoadInt32(&runs); int(n) != config.MaxAttempts {
+		t.Errorf("ran %d attempts, want %d", n, config.MaxAttempts)
+	}
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "INTERNAL_ERROR" || results[0].Attempts != config.MaxAttempts {
+		t.Errorf("results = %+v, want a single final INTERNAL_ERROR after %d attempts", results, config.MaxAttempts)
+	}
+}
+
+func TestWatchdogRetriesOnRetryQueue(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ProcessTimeout = 20 * time.Millisecond
+	config.MaxAttempts = 3
+	config.SubmissionQueue = "oj.q.submissions"
+	config.RetryQueue = "oj.q.submissions.retry"
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		<-release
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+	w.handle(delivery)
+
+	published := client.Published()
+	retry := published[len(published)-2] // followed by the RETRYING status update
+	if retry.Exchange != "" || retry.RoutingKey != config.RetryQueue {
+		t.Errorf("republished to %q/%q, want the retry queue", retry.Exchange, retry.RoutingKey)
+	}
+}
+
+func TestRetryKeepsPriority(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.ProcessTimeout = 20 * time.Millisecond
+	config.MaxAttempts = 3
+	config.SubmissionQueue = "oj.q.submissions"
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		<-release
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+	delivery.Priority = 7
+	w.handle(delivery)
+
+	published := client.Published()
+	retry := published[len(published)-2] // followed by the RETRYING status update
+	if retry.RoutingKey != config.SubmissionQueue || retry.Priority != 7 {
+		t.Errorf("republished to %q with priority %d, want the submission queue with priority 7", retry.RoutingKey, retry.Priority)
+	}
+}
+
+// failingResultsClient records publishes but fails those of results.
+type failingResultsClient struct {
+	*testutil.RecordingClient
+}
+
+func (c failingResultsClient) Publish(exchange, routingKey string, body interface{}) error {
+	if exchange == rabbitmq.ResultExchange {
+		return errors.New("broker unavailable")
+	}
+	return c.RecordingClient.Publish(exchange, routingKey, body)
+}
+
+// checkedSubmission is a submission judged by a checker, whose code is "checker".
+func checkedSubmission() types.SubmissionMessage {
+	submission := testutil.CreatePythonHelloWorldSubmission()
+	submission.Checker = &types.ProgramMessage{Language: "PYTHON", Code: base64.StdEncoding.EncodeToString([]byte("checker"))}
+	return submission
+}
+
+func TestRetryCountsEveryFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		client func(*testutil.RecordingClient) rabbitmq.ClientInterface
+		result *docker.ExecutionResult
+	}{
+		{"internal error verdict", func(c *testutil.RecordingClient) rabbitmq.ClientInterface { return c },
+			&docker.ExecutionResult{Status: "TIME_LIMIT_EXCEEDED"}}, // The checker fails
+		{"result publish failure", func(c *testutil.RecordingClient) rabbitmq.ClientInterface { return failingResultsClient{c} },
+			&docker.ExecutionResult{Status: "ACCEPTED", Output: "OK"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &testutil.RecordingClient{}
+			config := DefaultConfig()
+			config.SubmissionQueue = "oj.q.submissions"
+			w := NewWorker(1, nil, tt.client(recorder), config)
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				if req.Code == "checker" {
+					return tt.result, nil
+				}
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+			}
+
+			acker := testutil.NewRecordingAcknowledger()
+			delivery := testutil.CreateTestDelivery(checkedSubmission())
+			for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
+				delivery.Acknowledger, delivery.DeliveryTag = acker, uint64(attempt)
+				w.handle(delivery)
+
+				s, _ := acker.Settlement(uint64(attempt))
+				if attempt == config.MaxAttempts {
+					if !s.Nacked || s.Requeued {
+						t.Errorf("final attempt settlement = %+v, want nacked to the DLQ", s)
+					}
+					break
+				}
+				if !s.Acked || s.Requeued {
+					t.Fatalf("attempt %d settlement = %+v, want acked after republishing", attempt, s)
+				}
+				var submission types.SubmissionMessage
+				for _, p := range recorder.Published() {
+					if republished, ok := p.Body.(types.SubmissionMessage); ok {
+						submission = republished
+					}
+				}
+				if submission.Attempts != attempt {
+					t.Fatalf("attempt %d republished with Attempts = %d, want %d", attempt, submission.Attempts, attempt)
+				}
+				delivery = testutil.CreateTestDelivery(submission)
+			}
+		})
+	}
+}
+
+func TestRetryWithoutMaxAttemptsDeadLetters(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	config := DefaultConfig()
+	config.MaxAttempts = 0
+	w := NewWorker(1, nil, client, config)
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		if req.Code == "checker" {
+			return &docker.ExecutionResult{Status: "TIME_LIMIT_EXCEEDED"}, nil // The checker fails
+		}
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(checkedSubmission())
+	delivery.Acknowledger = acker
+	w.handle(delivery)
+
+	if s, _ := acker.Settlement(0); !s.Nacked || s.Requeued {
+		t.Errorf("settlement = %+v, want nacked to the DLQ", s)
+	}
+	if results := resultsFor(client, 1); len(results) != 1 || results[0].Status != "INTERNAL_ERROR" || results[0].Attempts != 1 {
+		t.Errorf("results = %+v, want a single final INTERNAL_ERROR", results)
+	}
+}
@@ -1,48 +1,151 @@
 package worker
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"log"
 	"online-judge/executor/docker"
 	"online-judge/executor/rabbitmq"
 	"online-judge/executor/types"
+	"online-judge/executor/version"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// RunTimeLimitSeconds is the wall-clock limit each test case run is given.
+const RunTimeLimitSeconds = 30.0
+
+// Verdicts lists every verdict a test case or a whole submission can be given.
+var Verdicts = []string{
+	"PASSED",
+	"WRONG_ANSWER",
+	"ENCODING_ERROR",
+	"TIME_LIMIT_EXCEEDED",
+	"MEMORY_LIMIT_EXCEEDED",
+	"RESOURCE_LIMIT",
+	"OUTPUT_LIMIT_EXCEEDED",
+	"RUNTIME_ERROR",
+	"COMPILATION_ERROR",
+	"INTERNAL_ERROR",
+	"DEADLINE_EXCEEDED",
+	"INVALID",
+}
+
 type Worker struct {
-	id       int
-	jobQueue <-chan amqp091.Delivery
-	mqClient rabbitmq.ClientInterface
+	id        int
+	jobQueue  <-chan amqp091.Delivery
+	mqClient  rabbitmq.ClientInterface
+	config    Config
+	runner    func(docker.RunRequest) (*docker.ExecutionResult, error)
+	host      string
+	cache     *compareCache
+	crashes   *CrashTracker
+	published *PublishedResults
+	// stop is closed when the caller of Judge gives up on the submission.
+	stop <-chan struct{}
 }
 
-func NewWorker(id int, jobQueue <-chan amqp091.Delivery, mqClient rabbitmq.ClientInterface) *Worker {
+func NewWorker(id int, jobQueue <-chan amqp091.Delivery, mqClient rabbitmq.ClientInterface, config Config) *Worker {
+	runner := config.Runner
+	if runner == nil {
+		runner = docker.Run
+	}
 	return &Worker{
-		id:       id,
-		jobQueue: jobQueue,
-		mqClient: mqClient,
+		id:        id,
+		jobQueue:  jobQueue,
+		mqClient:  mqClient,
+		config:    config,
+		runner:    runner,
+		host:      executorHost(),
+		cache:     newCompareCache(config.CompareCacheSize),
+		crashes:   crashTracker(config),
+		published: publishedResults(config),
+	}
+}
+
+// crashTracker returns the crash tracker shared by the workers, or one of the worker's
+// own when the master did not set one.
+func crashTracker(config Config) *CrashTracker {
+	if config.Crashes != nil {
+		return config.Crashes
+	}
+	return NewCrashTracker()
+}
+
+// executorHost returns the name of the host the executor runs on, or "" if unknown.
+func executorHost() string {
+	host, err := os.Hostname()
+	if err != nil {
+		log.Printf("Failed to determine the executor host name: %v", err)
+		return ""
 	}
+	return host
+}
+
+// busyWorkers counts the workers of this executor that are processing a submission.
+var busyWorkers int32
+
+// Busy returns how many workers are processing a submission right now.
+func Busy() int {
+	return int(atomic.LoadInt32(&busyWorkers))
+}
+
+// Judge judges a submission that did not come from the queue, e.g. one sent to the
+// HTTP run endpoint. Its status updates and result are published through the worker's
+// client, like those of a queued submission. Once ctx is done, judging stops before the
+// next test case and no result is published.
+func (w *Worker) Judge(ctx context.Context, submission types.SubmissionMessage) error {
+	body, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	w.stop = ctx.Done()
+	w.handle(amqp091.Delivery{ContentType: "application/json", Body: body})
+	return nil
 }
 
 func (w *Worker) Start() {
 	for job := range w.jobQueue {
-		w.process(job)
+		atomic.AddInt32(&busyWorkers, 1)
+		w.handle(job)
+		atomic.AddInt32(&busyWorkers, -1)
+		if w.config.JobDone != nil {
+			w.config.JobDone()
+		}
 	}
 }
 
-func (w *Worker) process(job amqp091.Delivery) {
+func (w *Worker) process(job amqp091.Delivery, claim *jobClaim) {
 	var submission types.SubmissionMessage
 	if err := json.Unmarshal(job.Body, &submission); err != nil {
 		log.Printf("[Worker %d] Error deserializing submission: %v. Rejecting message.", w.id, err)
-		job.Nack(false, false) // Nack and send to DLQ
+		if claim.claim() {
+			job.Nack(false, false) // Nack and send to DLQ
+		}
 		return
 	}
 	log.Printf("[Submission %d] [Worker %d] Processing submission.", submission.SubmissionID, w.id)
+	if !w.reserveResult(submission) {
+		log.Printf("[Submission %d] [Worker %d] A result was already published or is being judged within the last %v. Skipping this one.", submission.SubmissionID, w.id, w.config.ResultDedupWindow)
+		if claim.claim() {
+			job.Ack(false)
+		}
+		return
+	}
 
-	if err := updateStatus(submission.SubmissionID, "RUNNING", w); err != nil {
-		log.Printf("[Submission %d] [Worker %d] Failed to publish running status: %v", submission.SubmissionID, w.id, err)
+	// A compiled submission is COMPILING until its first run got past the compile step
+	phase := "RUNNING"
+	if w.config.ReportCompiling && docker.Compiles(submission.Language) {
+		phase = "COMPILING"
+	}
+	if err := updateStatus(submission.SubmissionID, phase, w); err != nil {
+		log.Printf("[Submission %d] [Worker %d] Failed to publish %s status: %v", submission.SubmissionID, w.id, strings.ToLower(phase), err)
 		// We will continue processing but NACK at the end if results also fail to publish.
 	}
 
@@ -50,15 +153,114 @@ func (w *Worker) process(job amqp091.Delivery) {
 	decodedCode, err := base64.StdEncoding.DecodeString(submission.Code)
 	if err != nil {
 		log.Printf("[Submission %d] [Worker %d] Failed to decode submission code: %v. Rejecting message.", submission.SubmissionID, w.id, err)
-		job.Ack(false) // Ack the message as there is no point executing further with a malformed code
+		if claim.claim() {
+			w.releaseResult(submission)
+			job.Ack(false) // Ack the message as there is no point executing further with a malformed code
+		}
 		return
 	}
 	var results []types.TestCaseResultMessage
+	var compileWarnings, compileCommand, executeCommand string
+	// compileMillis is the compile time of the first run that compiled; every test
+	// case compiles the same code, so one is representative. Syntax checks of
+	// interpreted languages are not compiles and leave it zero.
+	var compileMillis int64
+	// compileError is the diagnostics of a failed compile or syntax check, which would
+	// fail every other test case the same way. syntaxChecked is set once a run got past
+	// the syntax check, so that later runs can skip it.
+	var compileError *string
+	syntaxChecked := false
+	profile := resourceProfile(submission, w.config.ResourceCaps)
+	memoryLimitBytes := profile.MemoryLimit * 1024 * 1024 // Convert MB to bytes
+	runRequest := func(testCase types.TestCaseMessage, input string) docker.RunRequest {
+		return docker.RunRequest{
+			SubmissionID:     submission.SubmissionID,
+			Language:         submission.Language,
+			Code:             string(decodedCode),
+			Input:            input,
+			TimeLimitSeconds: profile.TimeLimit,
+			MemoryLimitBytes: memoryLimitBytes,
+			MaxThreads:       submission.MaxThreads,
+			MaxOutputLines:   profile.MaxOutputLines,
+			IgnoreExitCode:   submission.CheckerConfig.ExitCode == types.ExitCodeIgnore || testCase.ExpectedExitCode != nil,
+			SkipSyntaxCheck:  syntaxChecked,
+			Function:         submission.Function,
+			Limits:           runLimits(profile),
+			DebugBuild:       submission.DebugBuild,
+			Repetitions:      submission.Repetitions,
+		}
+	}
+	var runs []*pendingRun
+	stopRuns := func() {}
+	if parallelism := testCaseParallelism(w.config.TestCaseParallelism, memoryLimitBytes); parallelism > 1 && len(submission.TestCases) > 1 {
+		// Generated test cases get their input in the loop, and are run there
+		reqs := make([]*docker.RunRequest, len(submission.TestCases))
+		for i, testCase := range submission.TestCases {
+			if input, err := base64.StdEncoding.DecodeString(testCase.Input); err == nil && testCase.Seed == nil {
+				req := runRequest(testCase, string(input))
+				reqs[i] = &req
+			}
+		}
+		log.Printf("[Submission %d] [Worker %d] Running up to %d test cases at once.", submission.SubmissionID, w.id, parallelism)
+		runs, stopRuns = w.runAhead(reqs, parallelism)
+		defer stopRuns() // Also when processing crashes
+	}
 	totalTestCases := len(submission.TestCases)
+	reported := 0
+	reportProgress := func() {
+		for ; w.config.Progress != nil && reported < len(results); reported++ {
+			w.config.Progress(submission.SubmissionID, results[reported], reported+1, totalTestCases)
+		}
+	}
 	for i, testCase := range submission.TestCases {
 		testCaseIndex := i + 1
+		if w.stopped() {
+			log.Printf("[Submission %d] [Worker %d] Judging was cancelled. Skipping the remaining %d test cases without a result.",
+				submission.SubmissionID, w.id, totalTestCases-i)
+			if claim.claim() {
+				w.releaseResult(submission)
+			}
+			return
+		}
+		reportProgress()
+		if i > 0 && stopsJudging(submission.StopOn, results[i-1].Status) {
+			log.Printf("[Submission %d] [Worker %d] TestCase %d/%d was %s. Skipping the remaining %d test cases.",
+				submission.SubmissionID, w.id, i, totalTestCases, results[i-1].Status, totalTestCases-i)
+			break
+		}
+		if submission.Deadline != nil && !time.Now().Before(*submission.Deadline) {
+			log.Printf("[Submission %d] [Worker %d] Deadline %s passed. Skipping the remaining %d test cases.",
+				submission.SubmissionID, w.id, submission.Deadline.Format(time.RFC3339), totalTestCases-i)
+			for _, skipped := range submission.TestCases[i:] {
+				results = append(results, types.TestCaseResultMessage{
+					TestCaseID: skipped.TestCaseID,
+					Status:     "DEADLINE_EXCEEDED",
+				})
+			}
+			break
+		}
+		if compileError != nil {
+			results = append(results, types.TestCaseResultMessage{
+				TestCaseID: testCase.TestCaseID,
+				Status:     "COMPILATION_ERROR",
+				Output:     *compileError,
+			})
+			continue
+		}
 		log.Printf("[Submission %d] [Worker %d] TestCase %d/%d: Starting execution", submission.SubmissionID, w.id, testCaseIndex, totalTestCases)
 
+		if testCase.Seed != nil {
+			if err := w.generateTestCase(submission, &testCase, memoryLimitBytes); err != nil {
+				log.Printf("[Submission %d] [Worker %d] Failed to generate test case %s: %v", submission.SubmissionID, w.id, testCase.TestCaseID, err)
+				results = append(results, types.TestCaseResultMessage{
+					TestCaseID: testCase.TestCaseID,
+					Status:     "INTERNAL_ERROR",
+					Output:     base64.StdEncoding.EncodeToString([]byte(err.Error())),
+				})
+				continue
+			}
+		}
+
 		decodedInput, err := base64.StdEncoding.DecodeString(testCase.Input)
 		if err != nil {
 			log.Printf("[Submission %d] [Worker %d] Failed to decode test case input %s: %v. Failing this test case.", submission.SubmissionID, w.id, testCase.TestCaseID, err)
@@ -70,9 +272,9 @@ func (w *Worker) process(job amqp091.Delivery) {
 			continue
 		}
 
-		memoryLimitBytes := submission.MemoryLimit * 1024 * 1024 // Convert MB to bytes
-		log.Printf("[Submission %d] [Worker %d] TestCase %d/%d: Executing code with 30s timeout", submission.SubmissionID, w.id, testCaseIndex, totalTestCases)
-		execResult, err := docker.RunInContainerWithLimits(submission.SubmissionID, submission.Language, string(decodedCode), string(decodedInput), 30.0, memoryLimitBytes)
+		log.Printf("[Submission %d] [Worker %d] TestCase %d/%d: Executing code with %.0fs timeout", submission.SubmissionID, w.id, testCaseIndex, totalTestCases, profile.TimeLimit)
+		req := runRequest(testCase, string(decodedInput))
+		execResult, err := w.run(runs, i, req)
 		if err != nil {
 			log.Printf("[Submission %d] [Worker %d] Execution failed for test case %s: %v", submission.SubmissionID, w.id, testCase.TestCaseID, err)
 			results = append(results, types.TestCaseResultMessage{
@@ -82,6 +284,29 @@ func (w *Worker) process(job amqp091.Delivery) {
 			})
 			continue
 		}
+		if compileMillis == 0 && docker.Compiles(submission.Language) {
+			compileMillis = execResult.CompileMillis
+		}
+		if execResult.Status == "COMPILATION_ERROR" {
+			output := base64.StdEncoding.EncodeToString([]byte(execResult.Output))
+			compileError = &output
+			stopRuns()
+			if i+1 < totalTestCases {
+				log.Printf("[Submission %d] [Worker %d] Compilation failed. Failing the remaining %d test cases without running them.",
+					submission.SubmissionID, w.id, totalTestCases-testCaseIndex)
+			}
+		} else {
+			syntaxChecked = true
+			if phase == "COMPILING" {
+				phase = "RUNNING"
+				if err := updateStatus(submission.SubmissionID, phase, w); err != nil {
+					log.Printf("[Submission %d] [Worker %d] Failed to publish running status: %v", submission.SubmissionID, w.id, err)
+				}
+			}
+		}
+		if submission.Repetitions > 1 && execResult.Status == "ACCEPTED" {
+			execResult.TimeMillis = w.repeatedTime(execResult, submission.Repetitions, submission.Timing)
+		}
 
 		decodedExpectedOutput, err := base64.StdEncoding.DecodeString(testCase.ExpectedOutput)
 		if err != nil {
@@ -94,7 +319,50 @@ func (w *Worker) process(job amqp091.Delivery) {
 			continue
 		}
 
-		status := computeTestCaseStatus(execResult, string(decodedExpectedOutput))
+		if compileWarnings == "" {
+			compileWarnings = execResult.CompileOutput
+		}
+		if compileCommand == "" && executeCommand == "" {
+			compileCommand, executeCommand = execResult.CompileCommand, execResult.ExecuteCommand
+		}
+
+		execResult.Output = filterOutput(execResult.Output, w.outputFilters(submission.Language))
+
+		checker := submission.CheckerConfig
+		if testCase.Mode != "" {
+			checker.Mode = testCase.Mode
+		}
+		if checker.Mode == CompareRegex {
+			if _, err := expectedPattern(string(decodedExpectedOutput), checker.IgnoreCase); err != nil {
+				log.Printf("[Submission %d] [Worker %d] Invalid expected output for test case %s: %v", submission.SubmissionID, w.id, testCase.TestCaseID, err)
+				results = append(results, types.TestCaseResultMessage{
+					TestCaseID: testCase.TestCaseID,
+					Status:     "INTERNAL_ERROR",
+					Output:     base64.StdEncoding.EncodeToString([]byte(err.Error())),
+				})
+				continue
+			}
+		}
+
+		status := computeTestCaseStatus(execResult, string(decodedExpectedOutput), checker, w.cache)
+		if submission.Checker != nil && !testCase.ExitCodeOnly && (status == "PASSED" || status == "WRONG_ANSWER") {
+			status, err = w.runChecker(submission, string(decodedInput), string(decodedExpectedOutput), execResult.Output)
+			if err != nil {
+				log.Printf("[Submission %d] [Worker %d] Checker failed on test case %s: %v", submission.SubmissionID, w.id, testCase.TestCaseID, err)
+				results = append(results, types.TestCaseResultMessage{
+					TestCaseID: testCase.TestCaseID,
+					Status:     "INTERNAL_ERROR",
+					Output:     base64.StdEncoding.EncodeToString([]byte(err.Error())),
+					TimeTaken:  float64(execResult.TimeMillis) / 1000,
+					MemoryUsed: execResult.MemoryKB,
+				})
+				continue
+			}
+		}
+
+		if testCase.ExpectedExitCode != nil {
+			status = exitCodeStatus(status, execResult.ExitCode, execResult.Signal, *testCase.ExpectedExitCode, testCase.ExitCodeOnly)
+		}
 
 		if status != "PASSED" {
 			log.Printf("[Submission %d] [Worker %d] TestCase %d/%d: %s - Expected: %q, Actual: %q",
@@ -105,18 +373,87 @@ func (w *Worker) process(job amqp091.Delivery) {
 				submission.SubmissionID, w.id, testCaseIndex, totalTestCases)
 		}
 
-		results = append(results, types.TestCaseResultMessage{
+		output := execResult.Output
+		if status == "RUNTIME_ERROR" && submission.CheckerConfig.RuntimeErrorAsWrongAnswer && !testCase.IsSample {
+			// Neither the verdict nor the error output may reveal that it crashed
+			status, output = "WRONG_ANSWER", ""
+		}
+
+		result := types.TestCaseResultMessage{
 			TestCaseID: testCase.TestCaseID,
-			Output:     base64.StdEncoding.EncodeToString([]byte(execResult.Output)),
+			Output:     base64.StdEncoding.EncodeToString([]byte(output)),
 			Status:     status,
 			TimeTaken:  float64(execResult.TimeMillis) / 1000,
 			MemoryUsed: execResult.MemoryKB,
-		})
+			Overran:    execResult.Overran,
+			Overrun:    float64(execResult.OverrunMillis) / 1000,
+			KilledAt:   float64(execResult.KilledAtMillis) / 1000,
+			DiskUsed:   execResult.DiskKB,
+		}
+		result.ResourceUsage = resourceUsage(execResult, result)
+		if execResult.Timeline != "" {
+			result.Timeline = base64.StdEncoding.EncodeToString([]byte(execResult.Timeline))
+		}
+		if testCase.IsSample && isWrongOutput(status) {
+			diff := sampleDiff(string(decodedExpectedOutput), execResult.Output)
+			result.Diff = base64.StdEncoding.EncodeToString([]byte(diff))
+		}
+		results = append(results, result)
 	}
+	stopRuns() // Judging may have ended early
+	reportProgress()
 
-	if err := sendResults(submission.SubmissionID, results, w); err != nil {
-		log.Printf("[Submission %d] [Worker %d] Failed to publish results: %v. NACKing message.", submission.SubmissionID, w.id, err)
-		job.Nack(false, true) // Nack and requeue, as results failed to send
+	if !claim.claim() {
+		log.Printf("[Submission %d] [Worker %d] Submission was abandoned by the watchdog. Dropping late results.", submission.SubmissionID, w.id)
+		return
+	}
+	resultNotification := types.ResultNotificationMessage{
+		SubmissionID:   submission.SubmissionID,
+		Results:        results,
+		Score:          computeScore(submission.TestCases, results),
+		Subtasks:       computeSubtasks(submission.TestCases, results),
+		Metadata:       submission.Metadata,
+		CompileMillis:  compileMillis,
+		PreviousStatus: submission.PreviousStatus,
+	}
+	if compileWarnings != "" {
+		resultNotification.CompileOutput = base64.StdEncoding.EncodeToString([]byte(compileWarnings))
+		resultNotification.CompileOutputType = types.CompileOutputWarning
+	}
+	if w.config.LanguageCheck {
+		if warning := languageMismatchWarning(submission.Language, string(decodedCode)); warning != "" {
+			resultNotification.Warnings = append(resultNotification.Warnings, warning)
+		}
+	}
+	if len(submission.TestCases) == 0 {
+		switch zeroTestCasesStatus(w.config.ZeroTestCases) {
+		case ZeroTestCasesInvalid:
+			resultNotification.Message = "submission has no test cases"
+		case ZeroTestCasesPassed:
+			// A submission let through as PASSED scores full marks rather than the 0 of an empty sum.
+			resultNotification.Score = 100
+		}
+	}
+	resultNotification.CompileCommand = compileCommand
+	resultNotification.ExecuteCommand = executeCommand
+	if status, _, _ := computeOverallStatus(results, w.config.ZeroTestCases); status == "INTERNAL_ERROR" {
+		log.Printf("[Submission %d] [Worker %d] Judging failed with INTERNAL_ERROR on attempt %d.", submission.SubmissionID, w.id, submission.Attempts+1)
+		w.retry(job, submission, func(attempts int) {
+			resultNotification.Attempts = attempts
+			if err := sendResults(resultNotification, w); err != nil {
+				log.Printf("[Submission %d] [Worker %d] Failed to publish results: %v", submission.SubmissionID, w.id, err)
+			}
+		})
+		return
+	}
+	if submission.Rejudge && w.config.Batcher != nil && w.batchResults(resultNotification, job) {
+		return
+	}
+	if err := sendResults(resultNotification, w); err != nil {
+		log.Printf("[Submission %d] [Worker %d] Failed to publish results: %v. Retrying the submission.", submission.SubmissionID, w.id, err)
+		w.retry(job, submission, func(attempts int) {
+			w.publishInternalError(submission, attempts)
+		})
 		return
 	}
 
@@ -125,18 +462,89 @@ func (w *Worker) process(job amqp091.Delivery) {
 	log.Printf("[Submission %d] [Worker %d] Finished processing submission.", submission.SubmissionID, w.id)
 }
 
-func sendResults(submissionID int64, results []types.TestCaseResultMessage, w *Worker) error {
-	overallStatus, maxTime, maxMemory := computeOverallStatus(results)
-	log.Printf("[Submission %d] [Worker %d] Overall Status: %s (Time: %.3fs, Memory: %dKB)", submissionID, w.id, overallStatus, maxTime, maxMemory)
+// sendResults fills in the overall verdict, time and memory of a result notification
+// from its per-test-case results and publishes it.
+func sendResults(resultNotification types.ResultNotificationMessage, w *Worker) error {
+	overallStatus, maxTime, maxMemory := computeOverallStatus(resultNotification.Results, w.config.ZeroTestCases)
+	log.Printf("[Submission %d] [Worker %d] Overall Status: %s (Time: %.3fs, Memory: %dKB)", resultNotification.SubmissionID, w.id, overallStatus, maxTime, maxMemory)
 
-	resultNotification := types.ResultNotificationMessage{
-		SubmissionID: submissionID,
-		Status:       overallStatus,
-		TimeTaken:    maxTime,
-		MemoryUsed:   maxMemory,
-		Results:      results,
+	resultNotification.Status = overallStatus
+	resultNotification.TimeTaken = maxTime
+	resultNotification.MemoryUsed = maxMemory
+	return w.publishResult(resultNotification)
+}
+
+// batchResults hands the result notification of a rejudge submission to the batcher,
+// which acknowledges the job once the batch is published. It reports false, leaving
+// the result to be published on its own, when its verdict has its own route.
+func (w *Worker) batchResults(resultNotification types.ResultNotificationMessage, job amqp091.Delivery) bool {
+	submissionID := resultNotification.SubmissionID
+	resultNotification.Status, resultNotification.TimeTaken, resultNotification.MemoryUsed = computeOverallStatus(resultNotification.Results, w.config.ZeroTestCases)
+	if _, routed := w.config.ResultRoutes[resultNotification.Status]; routed {
+		return false
+	}
+	log.Printf("[Submission %d] [Worker %d] Overall Status: %s (Time: %.3fs, Memory: %dKB). Queued for the next result batch.",
+		submissionID, w.id, resultNotification.Status, resultNotification.TimeTaken, resultNotification.MemoryUsed)
+	w.prepareResult(&resultNotification)
+	w.config.Batcher.Add(w.compressed(resultNotification), func(err error) {
+		if err != nil {
+			log.Printf("[Submission %d] [Worker %d] Failed to publish result batch: %v. NACKing message.", submissionID, w.id, err)
+			job.Nack(false, true)
+			return
+		}
+		w.resultSent(submissionID, resultNotification.Status)
+		w.resultPublished(resultNotification)
+		job.Ack(false)
+		log.Printf("[Submission %d] [Worker %d] Finished processing submission.", submissionID, w.id)
+	})
+	return true
+}
+
+// publishResult publishes a final result notification, compressing it first if configured.
+func (w *Worker) publishResult(resultNotification types.ResultNotificationMessage) error {
+	w.prepareResult(&resultNotification)
+	route := w.resultRoute(resultNotification.Status)
+	if err := w.mqClient.Publish(route.Exchange, route.RoutingKey, w.compressed(resultNotification)); err != nil {
+		return err
+	}
+	w.resultSent(resultNotification.SubmissionID, resultNotification.Status)
+	w.resultPublished(resultNotification)
+	return nil
+}
+
+// prepareResult stamps a final result notification with where it was produced and
+// whether its verdict changed.
+func (w *Worker) prepareResult(resultNotification *types.ResultNotificationMessage) {
+	resultNotification.WorkerID = w.id
+	resultNotification.ExecutorHost = w.host
+	resultNotification.ExecutorVersion = version.BuildInfo().Version
+	if resultNotification.PreviousStatus != "" {
+		resultNotification.VerdictChanged = resultNotification.Status != resultNotification.PreviousStatus
+	}
+}
+
+// compressed returns the result notification as it is published: with its results
+// compressed if configured. The notification itself keeps its results, for the hook.
+func (w *Worker) compressed(resultNotification types.ResultNotificationMessage) types.ResultNotificationMessage {
+	if !w.config.CompressResults {
+		return resultNotification
+	}
+	submissionID := resultNotification.SubmissionID
+	compressed, err := resultNotification.CompressResults(w.config.CompressionThreshold)
+	if err != nil {
+		log.Printf("[Submission %d] [Worker %d] Failed to compress results, publishing uncompressed: %v", submissionID, w.id, err)
+	} else if compressed {
+		log.Printf("[Submission %d] [Worker %d] Compressed results to %d bytes", submissionID, w.id, len(resultNotification.CompressedResults))
+	}
+	return resultNotification
+}
+
+// resultRoute returns where a result with the given overall verdict is published.
+func (w *Worker) resultRoute(status string) ResultRoute {
+	if route, ok := w.config.ResultRoutes[status]; ok {
+		return route
 	}
-	return w.mqClient.Publish(rabbitmq.ResultExchange, rabbitmq.ResultRoutingKey, resultNotification)
+	return ResultRoute{Exchange: rabbitmq.ResultExchange, RoutingKey: rabbitmq.ResultRoutingKey}
 }
 
 func updateStatus(submissionID int64, status string, w *Worker) error {
@@ -147,7 +555,42 @@ func updateStatus(submissionID int64, status string, w *Worker) error {
 	return w.mqClient.Publish(rabbitmq.StatusExchange, rabbitmq.StatusRoutingKey, statusUpdate)
 }
 
-func computeTestCaseStatus(execResult *docker.ExecutionResult, expectedOutput string) string {
+// stopped reports whether the caller of Judge gave up on the submission.
+func (w *Worker) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopsJudging reports whether a test case verdict is one of the stopOn verdicts.
+func stopsJudging(stopOn []string, status string) bool {
+	for _, verdict := range stopOn {
+		if verdict == status {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceUsage returns the structured resource usage of a run, taking the wall time
+// and peak memory from the test case result so that both forms always agree.
+func resourceUsage(execResult *docker.ExecutionResult, result types.TestCaseResultMessage) *types.ResourceUsage {
+	return &types.ResourceUsage{
+		PeakMemoryKB: result.MemoryUsed,
+		CPUTime:      float64(execResult.CPUMillis) / 1000,
+		WallTime:     result.TimeTaken,
+		ExitCode:     execResult.ExitCode,
+		Signal:       execResult.Signal,
+	}
+}
+
+// computeTestCaseStatus derives the verdict of a single test case. Outputs are compared
+// byte-for-byte, so programs printing invalid UTF-8 are judged on their raw bytes unless
+// the checker requires UTF-8, in which case such output is rejected with ENCODING_ERROR.
+func computeTestCaseStatus(execResult *docker.ExecutionResult, expectedOutput string, checker types.CheckerConfig, cache *compareCache) string {
 	if execResult.Status == "TIME_LIMIT_EXCEEDED" {
 		return "TIME_LIMIT_EXCEEDED"
 	}
@@ -157,19 +600,39 @@ func computeTestCaseStatus(execResult *docker.ExecutionResult, expectedOutput st
 	if execResult.Status == "RUNTIME_ERROR" {
 		return "RUNTIME_ERROR"
 	}
+	if execResult.Status == "RESOURCE_LIMIT" {
+		return "RESOURCE_LIMIT"
+	}
+	if execResult.Status == "OUTPUT_LIMIT_EXCEEDED" {
+		return "OUTPUT_LIMIT_EXCEEDED"
+	}
 
-	actualOutput := strings.TrimSpace(execResult.Output)
-	expectedOutput = strings.TrimSpace(expectedOutput)
+	if checker.RequireUTF8 && !utf8.ValidString(execResult.Output) {
+		return "ENCODING_ERROR"
+	}
 
-	if actualOutput == expectedOutput {
+	if cache.compare(expectedOutput, execResult.Output, checker) {
 		return "PASSED"
 	}
 	return "WRONG_ANSWER"
 }
 
-func computeOverallStatus(results []types.TestCaseResultMessage) (string, float64, int64) {
+// zeroTestCasesStatus is the verdict of a submission with zero test cases under a
+// ZeroTestCases policy.
+func zeroTestCasesStatus(policy string) string {
+	switch policy {
+	case ZeroTestCasesInvalid, ZeroTestCasesPassed:
+		return policy
+	default:
+		return "COMPILATION_ERROR"
+	}
+}
+
+// computeOverallStatus returns the verdict, time and memory of a submission from its
+// per-test-case results. Without results, the verdict follows the ZeroTestCases policy.
+func computeOverallStatus(results []types.TestCaseResultMessage, zeroTestCases string) (string, float64, int64) {
 	if len(results) == 0 {
-		return "COMPILATION_ERROR", 0.0, 0
+		return zeroTestCasesStatus(zeroTestCases), 0.0, 0
 	}
 
 	var maxTime float64
@@ -184,18 +647,54 @@ func computeOverallStatus(results []types.TestCaseResultMessage) (string, float6
 			maxMemory = result.MemoryUsed
 		}
 
-		if result.Status == "COMPILATION_ERROR" {
+		if overallStatus == "DEADLINE_EXCEEDED" {
+			continue // Results past the deadline are worthless, nothing overrides it
+		}
+		if result.Status == "DEADLINE_EXCEEDED" {
+			overallStatus = "DEADLINE_EXCEEDED"
+		} else if result.Status == "COMPILATION_ERROR" {
 			overallStatus = "COMPILATION_ERROR"
+		} else if result.Status == "INTERNAL_ERROR" && overallStatus != "COMPILATION_ERROR" {
+			overallStatus = "INTERNAL_ERROR"
 		} else if result.Status == "RUNTIME_ERROR" && overallStatus == "PASSED" {
 			overallStatus = "RUNTIME_ERROR"
-		} else if result.Status == "TIME_LIMIT_EXCEEDED" && (overallStatus == "PASSED" || overallStatus == "WRONG_ANSWER") {
+		} else if result.Status == "TIME_LIMIT_EXCEEDED" && (overallStatus == "PASSED" || isWrongOutput(overallStatus)) {
 			overallStatus = "TIME_LIMIT_EXCEEDED"
-		} else if result.Status == "MEMORY_LIMIT_EXCEEDED" && (overallStatus == "PASSED" || overallStatus == "WRONG_ANSWER") {
+		} else if result.Status == "MEMORY_LIMIT_EXCEEDED" && (overallStatus == "PASSED" || isWrongOutput(overallStatus)) {
 			overallStatus = "MEMORY_LIMIT_EXCEEDED"
-		} else if result.Status == "WRONG_ANSWER" && overallStatus == "PASSED" {
-			overallStatus = "WRONG_ANSWER"
+		} else if result.Status == "RESOURCE_LIMIT" && (overallStatus == "PASSED" || isWrongOutput(overallStatus)) {
+			overallStatus = "RESOURCE_LIMIT"
+		} else if result.Status == "OUTPUT_LIMIT_EXCEEDED" && (overallStatus == "PASSED" || isWrongOutput(overallStatus)) {
+			overallStatus = "OUTPUT_LIMIT_EXCEEDED"
+		} else if isWrongOutput(result.Status) && overallStatus == "PASSED" {
+			overallStatus = result.Status
 		}
 	}
 
 	return overallStatus, maxTime, maxMemory
 }
+
+// exitCodeStatus applies a test case's expected exit code to the verdict its output
+// got: a program that ran to completion with another exit code is WRONG_ANSWER, and one
+// that a signal killed (e.g. SIGSEGV) is still RUNTIME_ERROR. With exitCodeOnly the
+// exit code alone decides, whatever the output.
+func exitCodeStatus(status string, exitCode, signal, expected int, exitCodeOnly bool) string {
+	if status != "PASSED" && !isWrongOutput(status) {
+		return status // It did not run to completion, e.g. TIME_LIMIT_EXCEEDED
+	}
+	if exitCode != expected {
+		if signal != 0 {
+			return "RUNTIME_ERROR"
+		}
+		return "WRONG_ANSWER"
+	}
+	if exitCodeOnly {
+		return "PASSED"
+	}
+	return status
+}
+
+// isWrongOutput reports whether a verdict means the program ran cleanly but its output was rejected.
+func isWrongOutput(status string) bool {
+	return status == "WRONG_ANSWER" || status == "ENCODING_ERROR"
+}
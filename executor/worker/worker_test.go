@@ -1,9 +1,18 @@
 package worker
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"online-judge/executor/docker"
+	"online-judge/executor/rabbitmq"
+	"online-judge/executor/testutil"
 	"online-judge/executor/types"
+	"online-judge/executor/version"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestComputeTestCaseStatus(t *testing.T) {
@@ -58,6 +67,24 @@ func TestComputeTestCaseStatus(t *testing.T) {
 			expectedOutput: "expected output",
 			want:           "RUNTIME_ERROR",
 		},
+		{
+			name: "thread limit exceeded",
+			execResult: &docker.ExecutionResult{
+				Output: "Thread limit exceeded: used 4 threads, allowed 1",
+				Status: "RESOURCE_LIMIT",
+			},
+			expectedOutput: "expected output",
+			want:           "RESOURCE_LIMIT",
+		},
+		{
+			name: "output limit exceeded",
+			execResult: &docker.ExecutionResult{
+				Output: "Output limit exceeded: more than 10 lines",
+				Status: "OUTPUT_LIMIT_EXCEEDED",
+			},
+			expectedOutput: "expected output",
+			want:           "OUTPUT_LIMIT_EXCEEDED",
+		},
 		{
 			name: "whitespace handling",
 			execResult: &docker.ExecutionResult{
@@ -76,11 +103,66 @@ func TestComputeTestCaseStatus(t *testing.T) {
 			expectedOutput: "",
 			want:           "PASSED",
 		},
+		{
+			name: "empty expected output with blank output",
+			execResult: &docker.ExecutionResult{
+				Output: " \n\n",
+				Status: "ACCEPTED",
+			},
+			expectedOutput: "\n",
+			want:           "PASSED",
+		},
+		{
+			name: "empty expected output with output",
+			execResult: &docker.ExecutionResult{
+				Output: "0\n",
+				Status: "ACCEPTED",
+			},
+			expectedOutput: "",
+			want:           "WRONG_ANSWER",
+		},
+		{
+			name: "empty expected output with a runtime error",
+			execResult: &docker.ExecutionResult{
+				Output: "",
+				Status: "RUNTIME_ERROR",
+			},
+			expectedOutput: "",
+			want:           "RUNTIME_ERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeTestCaseStatus(tt.execResult, tt.expectedOutput, types.CheckerConfig{}, nil)
+			if got != tt.want {
+				t.Errorf("computeTestCaseStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeTestCaseStatusInvalidUTF8(t *testing.T) {
+	rawOutput := "caf\xe9 \xff\xfe"
+
+	tests := []struct {
+		name           string
+		output         string
+		expectedOutput string
+		requireUTF8    bool
+		want           string
+	}{
+		{"identical raw bytes", rawOutput, rawOutput, false, "PASSED"},
+		{"different raw bytes", rawOutput, "caf\xe9 \xff\xfd", false, "WRONG_ANSWER"},
+		{"raw bytes against utf-8 text", rawOutput, "café \xff\xfe", false, "WRONG_ANSWER"},
+		{"invalid utf-8 when required", rawOutput, rawOutput, true, "ENCODING_ERROR"},
+		{"valid utf-8 when required", "café", "café", true, "PASSED"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := computeTestCaseStatus(tt.execResult, tt.expectedOutput)
+			execResult := &docker.ExecutionResult{Output: tt.output, Status: "ACCEPTED"}
+			got := computeTestCaseStatus(execResult, tt.expectedOutput, types.CheckerConfig{RequireUTF8: tt.requireUTF8}, nil)
 			if got != tt.want {
 				t.Errorf("computeTestCaseStatus() = %v, want %v", got, tt.want)
 			}
@@ -113,6 +195,17 @@ func TestComputeOverallStatus(t *testing.T) {
 			wantTime:   1.5,
 			wantMemory: 150,
 		},
+		{
+			name: "deadline exceeded overrides everything",
+			results: []types.TestCaseResultMessage{
+				{Status: "WRONG_ANSWER", TimeTaken: 1.0, MemoryUsed: 100},
+				{Status: "DEADLINE_EXCEEDED"},
+				{Status: "COMPILATION_ERROR"},
+			},
+			wantStatus: "DEADLINE_EXCEEDED",
+			wantTime:   1.0,
+			wantMemory: 100,
+		},
 		{
 			name: "compilation error priority",
 			results: []types.TestCaseResultMessage{
@@ -157,6 +250,37 @@ func TestComputeOverallStatus(t *testing.T) {
 			wantTime:   2.0,
 			wantMemory: 512,
 		},
+		{
+			name: "encoding error ranks with wrong answer",
+			results: []types.TestCaseResultMessage{
+				{Status: "PASSED", TimeTaken: 1.0, MemoryUsed: 100},
+				{Status: "ENCODING_ERROR", TimeTaken: 1.0, MemoryUsed: 100},
+				{Status: "TIME_LIMIT_EXCEEDED", TimeTaken: 3.0, MemoryUsed: 100},
+			},
+			wantStatus: "TIME_LIMIT_EXCEEDED",
+			wantTime:   3.0,
+			wantMemory: 100,
+		},
+		{
+			name: "resource limit priority",
+			results: []types.TestCaseResultMessage{
+				{Status: "WRONG_ANSWER", TimeTaken: 1.0, MemoryUsed: 100},
+				{Status: "RESOURCE_LIMIT", TimeTaken: 1.5, MemoryUsed: 150},
+			},
+			wantStatus: "RESOURCE_LIMIT",
+			wantTime:   1.5,
+			wantMemory: 150,
+		},
+		{
+			name: "output limit priority",
+			results: []types.TestCaseResultMessage{
+				{Status: "WRONG_ANSWER", TimeTaken: 1.0, MemoryUsed: 100},
+				{Status: "OUTPUT_LIMIT_EXCEEDED", TimeTaken: 0.5, MemoryUsed: 150},
+			},
+			wantStatus: "OUTPUT_LIMIT_EXCEEDED",
+			wantTime:   1.0,
+			wantMemory: 150,
+		},
 		{
 			name: "wrong answer priority",
 			results: []types.TestCaseResultMessage{
@@ -172,7 +296,7 @@ func TestComputeOverallStatus(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotStatus, gotTime, gotMemory := computeOverallStatus(tt.results)
+			gotStatus, gotTime, gotMemory := computeOverallStatus(tt.results, ZeroTestCasesCompilationError)
 			if gotStatus != tt.wantStatus {
 				t.Errorf("computeOverallStatus() status = %v, want %v", gotStatus, tt.wantStatus)
 			}
@@ -185,3 +309,725 @@ func TestComputeOverallStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestSendResultsCompression(t *testing.T) {
+	results := []types.TestCaseResultMessage{
+		{TestCaseID: "tc1", Status: "PASSED", Output: "aGVsbG8=", TimeTaken: 0.5, MemoryUsed: 64},
+	}
+
+	tests := []struct {
+		name           string
+		config         Config
+		wantCompressed bool
+	}{
+		{"disabled", DefaultConfig(), false},
+		{"enabled above threshold", Config{CompressResults: true, CompressionThreshold: 1}, true},
+		{"enabled below threshold", Config{CompressResults: true, CompressionThreshold: 1 << 20}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, tt.config)
+
+			if err := sendResults(types.ResultNotificationMessage{SubmissionID: 7, Results: results}, w); err != nil {
+				t.Fatalf("sendResults failed: %v", err)
+			}
+			published := client.Published()
+			if len(published) != 1 {
+				t.Fatalf("published %d messages, want 1", len(published))
+			}
+			if published[0].Exchange != rabbitmq.ResultExchange || published[0].RoutingKey != rabbitmq.ResultRoutingKey {
+				t.Errorf("published to %s/%s, want %s/%s", published[0].Exchange, published[0].RoutingKey, rabbitmq.ResultExchange, rabbitmq.ResultRoutingKey)
+			}
+
+			msg := published[0].Body.(types.ResultNotificationMessage)
+			if (msg.Compression == types.CompressionGzip) != tt.wantCompressed {
+				t.Errorf("Compression = %q, want compressed = %v", msg.Compression, tt.wantCompressed)
+			}
+			if err := msg.DecompressResults(); err != nil {
+				t.Fatalf("DecompressResults failed: %v", err)
+			}
+			if len(msg.Results) != 1 || msg.Results[0].TestCaseID != "tc1" {
+				t.Errorf("Results = %+v, want the original single result", msg.Results)
+			}
+		})
+	}
+}
+
+func TestPublishResultRouting(t *testing.T) {
+	config := DefaultConfig()
+	config.ResultRoutes = map[string]ResultRoute{
+		"INTERNAL_ERROR": {Exchange: "oj.ex.ops", RoutingKey: "submission.internal"},
+	}
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, config)
+
+	if err := w.publishResult(types.ResultNotificationMessage{SubmissionID: 1, Status: "INTERNAL_ERROR"}); err != nil {
+		t.Fatalf("publishResult failed: %v", err)
+	}
+	if err := w.publishResult(types.ResultNotificationMessage{SubmissionID: 2, Status: "PASSED"}); err != nil {
+		t.Fatalf("publishResult failed: %v", err)
+	}
+
+	published := client.Published()
+	if len(published) != 2 {
+		t.Fatalf("published %d messages, want 2", len(published))
+	}
+	if published[0].Exchange != "oj.ex.ops" || published[0].RoutingKey != "submission.internal" {
+		t.Errorf("INTERNAL_ERROR published to %s/%s, want oj.ex.ops/submission.internal", published[0].Exchange, published[0].RoutingKey)
+	}
+	if published[1].Exchange != rabbitmq.ResultExchange || published[1].RoutingKey != rabbitmq.ResultRoutingKey {
+		t.Errorf("PASSED published to %s/%s, want the default result exchange", published[1].Exchange, published[1].RoutingKey)
+	}
+}
+
+func TestProcessReportsCompileWarnings(t *testing.T) {
+	acker := testutil.NewRecordingAcknowledger()
+	delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "CPP", "int main() { int unused; }", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", ""),
+	}))
+	delivery.Acknowledger, delivery.DeliveryTag = acker, 1
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", CompileOutput: "main.cpp:1:18: warning: unused variable 'unused'"}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 {
+		t.Fatalf("published %d results, want 1", len(results))
+	}
+	if results[0].Status != "PASSED" {
+		t.Errorf("Status = %s, want PASSED", results[0].Status)
+	}
+	if results[0].CompileOutputType != types.CompileOutputWarning {
+		t.Errorf("CompileOutputType = %q, want %q", results[0].CompileOutputType, types.CompileOutputWarning)
+	}
+	warnings, _ := base64.StdEncoding.DecodeString(results[0].CompileOutput)
+	if !strings.Contains(string(warnings), "unused variable") {
+		t.Errorf("CompileOutput = %q, want the compiler warning", warnings)
+	}
+}
+
+func TestProcessReportsCompileMillis(t *testing.T) {
+	for _, tt := range []struct {
+		language      string
+		status        string
+		runMillis     int64 // The CompileMillis of the runs
+		compileMillis int64
+	}{
+		{"CPP", "ACCEPTED", 850, 850},
+		{"PYTHON", "ACCEPTED", 0, 0},
+		{"PYTHON", "COMPILATION_ERROR", 40, 0}, // A failed syntax check is no compile
+	} {
+		delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, tt.language, "code", 1.0, 64, []testutil.TestCase{
+			testutil.CreateSimpleTestCase("tc1", "", ""),
+			testutil.CreateSimpleTestCase("tc2", "", ""),
+		}))
+
+		client := &testutil.RecordingClient{}
+		w := NewWorker(1, nil, client, DefaultConfig())
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			return &docker.ExecutionResult{Status: tt.status, TimeMillis: 10, CompileMillis: tt.runMillis}, nil
+		}
+
+		w.handle(delivery)
+
+		results := resultsFor(client, 1)
+		if len(results) != 1 {
+			t.Fatalf("%s: published %d results, want 1", tt.language, len(results))
+		}
+		if results[0].CompileMillis != tt.compileMillis {
+			t.Errorf("%s: CompileMillis = %d, want %d", tt.language, results[0].CompileMillis, tt.compileMillis)
+		}
+		for _, r := range results[0].Results {
+			if r.Status == "PASSED" && r.TimeTaken != 0.01 {
+				t.Errorf("%s: test case %s time = %v, want the run time alone", tt.language, r.TestCaseID, r.TimeTaken)
+			}
+		}
+	}
+}
+
+func TestProcessReportsResourceUsage(t *testing.T) {
+	delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "CPP", "code", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("ok", "ok", "1"),
+		testutil.CreateSimpleTestCase("crash", "crash", "1"),
+	}))
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		if req.Input == "crash" {
+			return &docker.ExecutionResult{Status: "RUNTIME_ERROR", TimeMillis: 40, MemoryKB: 3000, CPUMillis: 35, ExitCode: 139, Signal: 11}, nil
+		}
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "1", TimeMillis: 250, MemoryKB: 2048, CPUMillis: 480}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || len(results[0].Results) != 2 {
+		t.Fatalf("results = %+v, want one result for two test cases", results)
+	}
+	want := []types.ResourceUsage{
+		{PeakMemoryKB: 2048, CPUTime: 0.48, WallTime: 0.25},
+		{PeakMemoryKB: 3000, CPUTime: 0.035, WallTime: 0.04, ExitCode: 139, Signal: 11},
+	}
+	for i, r := range results[0].Results {
+		if r.ResourceUsage == nil {
+			t.Fatalf("test case %s has no resource usage", r.TestCaseID)
+		}
+		if *r.ResourceUsage != want[i] {
+			t.Errorf("test case %s usage = %+v, want %+v", r.TestCaseID, *r.ResourceUsage, want[i])
+		}
+		if r.ResourceUsage.WallTime != r.TimeTaken || r.ResourceUsage.PeakMemoryKB != r.MemoryUsed {
+			t.Errorf("test case %s usage %+v disagrees with TimeTaken %v and MemoryUsed %d",
+				r.TestCaseID, *r.ResourceUsage, r.TimeTaken, r.MemoryUsed)
+		}
+	}
+}
+
+func TestProcessReportsCommandLines(t *testing.T) {
+	delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "CPP", "int main() {}", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "", ""),
+		testutil.CreateSimpleTestCase("tc2", "", ""),
+	}))
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{
+			Status:         "ACCEPTED",
+			CompileCommand: "g++ -std=c++20 main.cpp -o main",
+			ExecuteCommand: "sh -c 'exec ./main < /app/input.txt'",
+			Timeline:       "[   0.001s] stderr: debug\n",
+		}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 {
+		t.Fatalf("published %d results, want 1", len(results))
+	}
+	if !strings.Contains(results[0].CompileCommand, "-std=c++20") {
+		t.Errorf("CompileCommand = %q, want the injected -std=c++20", results[0].CompileCommand)
+	}
+	if !strings.Contains(results[0].ExecuteCommand, "./main") {
+		t.Errorf("ExecuteCommand = %q, want the execute command", results[0].ExecuteCommand)
+	}
+	if timeline, _ := base64.StdEncoding.DecodeString(results[0].Results[0].Timeline); !strings.Contains(string(timeline), "stderr: debug") {
+		t.Errorf("Timeline = %q, want the run's timeline", timeline)
+	}
+}
+
+func TestProcessWarnsAboutLanguageMismatch(t *testing.T) {
+	for _, check := range []bool{false, true} {
+		delivery := testutil.CreateTestDelivery(testutil.CreateTestSubmission(1, "CPP", "print(input())\n", 1.0, 64, []testutil.TestCase{
+			testutil.CreateSimpleTestCase("tc1", "", ""),
+		}))
+		delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+		client := &testutil.RecordingClient{}
+		config := DefaultConfig()
+		config.LanguageCheck = check
+		w := NewWorker(1, nil, client, config)
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			return &docker.ExecutionResult{Status: "COMPILATION_ERROR", Output: "main.cpp:1:1: error: 'print' was not declared"}, nil
+		}
+
+		w.handle(delivery)
+
+		results := resultsFor(client, 1)
+		if len(results) != 1 {
+			t.Fatalf("LanguageCheck %v: published %d results, want 1", check, len(results))
+		}
+		if results[0].Status != "COMPILATION_ERROR" {
+			t.Errorf("LanguageCheck %v: Status = %s, want the verdict unchanged", check, results[0].Status)
+		}
+		wantWarnings := 0
+		if check {
+			wantWarnings = 1
+		}
+		if len(results[0].Warnings) != wantWarnings {
+			t.Errorf("LanguageCheck %v: Warnings = %q, want %d", check, results[0].Warnings, wantWarnings)
+		}
+	}
+}
+
+func TestProcessRuntimeErrorAsWrongAnswer(t *testing.T) {
+	for _, policy := range []bool{false, true} {
+		submission := testutil.CreateTestSubmission(1, "PYTHON", "raise ValueError('secret')", 1.0, 64, []testutil.TestCase{
+			testutil.CreateSimpleTestCase("sample", "", "1"),
+			testutil.CreateSimpleTestCase("hidden", "", "1"),
+		})
+		submission.TestCases[0].IsSample = true
+		submission.CheckerConfig.RuntimeErrorAsWrongAnswer = policy
+		delivery := testutil.CreateTestDelivery(submission)
+		delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+		client := &testutil.RecordingClient{}
+		w := NewWorker(1, nil, client, DefaultConfig())
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			return &docker.ExecutionResult{Status: "RUNTIME_ERROR", Output: "ValueError: secret"}, nil
+		}
+
+		w.handle(delivery)
+
+		results := resultsFor(client, 1)
+		if len(results) != 1 || len(results[0].Results) != 2 {
+			t.Fatalf("policy %v: published %+v, want one result with two test cases", policy, results)
+		}
+		sample, hidden := results[0].Results[0], results[0].Results[1]
+		if sample.Status != "RUNTIME_ERROR" || sample.Output == "" {
+			t.Errorf("policy %v: sample = %s with output %q, want RUNTIME_ERROR with its error output", policy, sample.Status, sample.Output)
+		}
+		wantHidden, wantOutput := "RUNTIME_ERROR", base64.StdEncoding.EncodeToString([]byte("ValueError: secret"))
+		if policy {
+			wantHidden, wantOutput = "WRONG_ANSWER", ""
+		}
+		if hidden.Status != wantHidden || hidden.Output != wantOutput {
+			t.Errorf("policy %v: hidden = %s with output %q, want %s with %q", policy, hidden.Status, hidden.Output, wantHidden, wantOutput)
+		}
+	}
+}
+
+func TestProcessExitCodePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"", "RUNTIME_ERROR"},
+		{types.ExitCodeStrict, "RUNTIME_ERROR"},
+		{types.ExitCodeIgnore, "PASSED"},
+	}
+
+	for _, tt := range tests {
+		submission := testutil.CreateTestSubmission(1, "PYTHON", "print(42); exit(3)", 1.0, 64, []testutil.TestCase{
+			testutil.CreateSimpleTestCase("tc1", "", "42"),
+		})
+		submission.CheckerConfig.ExitCode = tt.policy
+		delivery := testutil.CreateTestDelivery(submission)
+		delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+		client := &testutil.RecordingClient{}
+		w := NewWorker(1, nil, client, DefaultConfig())
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			// The program prints the right answer, then exits non-zero
+			if !req.IgnoreExitCode {
+				return &docker.ExecutionResult{Status: "RUNTIME_ERROR", Output: "42", ExitCode: 3}, nil
+			}
+			return &docker.ExecutionResult{Status: "ACCEPTED", Output: "42", ExitCode: 3}, nil
+		}
+
+		w.handle(delivery)
+
+		results := resultsFor(client, 1)
+		if len(results) != 1 || len(results[0].Results) != 1 {
+			t.Fatalf("policy %q: published %+v, want one result", tt.policy, results)
+		}
+		if status := results[0].Results[0].Status; status != tt.want {
+			t.Errorf("policy %q: status = %s, want %s", tt.policy, status, tt.want)
+		}
+	}
+}
+
+func TestProcessStopOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		stopOn   []string
+		statuses []string
+	}{
+		{"runs all test cases by default", nil, []string{"WRONG_ANSWER", "PASSED", "RUNTIME_ERROR", "PASSED"}},
+		{"stops on a crash only", []string{"RUNTIME_ERROR"}, []string{"WRONG_ANSWER", "PASSED", "RUNTIME_ERROR"}},
+		{"stops on a wrong answer", []string{"RUNTIME_ERROR", "WRONG_ANSWER"}, []string{"WRONG_ANSWER"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+				testutil.CreateSimpleTestCase("tc1", "wrong", "1"),
+				testutil.CreateSimpleTestCase("tc2", "1", "1"),
+				testutil.CreateSimpleTestCase("tc3", "crash", "1"),
+				testutil.CreateSimpleTestCase("tc4", "1", "1"),
+			})
+			submission.StopOn = tt.stopOn
+			delivery := testutil.CreateTestDelivery(submission)
+			delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, DefaultConfig())
+			runs := 0
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				runs++
+				if req.Input == "crash" {
+					return &docker.ExecutionResult{Status: "RUNTIME_ERROR"}, nil
+				}
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+			}
+
+			w.handle(delivery)
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 {
+				t.Fatalf("published %d results, want 1", len(results))
+			}
+			var statuses []string
+			for _, result := range results[0].Results {
+				statuses = append(statuses, result.Status)
+			}
+			if strings.Join(statuses, " ") != strings.Join(tt.statuses, " ") || runs != len(tt.statuses) {
+				t.Errorf("ran %d test cases with verdicts %v, want %v", runs, statuses, tt.statuses)
+			}
+		})
+	}
+}
+
+func TestProcessCompilationErrorFailsAllTestCasesOnce(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input(", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "1", "1"),
+		testutil.CreateSimpleTestCase("tc2", "2", "2"),
+		testutil.CreateSimpleTestCase("tc3", "3", "3"),
+	})
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	runs := 0
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		runs++
+		return &docker.ExecutionResult{Status: "COMPILATION_ERROR", Output: "SyntaxError: '(' was never closed"}, nil
+	}
+
+	w.handle(delivery)
+
+	if runs != 1 {
+		t.Errorf("ran %d times, want the failed syntax check only", runs)
+	}
+	results := resultsFor(client, 1)
+	if len(results) != 1 || results[0].Status != "COMPILATION_ERROR" || len(results[0].Results) != 3 {
+		t.Fatalf("published %+v, want one COMPILATION_ERROR result for all three test cases", results)
+	}
+	want := base64.StdEncoding.EncodeToString([]byte("SyntaxError: '(' was never closed"))
+	for _, result := range results[0].Results {
+		if result.Status != "COMPILATION_ERROR" || result.Output != want {
+			t.Errorf("test case %s = %s with output %q, want COMPILATION_ERROR with the diagnostics", result.TestCaseID, result.Status, result.Output)
+		}
+	}
+}
+
+func TestProcessSkipsSyntaxCheckOncePassed(t *testing.T) {
+	submission := testutil.CreateTestSubmission(1, "PYTHON", "print(input())", 1.0, 64, []testutil.TestCase{
+		testutil.CreateSimpleTestCase("tc1", "1", "1"),
+		testutil.CreateSimpleTestCase("tc2", "2", "2"),
+		testutil.CreateSimpleTestCase("tc3", "3", "3"),
+	})
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	var skipped []bool
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		skipped = append(skipped, req.SkipSyntaxCheck)
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: req.Input}, nil
+	}
+
+	w.handle(delivery)
+
+	if !reflect.DeepEqual(skipped, []bool{false, true, true}) {
+		t.Errorf("SkipSyntaxCheck = %v, want only the first run checked", skipped)
+	}
+}
+
+func TestProcessEchoesMetadata(t *testing.T) {
+	metadata := map[string]string{"userId": "42", "problemId": "p-7", "contestId": "", "note": "a=b, \"quoted\""}
+	submission := testutil.CreatePythonHelloWorldSubmission()
+	submission.Metadata = metadata
+	delivery := testutil.CreateTestDelivery(submission)
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, submission.SubmissionID)
+	if len(results) != 1 {
+		t.Fatalf("published %d results, want 1", len(results))
+	}
+	body, err := json.Marshal(results[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received types.ResultNotificationMessage
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(received.Metadata, metadata) {
+		t.Errorf("Metadata = %v, want %v", received.Metadata, metadata)
+	}
+}
+
+func TestProcessReportsVerdictChange(t *testing.T) {
+	tests := []struct {
+		previous    string
+		wantChanged bool
+	}{
+		{"", false},
+		{"WRONG_ANSWER", true},
+		{"PASSED", false},
+	}
+
+	for _, tt := range tests {
+		submission := testutil.CreatePythonHelloWorldSubmission()
+		submission.Rejudge = true
+		submission.PreviousStatus = tt.previous
+
+		client := &testutil.RecordingClient{}
+		w := NewWorker(1, nil, client, DefaultConfig())
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			return &docker.ExecutionResult{Status: "ACCEPTED", Output: "Hello, World!"}, nil
+		}
+
+		w.handle(testutil.CreateTestDelivery(submission))
+
+		results := resultsFor(client, submission.SubmissionID)
+		if len(results) != 1 || results[0].Status != "PASSED" {
+			t.Fatalf("previous %q: results = %+v, want PASSED", tt.previous, results)
+		}
+		if results[0].PreviousStatus != tt.previous || results[0].VerdictChanged != tt.wantChanged {
+			t.Errorf("previous %q: PreviousStatus = %q, VerdictChanged = %v, want %q and %v",
+				tt.previous, results[0].PreviousStatus, results[0].VerdictChanged, tt.previous, tt.wantChanged)
+		}
+	}
+}
+
+func TestProcessReportsKillTiming(t *testing.T) {
+	delivery := testutil.CreateTestDelivery(testutil.CreatePythonHelloWorldSubmission())
+	delivery.Acknowledger = testutil.NewRecordingAcknowledger()
+
+	client := &testutil.RecordingClient{}
+	w := NewWorker(1, nil, client, DefaultConfig())
+	w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+		return &docker.ExecutionResult{
+			Status:         "TIME_LIMIT_EXCEEDED",
+			Output:         "Time limit exceeded",
+			TimeMillis:     2600,
+			Overran:        true,
+			OverrunMillis:  500,
+			KilledAtMillis: 2500,
+		}, nil
+	}
+
+	w.handle(delivery)
+
+	results := resultsFor(client, 1)
+	if len(results) != 1 || len(results[0].Results) != 1 {
+		t.Fatalf("published results = %+v, want one result with one test case", results)
+	}
+	tc := results[0].Results[0]
+	if tc.Status != "TIME_LIMIT_EXCEEDED" {
+		t.Errorf("Status = %s, want TIME_LIMIT_EXCEEDED", tc.Status)
+	}
+	if !tc.Overran || tc.Overrun != 0.5 || tc.KilledAt != 2.5 {
+		t.Errorf("Overran, Overrun, KilledAt = %v, %v, %v, want true, 0.5, 2.5", tc.Overran, tc.Overrun, tc.KilledAt)
+	}
+}
+
+func TestProcessDeadline(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		deadline   *time.Time
+		wantRuns   int
+		wantStatus string
+	}{
+		{"no deadline", nil, 2, "PASSED"},
+		{"future deadline", &future, 2, "PASSED"},
+		{"past deadline", &past, 0, "DEADLINE_EXCEEDED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := testutil.CreateTestSubmission(1, "PYTHON", "print('hi')", 1.0, 64, []testutil.TestCase{
+				testutil.CreateSimpleTestCase("tc1", "", "hi"),
+				testutil.CreateSimpleTestCase("tc2", "", "hi"),
+			})
+			submission.Deadline = tt.deadline
+			delivery := testutil.CreateTestDelivery(submission)
+			acker := testutil.NewRecordingAcknowledger()
+			delivery.Acknowledger, delivery.DeliveryTag = acker, 1
+
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, DefaultConfig())
+			runs := 0
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				runs++
+				return &docker.ExecutionResult{Status: "ACCEPTED", Output: "hi"}, nil
+			}
+
+			w.handle(delivery)
+
+			if runs != tt.wantRuns {
+				t.Errorf("ran %d test cases, want %d", runs, tt.wantRuns)
+			}
+			results := resultsFor(client, 1)
+			if len(results) != 1 || results[0].Status != tt.wantStatus || len(results[0].Results) != 2 {
+				t.Fatalf("published results = %+v, want a single %s with both test cases", results, tt.wantStatus)
+			}
+			if s, _ := acker.Settlement(1); !s.Acked {
+				t.Errorf("settlement = %+v, want acked", s)
+			}
+		})
+	}
+}
+
+func TestPublishResultTraceability(t *testing.T) {
+	client := &testutil.RecordingClient{}
+	w := NewWorker(7, nil, client, DefaultConfig())
+
+	if err := sendResults(types.ResultNotificationMessage{SubmissionID: 1, Results: []types.TestCaseResultMessage{{TestCaseID: "tc1", Status: "PASSED"}}}, w); err != nil {
+		t.Fatalf("sendResults failed: %v", err)
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("os.Hostname failed: %v", err)
+	}
+	results := resultsFor(client, 1)
+	if len(results) != 1 {
+		t.Fatalf("published %d results, want 1", len(results))
+	}
+	if results[0].WorkerID != 7 || results[0].ExecutorHost != host {
+		t.Errorf("WorkerID, ExecutorHost = %d, %q, want 7, %q", results[0].WorkerID, results[0].ExecutorHost, host)
+	}
+	if want := version.BuildInfo().Version; results[0].ExecutorVersion != want {
+		t.Errorf("ExecutorVersion = %q, want %q", results[0].ExecutorVersion, want)
+	}
+}
+
+func TestProcessExpectedExitCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		exitCode     int
+		signal       int
+		output       string
+		status       string
+		exitCodeOnly bool
+		want         string
+	}{
+		{"matching exit code and output", 3, 0, "42", "ACCEPTED", false, "PASSED"},
+		{"mismatching exit code", 0, 0, "42", "ACCEPTED", false, "WRONG_ANSWER"},
+		{"matching exit code, wrong output", 3, 0, "41", "ACCEPTED", false, "WRONG_ANSWER"},
+		{"exit code only, matching", 3, 0, "anything", "ACCEPTED", true, "PASSED"},
+		{"exit code only, mismatching", 1, 0, "42", "ACCEPTED", true, "WRONG_ANSWER"},
+		{"killed by a signal", 139, 11, "42", "ACCEPTED", false, "RUNTIME_ERROR"},
+		{"exit code only, killed by a signal", 139, 11, "", "ACCEPTED", true, "RUNTIME_ERROR"},
+		{"time limit exceeded", 3, 0, "", "TIME_LIMIT_EXCEEDED", true, "TIME_LIMIT_EXCEEDED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := testutil.CreateTestSubmission(1, "C", "int main() { return 3; }", 1.0, 64, []testutil.TestCase{
+				testutil.CreateSimpleTestCase("tc1", "", "42"),
+			})
+			expected := 3
+			submission.TestCases[0].ExpectedExitCode = &expected
+			submission.TestCases[0].ExitCodeOnly = tt.exitCodeOnly
+
+			client := &testutil.RecordingClient{}
+			w := NewWorker(1, nil, client, DefaultConfig())
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				if !req.IgnoreExitCode {
+					t.Error("IgnoreExitCode = false, want a non-zero exit judged by the expected exit code")
+				}
+				return &docker.ExecutionResult{Status: tt.status, Output: tt.output, ExitCode: tt.exitCode, Signal: tt.signal}, nil
+			}
+
+			w.handle(testutil.CreateTestDelivery(submission))
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 || len(results[0].Results) != 1 || results[0].Results[0].Status != tt.want {
+				t.Fatalf("results = %+v, want %s", results, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessDebugBuild(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		submission := testutil.CreateTestSubmission(1, "CPP", "int main() {}", 1.0, 64, []testutil.TestCase{
+			testutil.CreateSimpleTestCase("tc1", "", ""),
+		})
+		submission.DebugBuild = debug
+
+		w := NewWorker(1, nil, &testutil.RecordingClient{}, DefaultConfig())
+		w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+			if req.DebugBuild != debug {
+				t.Errorf("DebugBuild = %v, want %v", req.DebugBuild, debug)
+			}
+			return &docker.ExecutionResult{Status: "ACCEPTED"}, nil
+		}
+
+		w.handle(testutil.CreateTestDelivery(submission))
+	}
+}
+
+func TestProcessZeroTestCases(t *testing.T) {
+	tests := []struct {
+		policy      string
+		wantStatus  string
+		wantMessage bool
+		wantScore   float64
+	}{
+		{ZeroTestCasesCompilationError, "COMPILATION_ERROR", false, 0},
+		{ZeroTestCasesInvalid, "INVALID", true, 0},
+		{ZeroTestCasesPassed, "PASSED", false, 100},
+		{"", "COMPILATION_ERROR", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			submission := testutil.CreateTestSubmission(1, "PYTHON", "print(1)", 1.0, 64, []testutil.TestCase{})
+			config := DefaultConfig()
+			config.ZeroTestCases = tt.policy
+			client := &testutil.RecordingClient{}
+			acker := testutil.NewRecordingAcknowledger()
+			w := NewWorker(1, nil, client, config)
+			w.runner = func(req docker.RunRequest) (*docker.ExecutionResult, error) {
+				t.Error("ran a submission without test cases")
+				return &docker.ExecutionResult{Status: "ACCEPTED"}, nil
+			}
+
+			delivery := testutil.CreateTestDelivery(submission)
+			delivery.Acknowledger = acker
+			w.handle(delivery)
+
+			results := resultsFor(client, 1)
+			if len(results) != 1 || results[0].Status != tt.wantStatus {
+				t.Fatalf("results = %+v, want one %s result", results, tt.wantStatus)
+			}
+			if gotMessage := results[0].Message != ""; gotMessage != tt.wantMessage {
+				t.Errorf("Message = %q, want a message: %v", results[0].Message, tt.wantMessage)
+			}
+			if results[0].Score != tt.wantScore {
+				t.Errorf("Score = %v, want %v", results[0].Score, tt.wantScore)
+			}
+			if s, _ := acker.Settlement(0); !s.Acked {
+				t.Errorf("settlement = %+v, want acked", s)
+			}
+		})
+	}
+}